@@ -5,20 +5,24 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/kajikentaro/spotify-fbc/logins"
+	"github.com/kajikentaro/spotify-fbc/models"
 	"github.com/kajikentaro/spotify-fbc/repositories"
 	"github.com/kajikentaro/spotify-fbc/services"
 	"github.com/kajikentaro/spotify-fbc/services/interfaces"
 	"github.com/spf13/cobra"
-	"github.com/zmb3/spotify/v2"
 )
 
 var SPOTIFY_PLAYLIST_ROOT = "spotify-fbc"
 
+// エラーの終了ステータス1と区別するため, diffと同じく差分がある場合は2で終了する
+const EXIT_CODE_DIFFERENCE = 2
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -38,9 +42,44 @@ func init() {
 	rootCmd.AddCommand(overwriteCmd)
 	rootCmd.AddCommand(cleanCmd)
 	rootCmd.AddCommand(pushCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(restoreCmd)
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheStatsCmd)
+	rootCmd.AddCommand(exportCmd)
 
 	overwriteCmd.Flags().BoolP("dry-run", "d", false, "Simulate the overwrite operation without making changes")
+	for _, c := range []*cobra.Command{overwriteCmd, pushCmd, applyCmd, syncCmd} {
+		addDeleteLimitFlags(c)
+	}
+	overwriteCmd.Flags().String("plan", "", "Save the changes to the file without making changes. Execute it later with 'apply'")
 	pushCmd.Flags().BoolP("dry-run", "d", false, "Simulate the push operation without making changes")
+	for _, c := range []*cobra.Command{overwriteCmd, pushCmd} {
+		c.Flags().BoolP("interactive", "i", false, "Choose songs that were not found by search from the candidates")
+	}
+	syncCmd.Flags().BoolP("dry-run", "d", false, "Simulate the sync operation without making changes")
+	pullCmd.Flags().Bool("full", false, "Fetch all tracks even if the playlist has not changed since the last fetch")
+	pullCmd.Flags().BoolP("force", "f", false, "Overwrite your local changes with your spotify account")
+	pullCmd.Flags().BoolP("merge", "m", false, "Download remote changes keeping your local changes")
+	pullCmd.Flags().Bool("exclude-followed", false, "Do not download playlists owned by other users. The choice is saved for later commands")
+	pullCmd.Flags().Bool("library", false, "Also download saved albums to _albums and followed artists to _artists. The choice is saved for later pulls")
+	pullCmd.Flags().Bool("liked-songs", false, "Also download your Liked Songs to the 'Liked Songs' directory. The choice is saved for later commands")
+	pullCmd.Flags().Bool("relink", false, "Write the id of a playable version for songs that are unavailable in your country. Run overwrite to replace them on Spotify")
+	restoreCmd.Flags().BoolP("remote", "r", false, "Restore playlists on your spotify account instead of local directories")
+	undoCmd.Flags().BoolP("list", "l", false, "Show the runs that can be reverted")
+	compareCmd.Flags().Bool("full", false, "Fetch all tracks even if the playlist has not changed since the last fetch")
+	for _, c := range []*cobra.Command{pullCmd, compareCmd} {
+		c.Flags().Int("concurrency", repositories.DEFAULT_CONCURRENCY, "Number of playlists whose songs are fetched at the same time")
+	}
+	compareCmd.Flags().String("format", services.COMPARE_FORMAT_TEXT, "Output format (text, json or diff)")
+	exportCmd.Flags().StringP("out", "o", "spotify-fbc-export", "Directory to write the playlist files to")
+	exportCmd.Flags().StringSlice("format", []string{models.EXPORT_FORMAT_M3U8, models.EXPORT_FORMAT_XSPF}, "Formats of the playlist files (m3u8, xspf)")
 }
 
 var cleanCmd = &cobra.Command{
@@ -73,12 +112,15 @@ var pushCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		if interactive && dryRun {
+			log.Fatalln("--interactive cannot be used with --dry-run")
+		}
+		var confirm func(string) bool
 		if dryRun {
 			fmt.Println("Dry run enabled: No changes will be made.")
 		} else {
-			if !askForConfirmation("WARNING: Your remote spotify playlist will be replaced") {
-				return
-			}
+			confirm = confirmWithSummary("WARNING: Your remote spotify playlist will be replaced")
 		}
 
 		ctx := context.Background()
@@ -90,9 +132,13 @@ var pushCmd = &cobra.Command{
 			repository = repositories.NewRepository(client, ctx, ".")
 		}
 		service := services.NewService(repository)
+		service.SetDeleteLimit(deleteLimitFromFlags(cmd))
+		if interactive {
+			service.SetPrompt(askForInput)
+		}
 
 		playlistName := args[0]
-		if err := service.PushSpecificPlaylist(playlistName); err != nil {
+		if err := service.PushSpecificPlaylist(playlistName, dryRun, confirm); err != nil {
 			log.Fatalln(err)
 		}
 	},
@@ -103,12 +149,235 @@ var overwriteCmd = &cobra.Command{
 	Short: "Synchronize your local files and directories with your spotify account",
 	Run: func(cmd *cobra.Command, args []string) {
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		planPath, _ := cmd.Flags().GetString("plan")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		if interactive && (dryRun || planPath != "") {
+			log.Fatalln("--interactive cannot be used with --dry-run or --plan")
+		}
+		if planPath != "" {
+			ctx := context.Background()
+			client, _ := setup(ctx)
+			repository := repositories.NewReadOnlyRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT, false)
+			service := services.NewService(repository)
+			service.SetDeleteLimit(deleteLimitFromFlags(cmd))
+			service.SetLibrary(fetchSettings(repository).Library)
+			if err := service.SavePlan(planPath); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+
+		var confirm func(string) bool
 		if dryRun {
 			fmt.Println("Dry run enabled: No changes will be made.")
 		} else {
+			confirm = confirmWithSummary("WARNING: Your remote spotify playlist will be replaced")
+		}
+
+		ctx := context.Background()
+		client, _ := setup(ctx)
+		var repository interfaces.Repository
+		var settings models.Settings
+		if dryRun {
+			readOnly := repositories.NewReadOnlyRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT, true)
+			settings = fetchSettings(readOnly)
+			repository = readOnly
+		} else {
+			real := repositories.NewRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT)
+			settings = fetchSettings(real)
+			repository = real
+		}
+		service := services.NewService(repository)
+		service.SetDeleteLimit(deleteLimitFromFlags(cmd))
+		// ライブラリはpull --libraryで扱う設定にした場合だけ反映する
+		service.SetLibrary(settings.Library)
+		if interactive {
+			service.SetPrompt(askForInput)
+		}
+		if err := service.OverwritePlaylists(dryRun, confirm); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [plan file]",
+	Short: "Execute a plan saved by 'overwrite --plan'",
+	Long: `Execute a plan saved by 'overwrite --plan'.
+If a playlist in the plan was changed on your spotify account after the plan was made, nothing is executed`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		client, _ := setup(ctx)
+		repository := repositories.NewRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT)
+		service := services.NewService(repository)
+		service.SetDeleteLimit(deleteLimitFromFlags(cmd))
+		confirm := confirmWithSummary("WARNING: Your remote spotify playlist will be replaced")
+		if err := service.ApplyPlan(args[0], confirm); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [run id]",
+	Short: "Revert the changes made on your spotify account by a run",
+	Long: `Revert the changes made on your spotify account by a run.
+If run id is omitted, the last run that is not an undo and has not been reverted yet is reverted.
+Use --list to show run ids`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		list, _ := cmd.Flags().GetBool("list")
+		ctx := context.Background()
+		client, _ := setup(ctx)
+		repository := repositories.NewRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT)
+		service := services.NewService(repository)
+		if list {
+			if err := service.ListRuns(); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+
+		if !askForConfirmation("WARNING: Your remote spotify playlist will be reverted") {
+			return
+		}
+		runId := ""
+		if len(args) > 0 {
+			runId = args[0]
+		}
+		if err := service.Undo(runId); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the states of your spotify account saved by pull and overwrite",
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved states",
+	Run: func(cmd *cobra.Command, args []string) {
+		repository := repositories.NewRepository(nil, context.Background(), SPOTIFY_PLAYLIST_ROOT)
+		service := services.NewService(repository)
+		if err := service.ListHistory(); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show [history id]",
+	Short: "Print the playlists and songs of a saved state",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repository := repositories.NewRepository(nil, context.Background(), SPOTIFY_PLAYLIST_ROOT)
+		service := services.NewService(repository)
+		if err := service.ShowHistory(args[0]); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of song search results",
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete the cached search results so that all songs are searched again",
+	Run: func(cmd *cobra.Command, args []string) {
+		repository := repositories.NewRepository(nil, context.Background(), SPOTIFY_PLAYLIST_ROOT)
+		if err := repository.ClearSearchCache(); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the number of cached search results",
+	Run: func(cmd *cobra.Command, args []string) {
+		repository := repositories.NewRepository(nil, context.Background(), SPOTIFY_PLAYLIST_ROOT)
+		stats, err := repository.FetchSearchCacheStats()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println("found:    ", stats.Found)
+		fmt.Println("not found:", stats.NotFound)
+		fmt.Println("expired:  ", stats.Expired)
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [playlist name]",
+	Short: "Write local playlists as m3u8 and xspf files for other players",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		formats, _ := cmd.Flags().GetStringSlice("format")
+		playlistName := ""
+		if len(args) > 0 {
+			playlistName = args[0]
+		}
+		repository := repositories.NewRepository(nil, context.Background(), SPOTIFY_PLAYLIST_ROOT)
+		service := services.NewService(repository)
+		if err := service.ExportPlaylists(out, formats, playlistName); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [history id] [playlist name]",
+	Short: "Restore playlists from a saved state",
+	Long: `Restore playlists from a saved state.
+Local directories are restored by default. Use --remote to restore playlists on your spotify account.
+If playlist name is omitted, all playlists are restored`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		remote, _ := cmd.Flags().GetBool("remote")
+		if remote {
 			if !askForConfirmation("WARNING: Your remote spotify playlist will be replaced") {
 				return
 			}
+		} else {
+			if !askForConfirmation("WARNING: Your local playlist directories will be replaced") {
+				return
+			}
+		}
+
+		ctx := context.Background()
+		client, _ := setup(ctx)
+		repository := repositories.NewRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT)
+		service := services.NewService(repository)
+		playlistName := ""
+		if len(args) > 1 {
+			playlistName = args[1]
+		}
+		if err := service.RestoreHistory(args[0], playlistName, remote); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Merge changes on both your local files and your spotify account since the last pull",
+	Long: `Merge changes on both your local files and your spotify account since the last pull.
+Local additions and removals are pushed, remote additions and removals are pulled.
+Playlists changed on both sides are reported as conflicts and left untouched`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		var confirm func(string) bool
+		if dryRun {
+			fmt.Println("Dry run enabled: No changes will be made.")
+		} else {
+			confirm = confirmWithSummary("WARNING: Your remote spotify playlist and local files will be changed")
 		}
 
 		ctx := context.Background()
@@ -120,7 +389,8 @@ var overwriteCmd = &cobra.Command{
 			repository = repositories.NewRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT)
 		}
 		service := services.NewService(repository)
-		if err := service.OverwritePlaylists(); err != nil {
+		service.SetDeleteLimit(deleteLimitFromFlags(cmd))
+		if err := service.SyncPlaylists(dryRun, confirm); err != nil {
 			log.Fatalln(err)
 		}
 	},
@@ -129,14 +399,27 @@ var overwriteCmd = &cobra.Command{
 var compareCmd = &cobra.Command{
 	Use:   "compare",
 	Short: "Compare local playlists with your spotify account and print the difference",
+	Long: `Compare local playlists with your spotify account and print the difference.
+The output format is one of text, json and diff.
+Exit with status 2 if there is any difference and 1 on errors`,
 	Run: func(cmd *cobra.Command, args []string) {
+		full, _ := cmd.Flags().GetBool("full")
+		format, _ := cmd.Flags().GetString("format")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+
 		ctx := context.Background()
 		client, _ := setup(ctx)
 		repository := repositories.NewReadOnlyRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT, false)
+		repository.SetFullFetch(full)
+		repository.SetConcurrency(concurrency)
 		service := services.NewService(repository)
-		if err := service.OverwritePlaylists(); err != nil {
+		changed, err := service.ComparePlaylists(format, os.Stdout)
+		if err != nil {
 			log.Fatalln(err)
 		}
+		if changed {
+			os.Exit(EXIT_CODE_DIFFERENCE)
+		}
 	},
 }
 
@@ -179,22 +462,71 @@ var versionCmd = &cobra.Command{
 
 var pullCmd = &cobra.Command{
 	Use:   "pull",
-	Short: "Download playlists that your spotify account has. All of your existing local playlists will be overwritten",
+	Short: "Download playlists that your spotify account has",
 	Long: `Download playlists that your spotify account has.
-All of your existing local playlists will be overwritten.
-If you have local-specific files, It will be remained`,
+If you have local changes since the last pull, pull is aborted.
+Use --merge to download remote changes keeping your local changes,
+or --force to overwrite all of your existing local playlists`,
 	Run: func(cmd *cobra.Command, args []string) {
+		full, _ := cmd.Flags().GetBool("full")
+		force, _ := cmd.Flags().GetBool("force")
+		merge, _ := cmd.Flags().GetBool("merge")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		relink, _ := cmd.Flags().GetBool("relink")
+		if force && merge {
+			log.Fatalln("--force and --merge cannot be used together")
+		}
+		if relink && merge {
+			log.Fatalln("--relink and --merge cannot be used together")
+		}
+
 		ctx := context.Background()
 		client, _ := setup(ctx)
 		repository := repositories.NewRepository(client, ctx, SPOTIFY_PLAYLIST_ROOT)
+		repository.SetFullFetch(full)
+		repository.SetConcurrency(concurrency)
+		settings, err := repository.FetchSettings()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		// 指定されたフラグだけを保存された設定に上書きする
+		if cmd.Flags().Changed("exclude-followed") {
+			settings.ExcludeFollowed, _ = cmd.Flags().GetBool("exclude-followed")
+		}
+		if cmd.Flags().Changed("library") {
+			settings.Library, _ = cmd.Flags().GetBool("library")
+		}
+		if cmd.Flags().Changed("liked-songs") {
+			settings.LikedSongs, _ = cmd.Flags().GetBool("liked-songs")
+		}
+		// 指定された設定はpullが成功した場合だけ保存する
+		repository.SetSettings(settings)
 		model := services.NewService(repository)
-		if err := model.PullPlaylists(); err != nil {
+		model.SetLibrary(settings.Library)
+		model.SetRelink(relink)
+		if err := model.PullPlaylists(force, merge); err != nil {
 			log.Fatalln(err)
 		}
+		if cmd.Flags().Changed("exclude-followed") || cmd.Flags().Changed("library") || cmd.Flags().Changed("liked-songs") {
+			if err := repository.SaveSettings(settings); err != nil {
+				log.Fatalln(err)
+			}
+		}
 	},
 }
 
-func setup(ctx context.Context) (*spotify.Client, logins.Login) {
+// 保存された設定を読む
+func fetchSettings(repository interface {
+	FetchSettings() (models.Settings, error)
+}) models.Settings {
+	settings, err := repository.FetchSettings()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return settings
+}
+
+func setup(ctx context.Context) (*http.Client, logins.Login) {
 	login, isOk := logins.NewFromCache(ctx)
 
 	// APIの各キーが登録されていない場合
@@ -264,3 +596,34 @@ func askForConfirmation(s string) bool {
 		}
 	}
 }
+
+func askForInput(s string) string {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("%s: ", s)
+
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatal(err)
+	}
+	return strings.TrimSpace(response)
+}
+
+func addDeleteLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("allow-mass-delete", false, "Delete playlists and songs even if they exceed the limits")
+	cmd.Flags().Int("max-delete-playlists", services.DEFAULT_DELETE_LIMIT.MaxPlaylists, "Maximum number of playlists deleted at once")
+	cmd.Flags().Int("max-delete-percent", services.DEFAULT_DELETE_LIMIT.MaxTrackPercent, "Maximum percentage of songs deleted from a playlist at once")
+}
+
+func deleteLimitFromFlags(cmd *cobra.Command) services.DeleteLimit {
+	allow, _ := cmd.Flags().GetBool("allow-mass-delete")
+	maxPlaylists, _ := cmd.Flags().GetInt("max-delete-playlists")
+	maxPercent, _ := cmd.Flags().GetInt("max-delete-percent")
+	return services.DeleteLimit{MaxPlaylists: maxPlaylists, MaxTrackPercent: maxPercent, AllowMassDelete: allow}
+}
+
+// 削除される内容を表示してから実行してよいか確認する
+func confirmWithSummary(warning string) func(summary string) bool {
+	return func(summary string) bool {
+		return askForConfirmation(summary + warning)
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/zmb3/spotify/v2"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"golang.org/x/oauth2"
 )
@@ -32,7 +31,7 @@ func (l *Login) IsLogin() bool {
 func GetAuth(redirectURI, clientID, clientSecret string) *spotifyauth.Authenticator {
 	auth := spotifyauth.New(
 		spotifyauth.WithRedirectURL(redirectURI),
-		spotifyauth.WithScopes(spotifyauth.ScopePlaylistReadPrivate, spotifyauth.ScopePlaylistReadCollaborative, spotifyauth.ScopePlaylistModifyPrivate, spotifyauth.ScopePlaylistModifyPublic),
+		spotifyauth.WithScopes(spotifyauth.ScopePlaylistReadPrivate, spotifyauth.ScopePlaylistReadCollaborative, spotifyauth.ScopePlaylistModifyPrivate, spotifyauth.ScopePlaylistModifyPublic, spotifyauth.ScopeImageUpload, spotifyauth.ScopeUserLibraryRead, spotifyauth.ScopeUserLibraryModify, spotifyauth.ScopeUserFollowRead, spotifyauth.ScopeUserFollowModify),
 		spotifyauth.WithClientID(clientID),
 		spotifyauth.WithClientSecret(clientSecret),
 	)
@@ -122,11 +121,13 @@ func (l *Login) Login() error {
 	return nil
 }
 
-func (l *Login) GetClient() *spotify.Client {
+// 認証済みでレート制限されたhttp.Clientを返す
+// spotifyライブラリが対応していないAPIもこのクライアントで呼び出す
+func (l *Login) GetClient() *http.Client {
 	auth := GetAuth(l.redirectURI, l.clientId, l.clientSecret)
 	httpClient := auth.Client(l.ctx, l.token)
-	client := spotify.New(httpClient)
-	return client
+	httpClient.Transport = newRateLimitedTransport(httpClient.Transport)
+	return httpClient
 }
 
 type Cache struct {
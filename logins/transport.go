@@ -0,0 +1,200 @@
+package logins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 1秒あたりに送るリクエストの数
+const RATE_LIMIT_PER_SECOND = 5
+
+// 連続して送ることのできるリクエストの数
+const RATE_LIMIT_BURST = 10
+
+// 429やサーバーエラーのときに再試行する回数
+const MAX_RETRIES = 5
+
+// 再試行までの待機時間の初期値 (再試行ごとに倍にする)
+const RETRY_BACKOFF = time.Second
+
+// Retry-Afterがこれより長い場合は待たずにエラーを返す
+const MAX_RETRY_AFTER = 5 * time.Minute
+
+// トークンバケットでリクエストの間隔を空け、429のときはRetry-Afterだけ待ってから再試行する
+// 1つのクライアントの全てのリクエストで共有する
+type rateLimitedTransport struct {
+	base http.RoundTripper
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	// 429を受け取った後、全てのリクエストをこの時刻まで待たせる
+	blockedUntil time.Time
+
+	rate    float64
+	burst   float64
+	backoff time.Duration
+}
+
+func newRateLimitedTransport(base http.RoundTripper) *rateLimitedTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitedTransport{
+		base:    base,
+		tokens:  RATE_LIMIT_BURST,
+		last:    time.Now(),
+		rate:    RATE_LIMIT_PER_SECOND,
+		burst:   RATE_LIMIT_BURST,
+		backoff: RETRY_BACKOFF,
+	}
+}
+
+// トークンを1つ取り出すまでに待つ時間を返す
+func (t *rateLimitedTransport) reserve() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+
+	var wait time.Duration
+	if t.tokens < 1 {
+		wait = time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+	}
+	if blocked := t.blockedUntil.Sub(now); blocked > wait {
+		wait = blocked
+	}
+	// 待っている間に溜まる分も含めて先に取り出す
+	t.tokens--
+	return wait
+}
+
+func (t *rateLimitedTransport) block(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(d); until.After(t.blockedUntil) {
+		t.blockedUntil = until
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := t.backoff
+	for attempt := 0; ; attempt++ {
+		if err := sleepContext(req.Context(), t.reserve()); err != nil {
+			return nil, err
+		}
+
+		r, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+		res, err := t.base.RoundTrip(r)
+		if attempt >= MAX_RETRIES {
+			return res, err
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			// 送信できたかわからないので、冪等なリクエストだけ再試行する
+			if !isIdempotent(req) {
+				return nil, err
+			}
+			wait = backoff
+		case res.StatusCode == http.StatusTooManyRequests:
+			// 429のリクエストは処理されていないので、どのメソッドでも再試行する
+			retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"))
+			if !ok {
+				retryAfter = backoff
+			}
+			if retryAfter > MAX_RETRY_AFTER {
+				return res, nil
+			}
+			wait = retryAfter
+			t.block(wait)
+			fmt.Fprintf(os.Stderr, "rate limited by spotify. retrying after %s\n", wait)
+		case res.StatusCode >= 500 && isIdempotent(req):
+			wait = backoff
+		default:
+			return res, nil
+		}
+
+		if req.Body != nil && req.GetBody == nil {
+			// bodyを送り直せない場合は再試行しない
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// 再試行するときはbodyを読み直したリクエストを返す
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// 曲の並べ替えや位置を指定した削除は、同じリクエストを2回送ると結果が変わる
+// そのためPUTとDELETEも冪等として扱わない
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// Retry-Afterは秒数かHTTP-dateで指定される
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(v); err == nil {
+		d := time.Until(date)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
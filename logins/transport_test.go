@@ -0,0 +1,92 @@
+package logins
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// statusesの順にステータスを返し、受け取ったbodyを記録するサーバー
+func newTestServer(statuses []int, bodies *[]string) *httptest.Server {
+	count := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		*bodies = append(*bodies, string(b))
+		status := statuses[count]
+		count++
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}))
+}
+
+func Test_rateLimitedTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		expected int
+		requests int
+	}{
+		{"retry after 429", http.MethodGet, []int{429, 200}, 200, 2},
+		{"retry post after 429", http.MethodPost, []int{429, 429, 201}, 201, 3},
+		{"retry get after server error", http.MethodGet, []int{503, 200}, 200, 2},
+		{"do not retry post after server error", http.MethodPost, []int{503, 200}, 503, 1},
+		{"do not retry client error", http.MethodGet, []int{404, 200}, 404, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies := []string{}
+			server := newTestServer(tt.statuses, &bodies)
+			defer server.Close()
+
+			transport := newRateLimitedTransport(nil)
+			transport.backoff = time.Millisecond
+			client := &http.Client{Transport: transport}
+
+			req, err := http.NewRequest(tt.method, server.URL, strings.NewReader("body"))
+			assert.NoError(t, err)
+			res, err := client.Do(req)
+			assert.NoError(t, err)
+			res.Body.Close()
+
+			assert.Equal(t, tt.expected, res.StatusCode)
+			assert.Len(t, bodies, tt.requests)
+			for _, b := range bodies {
+				assert.Equal(t, "body", b)
+			}
+		})
+	}
+}
+
+func Test_rateLimitedTransport_reserve(t *testing.T) {
+	transport := newRateLimitedTransport(nil)
+	for i := 0; i < RATE_LIMIT_BURST; i++ {
+		assert.Zero(t, transport.reserve())
+	}
+	// バケットが空になったら待つ
+	assert.Greater(t, transport.reserve(), time.Duration(0))
+
+	transport = newRateLimitedTransport(nil)
+	transport.block(time.Minute)
+	assert.Greater(t, transport.reserve(), 59*time.Second)
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	d, ok := parseRetryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	d, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Greater(t, d, 59*time.Minute)
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+}
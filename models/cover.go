@@ -0,0 +1,33 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// プレイリストのカバー画像のファイル名 (プレイリスト用ディレクトリ内に置く)
+const COVER_FILE_NAME = "cover.jpg"
+
+// Spotifyはbase64エンコード後で256KBまでのJPEGを受け付ける
+const MAX_COVER_SIZE = 256 * 1024 / 4 * 3
+
+func CoverHash(img []byte) string {
+	sum := sha256.Sum256(img)
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidateCover(img []byte) error {
+	if len(img) == 0 {
+		return errors.New("cover image is empty")
+	}
+	if !bytes.HasPrefix(img, []byte{0xff, 0xd8, 0xff}) {
+		return errors.New("cover image must be JPEG")
+	}
+	if len(img) > MAX_COVER_SIZE {
+		return fmt.Errorf("cover image is too large: %d bytes (max %d bytes)", len(img), MAX_COVER_SIZE)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import "testing"
+
+func TestValidateCover(t *testing.T) {
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe0}
+	if err := ValidateCover(jpeg); err != nil {
+		t.Error(err)
+	}
+
+	png := []byte{0x89, 0x50, 0x4e, 0x47}
+	if err := ValidateCover(png); err == nil {
+		t.Error("png must be rejected")
+	}
+
+	large := make([]byte, MAX_COVER_SIZE+1)
+	copy(large, jpeg)
+	if err := ValidateCover(large); err == nil {
+		t.Error("large image must be rejected")
+	}
+
+	if err := ValidateCover(nil); err == nil {
+		t.Error("empty image must be rejected")
+	}
+}
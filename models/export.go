@@ -0,0 +1,136 @@
+package models
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 書き出せるプレイリストファイルの形式
+const (
+	EXPORT_FORMAT_M3U8 = "m3u8"
+	EXPORT_FORMAT_XSPF = "xspf"
+)
+
+// Spotifyのクライアントが無くても開けるURL
+// idが無い曲はSpotifyの検索ページ、ローカルファイルはそのURIを返す
+func (p TrackContent) Location() string {
+	if p.IsLocalFile() {
+		return p.Uri
+	}
+	if p.Id == "" {
+		query := strings.TrimSpace(p.Name + " " + p.Artist)
+		return "https://open.spotify.com/search/" + url.PathEscape(query)
+	}
+	if p.IsEpisode() {
+		return "https://open.spotify.com/episode/" + p.Id
+	}
+	return "https://open.spotify.com/track/" + p.Id
+}
+
+// 曲はアーティスト名、エピソードは番組名を返す
+func (p TrackContent) Creator() string {
+	if p.IsEpisode() {
+		return p.Show
+	}
+	return p.Artist
+}
+
+// 書き出すときのプレイリスト名
+// まだpullしていないプレイリストにはnameが無いのでディレクトリ名を使う
+func (p PlaylistContent) ExportName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.DirName
+}
+
+// #EXTINFの再生時間(秒)を返す
+// 不明な場合は-1
+func extinfDuration(seconds string) int {
+	ms, ok := ParseMilliseconds(seconds)
+	if !ok {
+		return -1
+	}
+	return (ms + 500) / 1000
+}
+
+// 改行を含むとM3Uの行が壊れるので空白にする
+func m3uText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func ExportM3u8(playlist PlaylistContent, tracks []TrackContent) string {
+	sb := strings.Builder{}
+	sb.WriteString("#EXTM3U\n")
+	sb.WriteString("#PLAYLIST:" + m3uText(playlist.ExportName()) + "\n")
+	for _, t := range tracks {
+		title := m3uText(t.Name)
+		if creator := m3uText(t.Creator()); creator != "" {
+			title = creator + " - " + title
+		}
+		sb.WriteString(fmt.Sprintf("#EXTINF:%d,%s\n", extinfDuration(t.Seconds), title))
+		if t.Album != "" {
+			sb.WriteString("#EXTALB:" + m3uText(t.Album) + "\n")
+		}
+		sb.WriteString(t.Location() + "\n")
+	}
+	return sb.String()
+}
+
+type xspfPlaylist struct {
+	XMLName    xml.Name    `xml:"playlist"`
+	Version    string      `xml:"version,attr"`
+	Xmlns      string      `xml:"xmlns,attr"`
+	Title      string      `xml:"title,omitempty"`
+	Annotation string      `xml:"annotation,omitempty"`
+	Tracks     []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location    string   `xml:"location"`
+	Identifiers []string `xml:"identifier"`
+	Title       string   `xml:"title,omitempty"`
+	Creator     string   `xml:"creator,omitempty"`
+	Album       string   `xml:"album,omitempty"`
+	Duration    string   `xml:"duration,omitempty"`
+}
+
+// identifierにはSpotifyのURIとISRCを入れる
+func ExportXspf(playlist PlaylistContent, tracks []TrackContent) (string, error) {
+	res := xspfPlaylist{
+		Version:    "1",
+		Xmlns:      "http://xspf.org/ns/0/",
+		Title:      playlist.ExportName(),
+		Annotation: playlist.Description,
+		Tracks:     []xspfTrack{},
+	}
+	for _, t := range tracks {
+		identifiers := []string{}
+		if t.Id != "" {
+			identifiers = append(identifiers, string(t.ItemUri()))
+		}
+		if t.Isrc != "" {
+			identifiers = append(identifiers, "urn:isrc:"+t.Isrc)
+		}
+		duration := ""
+		if ms, ok := ParseMilliseconds(t.Seconds); ok {
+			duration = strconv.Itoa(ms)
+		}
+		res.Tracks = append(res.Tracks, xspfTrack{
+			Location:    t.Location(),
+			Identifiers: identifiers,
+			Title:       t.Name,
+			Creator:     t.Creator(),
+			Album:       t.Album,
+			Duration:    duration,
+		})
+	}
+	b, err := xml.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to create xspf of %s: %w", playlist.ExportName(), err)
+	}
+	return xml.Header + string(b) + "\n", nil
+}
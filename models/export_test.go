@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+)
+
+var exportPlaylist = PlaylistContent{Name: "test playlist", DirName: "test playlist", Description: "a & b"}
+
+var exportTracks = []TrackContent{
+	{Id: "4B0JvthVoAAuygILe3n4Bs", Name: "What Do You Mean?", Artist: "Justin Bieber", Album: "Purpose (Deluxe)", Seconds: "205680", Isrc: "USUM71511919"},
+	{Id: "512ojhOuo1ktJprKbVcKyQ", Show: "The Daily", Name: "The Sunday Read", Seconds: "2700000", Type: TRACK_TYPE_EPISODE},
+	{Name: "new song", Artist: "someone"},
+	// 手で書いた秒数
+	{Name: "old song", Artist: "someone", Seconds: "205"},
+}
+
+func Test_ExportM3u8(t *testing.T) {
+	actual := ExportM3u8(exportPlaylist, exportTracks)
+	expected :=
+		`#EXTM3U
+#PLAYLIST:test playlist
+#EXTINF:206,Justin Bieber - What Do You Mean?
+#EXTALB:Purpose (Deluxe)
+https://open.spotify.com/track/4B0JvthVoAAuygILe3n4Bs
+#EXTINF:2700,The Daily - The Sunday Read
+https://open.spotify.com/episode/512ojhOuo1ktJprKbVcKyQ
+#EXTINF:-1,someone - new song
+https://open.spotify.com/search/new%20song%20someone
+#EXTINF:205,someone - old song
+https://open.spotify.com/search/old%20song%20someone
+`
+	if expected != actual {
+		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
+	}
+}
+
+func Test_ExportXspf(t *testing.T) {
+	actual, err := ExportXspf(exportPlaylist, exportTracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected :=
+		`<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>test playlist</title>
+  <annotation>a &amp; b</annotation>
+  <trackList>
+    <track>
+      <location>https://open.spotify.com/track/4B0JvthVoAAuygILe3n4Bs</location>
+      <identifier>spotify:track:4B0JvthVoAAuygILe3n4Bs</identifier>
+      <identifier>urn:isrc:USUM71511919</identifier>
+      <title>What Do You Mean?</title>
+      <creator>Justin Bieber</creator>
+      <album>Purpose (Deluxe)</album>
+      <duration>205680</duration>
+    </track>
+    <track>
+      <location>https://open.spotify.com/episode/512ojhOuo1ktJprKbVcKyQ</location>
+      <identifier>spotify:episode:512ojhOuo1ktJprKbVcKyQ</identifier>
+      <title>The Sunday Read</title>
+      <creator>The Daily</creator>
+      <duration>2700000</duration>
+    </track>
+    <track>
+      <location>https://open.spotify.com/search/new%20song%20someone</location>
+      <title>new song</title>
+      <creator>someone</creator>
+    </track>
+    <track>
+      <location>https://open.spotify.com/search/old%20song%20someone</location>
+      <title>old song</title>
+      <creator>someone</creator>
+      <duration>205000</duration>
+    </track>
+  </trackList>
+</playlist>
+`
+	if expected != actual {
+		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
+	}
+}
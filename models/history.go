@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ある時点のリモートのプレイリストと曲の状態
+type HistorySnapshot struct {
+	Time      time.Time         `json:"time"`
+	Playlists []HistoryPlaylist `json:"playlists"`
+}
+
+type HistoryPlaylist struct {
+	Playlist PlaylistContent `json:"playlist"`
+	Tracks   []TrackContent  `json:"tracks"`
+}
+
+// 履歴を指定するためのid
+func (h HistorySnapshot) Id() string {
+	return h.Time.Format(HISTORY_ID_FORMAT)
+}
+
+// 続けて保存しても重複しないようにミリ秒まで含める
+const HISTORY_ID_FORMAT = "20060102-150405.000"
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// リモートに対して行った変更の種類
+const (
+	JOURNAL_CREATE_PLAYLIST  = "create_playlist"
+	JOURNAL_REMOVE_PLAYLIST  = "remove_playlist"
+	JOURNAL_FOLLOW_PLAYLIST  = "follow_playlist"
+	JOURNAL_ADD_TRACKS       = "add_tracks"
+	JOURNAL_REMOVE_TRACKS    = "remove_tracks"
+	JOURNAL_REPLACE_TRACKS   = "replace_tracks"
+	JOURNAL_REORDER_TRACK    = "reorder_track"
+	JOURNAL_RENAME_PLAYLIST  = "rename_playlist"
+	JOURNAL_CHANGE_DETAIL    = "change_detail"
+	JOURNAL_UPLOAD_COVER     = "upload_cover"
+	JOURNAL_SAVE_ALBUMS      = "save_albums"
+	JOURNAL_REMOVE_ALBUMS    = "remove_albums"
+	JOURNAL_FOLLOW_ARTISTS   = "follow_artists"
+	JOURNAL_UNFOLLOW_ARTISTS = "unfollow_artists"
+)
+
+// リモートに対して行った1回分の変更
+// undoで元に戻すために必要な値を持つ
+type JournalEntry struct {
+	// 同じコマンドの実行で行われた変更には同じRunIdが付く
+	RunId string `json:"run_id"`
+	// undoで行われた変更の場合は、元に戻した実行のid
+	UndoneRunId string    `json:"undone_run_id,omitempty"`
+	Time        time.Time `json:"time"`
+	Operation   string    `json:"operation"`
+	PlaylistId  string    `json:"playlist_id"`
+	// ログ表示用
+	PlaylistName string `json:"playlist_name"`
+	// 追加/削除した曲 (削除した曲はpositionを持つ)
+	Tracks []TrackContent `json:"tracks,omitempty"`
+	// 曲の移動
+	RangeStart   int `json:"range_start,omitempty"`
+	InsertBefore int `json:"insert_before,omitempty"`
+	// 変更前の値
+	OldName   string          `json:"old_name,omitempty"`
+	OldDetail *PlaylistDetail `json:"old_detail,omitempty"`
+	OldTracks []TrackContent  `json:"old_tracks,omitempty"`
+	// プレイリストを削除した時の公開設定
+	Public bool `json:"public,omitempty"`
+	// 保存/削除したアルバムとフォロー/フォロー解除したアーティスト
+	Albums  []AlbumContent  `json:"albums,omitempty"`
+	Artists []ArtistContent `json:"artists,omitempty"`
+}
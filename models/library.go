@@ -0,0 +1,91 @@
+package models
+
+import "github.com/zmb3/spotify/v2"
+
+// 保存したアルバムとフォローしたアーティストを置くディレクトリ
+// プレイリスト用ディレクトリとしては扱わない
+const (
+	ALBUMS_DIR_NAME  = "_albums"
+	ARTISTS_DIR_NAME = "_artists"
+)
+
+// ライブラリに保存したアルバム
+type AlbumContent struct {
+	Id          string `title:"id" json:"id"`
+	Name        string `title:"name" json:"name"`
+	Artist      string `title:"artist" json:"artist"`
+	ReleaseDate string `title:"release_date" json:"release_date"`
+	Upc         string `title:"upc" json:"upc"`
+	FileName    string `title:"file_name" json:"file_name"`
+}
+
+// フォローしたアーティスト
+type ArtistContent struct {
+	Id       string `title:"id" json:"id"`
+	Name     string `title:"name" json:"name"`
+	FileName string `title:"file_name" json:"file_name"`
+}
+
+// pull時点のリモートのライブラリの状態
+// ローカルで追加/削除されたものを調べるために使う
+type LibrarySnapshot struct {
+	Albums  []AlbumContent  `json:"albums"`
+	Artists []ArtistContent `json:"artists"`
+}
+
+func IsLibraryDirName(dirName string) bool {
+	return dirName == ALBUMS_DIR_NAME || dirName == ARTISTS_DIR_NAME
+}
+
+func UnmarshalAlbumContent(text string) AlbumContent {
+	result := AlbumContent{}
+	unmarshalText(text, &result)
+	return result
+}
+
+func UnmarshalArtistContent(text string) ArtistContent {
+	result := ArtistContent{}
+	unmarshalText(text, &result)
+	return result
+}
+
+func (p AlbumContent) Marshal() string {
+	return marshalText(p)
+}
+
+func (p ArtistContent) Marshal() string {
+	return marshalText(p)
+}
+
+func (p AlbumContent) SearchQuery() string {
+	if p.Upc != "" {
+		return "upc:" + p.Upc
+	}
+	query := "album:" + p.Name
+	if p.Artist != "" {
+		query += " artist:" + p.Artist
+	}
+	return query
+}
+
+func FullAlbumToContent(album *spotify.FullAlbum) AlbumContent {
+	content := SimpleAlbumToContent(&album.SimpleAlbum)
+	content.Upc = album.ExternalIDs["upc"]
+	return content
+}
+
+func SimpleAlbumToContent(album *spotify.SimpleAlbum) AlbumContent {
+	return AlbumContent{
+		Id:          album.ID.String(),
+		Name:        album.Name,
+		Artist:      joinArtistText(album.Artists),
+		ReleaseDate: album.ReleaseDate,
+	}
+}
+
+func FullArtistToContent(artist *spotify.FullArtist) ArtistContent {
+	return ArtistContent{
+		Id:   artist.ID.String(),
+		Name: artist.Name,
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+)
+
+func Test_AlbumContent_Marshal(t *testing.T) {
+	ac := AlbumContent{
+		Id:          "123",
+		Name:        "test album",
+		Artist:      "test artist",
+		ReleaseDate: "2015-11-13",
+		Upc:         "00602547682158",
+		FileName:    "test album.txt",
+	}
+	actual := ac.Marshal()
+	expected :=
+		`id 123
+name test album
+artist test artist
+release_date 2015-11-13
+upc 00602547682158
+file_name test album.txt
+`
+	if expected != actual {
+		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
+	}
+	if unmarshaled := UnmarshalAlbumContent(actual); unmarshaled != ac {
+		t.Errorf("\nactual:\n%+v \nexpected:\n%+v", unmarshaled, ac)
+	}
+}
+
+func TestAlbumSearchQuery(t *testing.T) {
+	tests := []struct {
+		album    AlbumContent
+		expected string
+	}{
+		{AlbumContent{Name: "Purpose", Artist: "Justin Bieber"}, "album:Purpose artist:Justin Bieber"},
+		{AlbumContent{Name: "Purpose"}, "album:Purpose"},
+		{AlbumContent{Name: "Purpose", Upc: "00602547682158"}, "upc:00602547682158"},
+	}
+	for _, tt := range tests {
+		if actual := tt.album.SearchQuery(); actual != tt.expected {
+			t.Errorf("actual: %s, expected: %s", actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+// お気に入りの曲 (Liked Songs) をプレイリストとして扱うための予約されたid
+// spotifyのidは英数字だけなので重複しない
+const LIKED_SONGS_ID = "liked_songs"
+
+const LIKED_SONGS_NAME = "Liked Songs"
+
+// snapshotIdにはお気に入りの曲が変わったかどうかを判定する値を渡す
+func NewLikedSongsContent(owner string, snapshotId string) PlaylistContent {
+	return PlaylistContent{
+		Id:            LIKED_SONGS_ID,
+		Name:          LIKED_SONGS_NAME,
+		Public:        "false",
+		Collaborative: "false",
+		Owner:         owner,
+		SnapshotId:    snapshotId,
+	}
+}
+
+// お気に入りの曲は曲の追加と削除だけができ、名前や順番などは変更できない
+func (p PlaylistContent) IsLikedSongs() bool {
+	return p.Id == LIKED_SONGS_ID
+}
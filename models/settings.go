@@ -0,0 +1,11 @@
+package models
+
+// pull以外のコマンドにも適用される設定
+type Settings struct {
+	// trueの場合は他のユーザーのプレイリストを扱わない
+	ExcludeFollowed bool `json:"exclude_followed"`
+	// trueの場合はpullで保存したアルバムとフォローしたアーティストもダウンロードする
+	Library bool `json:"library"`
+	// trueの場合はお気に入りの曲もプレイリストとして扱う
+	LikedSongs bool `json:"liked_songs"`
+}
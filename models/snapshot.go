@@ -0,0 +1,39 @@
+package models
+
+// pull時点のリモートのプレイリストの状態
+// 3-way mergeのbaseとして使う
+type PlaylistSnapshot struct {
+	Id         string         `json:"id"`
+	Name       string         `json:"name"`
+	DirName    string         `json:"dir_name"`
+	SnapshotId string         `json:"snapshot_id"`
+	Detail     PlaylistDetail `json:"detail"`
+	TrackIds   []string       `json:"track_ids"`
+	// 最後にpullした時のリモートのカバー画像のURL
+	CoverUrl string `json:"cover_url,omitempty"`
+}
+
+func NewPlaylistSnapshot(playlist PlaylistContent, tracks []TrackContent) PlaylistSnapshot {
+	trackIds := []string{}
+	for _, t := range tracks {
+		if t.Key() == "" {
+			continue
+		}
+		trackIds = append(trackIds, t.Key())
+	}
+	return PlaylistSnapshot{
+		Id:         playlist.Id,
+		Name:       playlist.Name,
+		DirName:    playlist.DirName,
+		SnapshotId: playlist.SnapshotId,
+		Detail:     playlist.Detail(),
+		TrackIds:   trackIds,
+		CoverUrl:   playlist.CoverUrl,
+	}
+}
+
+// 最後にpullした時からリモートのカバー画像のURLが変わったかどうか
+// URLを記録していない場合は変わっていないものとみなす
+func (s PlaylistSnapshot) IsCoverUrlChanged(coverUrl string) bool {
+	return s.CoverUrl != "" && s.CoverUrl != coverUrl
+}
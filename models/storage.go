@@ -8,54 +8,214 @@ import (
 	"github.com/zmb3/spotify/v2"
 )
 
+// ポッドキャストのエピソードを表すtype
+const TRACK_TYPE_EPISODE = "episode"
+
+// 曲とポッドキャストのエピソードの両方を表す
 type TrackContent struct {
-	Id       string `title:"id"`
-	Name     string `title:"name"`
-	Artist   string `title:"artist"`
-	Album    string `title:"album"`
-	Seconds  string `title:"seconds"`
-	Isrc     string `title:"isrc"`
-	FileName string `title:"file_name"`
+	Id string `title:"id" json:"id"`
+	// エピソードの番組名
+	Show   string `title:"show" json:"show,omitempty"`
+	Name   string `title:"name" json:"name"`
+	Artist string `title:"artist" json:"artist"`
+	Album  string `title:"album" json:"album"`
+	// エピソードの公開日
+	ReleaseDate string `title:"release_date" json:"release_date,omitempty"`
+	Seconds     string `title:"seconds" json:"seconds"`
+	Isrc        string `title:"isrc" json:"isrc"`
+	// 曲の場合は空、エピソードの場合はepisode
+	Type string `title:"type" json:"type,omitempty"`
+	// ローカルファイルのURI (spotify:local:...)
+	// ローカルファイルにはidが無いので、代わりにこれで区別する
+	Uri string `title:"uri" json:"uri,omitempty"`
+	// ローカルファイルの場合はtrue
+	IsLocal string `title:"is_local" json:"is_local,omitempty"`
+	// ユーザーの国で再生できない場合はfalse
+	IsPlayable string `title:"is_playable" json:"is_playable,omitempty"`
+	// プレイリスト内での順番 (1始まり)
+	Position string `title:"position" json:"position"`
+	FileName string `title:"file_name" json:"file_name"`
+	// titleタグが無いフィールドはtxtに書き出さない (jsonには書き出す)
+	// 再生できない曲の代わりにSpotifyが提示した、同じ曲の再生できるid
+	PlayableId string `json:"playable_id,omitempty"`
 }
 
 type PlaylistContent struct {
-	Id      string `title:"id"`
-	Name    string `title:"name"`
-	DirName string `title:"dir_name"`
+	Id            string `title:"id" json:"id"`
+	Name          string `title:"name" json:"name"`
+	DirName       string `title:"dir_name" json:"dir_name"`
+	Description   string `title:"description" json:"description"`
+	Public        string `title:"public" json:"public"`
+	Collaborative string `title:"collaborative" json:"collaborative"`
+	Owner         string `title:"owner" json:"owner"`
+	SnapshotId    string `title:"snapshot_id" json:"snapshot_id"`
+	// 最後に同期したcover.jpgのハッシュ
+	CoverHash string `title:"cover_hash" json:"cover_hash"`
+	// titleタグが無いフィールドはtxtに書き出さない (jsonには書き出す)
+	// リモートのカバー画像のURL (一定時間で無効になる)
+	CoverUrl string `json:"cover_url,omitempty"`
+	// ローカルでディレクトリ名が変更された場合の変更前のディレクトリ名
+	OldDirName string `json:"old_dir_name,omitempty"`
+	// リモートでプレイリスト名が変更された場合の変更前のプレイリスト名
+	OldName string `json:"old_name,omitempty"`
+	// ローカルとリモートを比較した場合のリモートの編集可能なプロパティ
+	RemoteDetail *PlaylistDetail `json:"remote_detail,omitempty"`
+	// 他のユーザーが所有していて、共同編集もできないプレイリストの場合はtrue
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// プレイリストtxtで編集できるプロパティ
+type PlaylistDetail struct {
+	Description   string `json:"description"`
+	Public        string `json:"public"`
+	Collaborative string `json:"collaborative"`
+}
+
+func (p PlaylistContent) Detail() PlaylistDetail {
+	return PlaylistDetail{Description: p.Description, Public: p.Public, Collaborative: p.Collaborative}
+}
+
+func (p *PlaylistContent) SetDetail(detail PlaylistDetail) {
+	p.Description = detail.Description
+	p.Public = detail.Public
+	p.Collaborative = detail.Collaborative
+}
+
+// リモートと値が異なるプロパティのtitleを返す
+func (p PlaylistContent) ChangedDetails() []string {
+	if p.RemoteDetail == nil {
+		return nil
+	}
+	res := []string{}
+	if p.Description != p.RemoteDetail.Description {
+		res = append(res, "description")
+	}
+	if p.Public != p.RemoteDetail.Public {
+		res = append(res, "public")
+	}
+	if p.Collaborative != p.RemoteDetail.Collaborative {
+		res = append(res, "collaborative")
+	}
+	return res
 }
 
 func UnmarshalTrackContent(text string) TrackContent {
 	result := TrackContent{}
+	unmarshalText(text, &result)
+	return result
+}
 
-	text = strings.ReplaceAll(text, "\r\n", "\n")
-	entries := strings.Split(text, "\n")
-	ts := reflect.TypeOf(result)
-	vs := reflect.ValueOf(&result)
-	for _, e := range entries {
-		substring := strings.SplitN(e, " ", 2)
-		if len(substring) < 2 {
+func UnmarshalPlaylistContent(text string) PlaylistContent {
+	result := PlaylistContent{}
+	unmarshalText(text, &result)
+	return result
+}
+
+func (p PlaylistContent) Marshal() string {
+	result := "NOTE: Do not delete this file. Only description, public and collaborative can be edited.\n\n"
+	return result + marshalText(p)
+}
+
+// 曲とエピソードでそれぞれ使わないtitleは書き出さない
+// ローカルファイルと再生できない曲の情報は、その場合だけ書き出す
+func (p TrackContent) Marshal() string {
+	omit := []string{"show", "release_date", "type"}
+	if p.IsEpisode() {
+		omit = []string{"artist", "album", "isrc"}
+	}
+	if p.Uri == "" {
+		omit = append(omit, "uri")
+	}
+	if p.IsLocal == "" {
+		omit = append(omit, "is_local")
+	}
+	if p.IsPlayable == "" {
+		omit = append(omit, "is_playable")
+	}
+	return marshalText(p, omit...)
+}
+
+func (p TrackContent) IsEpisode() bool {
+	return p.Type == TRACK_TYPE_EPISODE
+}
+
+func (p TrackContent) IsLocalFile() bool {
+	return p.IsLocal == "true"
+}
+
+// ローカルとリモートの曲を対応付けるためのキー
+// idの無いローカルファイルはURIを使う
+func (p TrackContent) Key() string {
+	if p.Id == "" && p.IsLocalFile() {
+		return p.Uri
+	}
+	return p.Id
+}
+
+// secondsプロパティを再生時間 (ミリ秒) として読む
+// pullした曲にはミリ秒が入っているが、手で書いた秒数も使えるように小さい値は秒とみなす
+func ParseMilliseconds(v string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	if n < 10000 {
+		return n * 1000, true
+	}
+	return n, true
+}
+
+// secondsプロパティを再生時間 (秒) として読む
+func ParseSeconds(v string) (int, bool) {
+	ms, ok := ParseMilliseconds(v)
+	return ms / 1000, ok
+}
+
+// プレイリストに追加/削除するときに使うURI
+func (p TrackContent) ItemUri() spotify.URI {
+	if p.IsLocalFile() {
+		return spotify.URI(p.Uri)
+	}
+	if p.IsEpisode() {
+		return spotify.URI("spotify:episode:" + p.Id)
+	}
+	return spotify.URI("spotify:track:" + p.Id)
+}
+
+// titleタグのあるフィールドを "title 値" の行にする
+// omitに含まれるtitleは書き出さない
+func marshalText(v any, omit ...string) string {
+	ts := reflect.TypeOf(v)
+	vs := reflect.ValueOf(v)
+
+	result := ""
+	for i := 0; i < ts.NumField(); i++ {
+		titleValue := ts.Field(i).Tag.Get("title")
+		if titleValue == "" || containsString(omit, titleValue) {
 			continue
 		}
-		key := substring[0]
-		value := substring[1]
+		fieldValue := vs.Field(i).String()
+		result += titleValue + " " + fieldValue + "\n"
+	}
+	return result
+}
 
-		for i := 0; i < ts.NumField(); i++ {
-			t := ts.Field(i)
-			if t.Tag.Get("title") != key {
-				continue
-			}
-			vs.Elem().Field(i).SetString(value)
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
 	}
-	return result
+	return false
 }
-func UnmarshalPlaylistContent(text string) PlaylistContent {
-	result := PlaylistContent{}
 
+// "title 値" の行をtitleタグが一致するフィールドに設定する
+// resultは構造体のポインタ
+func unmarshalText(text string, result any) {
 	text = strings.ReplaceAll(text, "\r\n", "\n")
 	entries := strings.Split(text, "\n")
-	ts := reflect.TypeOf(result)
-	vs := reflect.ValueOf(&result)
+	vs := reflect.ValueOf(result).Elem()
+	ts := vs.Type()
 	for _, e := range entries {
 		substring := strings.SplitN(e, " ", 2)
 		if len(substring) < 2 {
@@ -69,36 +229,9 @@ func UnmarshalPlaylistContent(text string) PlaylistContent {
 			if t.Tag.Get("title") != key {
 				continue
 			}
-			vs.Elem().Field(i).SetString(value)
+			vs.Field(i).SetString(value)
 		}
 	}
-	return result
-}
-
-func (p PlaylistContent) Marshal() string {
-	ts := reflect.TypeOf(p)
-	vs := reflect.ValueOf(p)
-
-	result := "NOTE: Do not delete or edit this file.\n\n"
-	for i := 0; i < ts.NumField(); i++ {
-		titleValue := ts.Field(i).Tag.Get("title")
-		fieldValue := vs.Field(i).String()
-		result += titleValue + " " + fieldValue + "\n"
-	}
-	return result
-}
-
-func (p TrackContent) Marshal() string {
-	ts := reflect.TypeOf(p)
-	vs := reflect.ValueOf(p)
-
-	result := ""
-	for i := 0; i < ts.NumField(); i++ {
-		titleValue := ts.Field(i).Tag.Get("title")
-		fieldValue := vs.Field(i).String()
-		result += titleValue + " " + fieldValue + "\n"
-	}
-	return result
 }
 
 func (p TrackContent) SearchQuery() string {
@@ -121,8 +254,10 @@ func (p TrackContent) SearchQuery() string {
 	return strings.Join(chunk, DELIMITER)
 }
 
+// 国を指定して取得した場合、再生できない曲は同じ曲の再生できるものに置き換えられていることがある
+// その場合も、プレイリストに入っている元のidを使う
 func FullTrackToContent(track *spotify.FullTrack) TrackContent {
-	return TrackContent{
+	content := TrackContent{
 		Id:      track.ID.String(),
 		Name:    track.Name,
 		Artist:  joinArtistText(track.Artists),
@@ -130,10 +265,62 @@ func FullTrackToContent(track *spotify.FullTrack) TrackContent {
 		Seconds: strconv.Itoa(track.Duration),
 		Isrc:    track.ExternalIDs["isrc"],
 	}
+	if track.LinkedFrom != nil && track.LinkedFrom.ID != "" && track.LinkedFrom.ID != track.ID {
+		content.Id = track.LinkedFrom.ID.String()
+		content.PlayableId = track.ID.String()
+	}
+	if track.IsPlayable != nil && !*track.IsPlayable {
+		content.IsPlayable = "false"
+	}
+	return content
+}
+
+// ローカルファイルにはidが無いので、URIで区別する
+func LocalTrackToContent(track *spotify.FullTrack) TrackContent {
+	content := FullTrackToContent(track)
+	content.Id = ""
+	content.PlayableId = ""
+	content.Isrc = ""
+	content.Uri = string(track.URI)
+	content.IsLocal = "true"
+	return content
+}
+
+func EpisodeToContent(episode *spotify.EpisodePage) TrackContent {
+	return TrackContent{
+		Id:          episode.ID.String(),
+		Show:        episode.Show.Name,
+		Name:        episode.Name,
+		ReleaseDate: episode.ReleaseDate,
+		Seconds:     strconv.Itoa(episode.Duration_ms),
+		Type:        TRACK_TYPE_EPISODE,
+	}
 }
 
 func SimplePlaylistToContent(playlist spotify.SimplePlaylist) PlaylistContent {
-	return PlaylistContent{Id: playlist.ID.String(), Name: playlist.Name}
+	return PlaylistContent{
+		Id:            playlist.ID.String(),
+		Name:          playlist.Name,
+		Description:   playlist.Description,
+		Public:        strconv.FormatBool(playlist.IsPublic),
+		Collaborative: strconv.FormatBool(playlist.Collaborative),
+		Owner:         playlist.Owner.ID,
+		SnapshotId:    playlist.SnapshotID,
+		CoverUrl:      coverUrl(playlist.Images),
+	}
+}
+
+// 最も大きい画像のURLを返す
+func coverUrl(images []spotify.Image) string {
+	url := ""
+	maxWidth := -1
+	for _, img := range images {
+		if img.Width > maxWidth {
+			url = img.URL
+			maxWidth = img.Width
+		}
+	}
+	return url
 }
 
 func joinArtistText(artists []spotify.SimpleArtist) string {
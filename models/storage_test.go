@@ -1,7 +1,10 @@
 package models
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/zmb3/spotify/v2"
 )
 
 func Test_TrackContent_Marshal(t *testing.T) {
@@ -12,6 +15,7 @@ func Test_TrackContent_Marshal(t *testing.T) {
 		Album:    "test album",
 		Seconds:  "123",
 		Isrc:     "ABCDEFG",
+		Position: "1",
 		FileName: "test track.txt",
 	}
 	actual := tc.Marshal()
@@ -22,6 +26,7 @@ artist test artist
 album test album
 seconds 123
 isrc ABCDEFG
+position 1
 file_name test track.txt
 `
 	if expected != actual {
@@ -31,17 +36,29 @@ file_name test track.txt
 
 func Test_PlaylistContent_Marshal(t *testing.T) {
 	tc := PlaylistContent{
-		Id:      "123",
-		Name:    "test playlist name",
-		DirName: "test playlist name",
+		Id:            "123",
+		Name:          "test playlist name",
+		DirName:       "test playlist name",
+		Description:   "test description",
+		Public:        "false",
+		Collaborative: "false",
+		Owner:         "test owner",
+		SnapshotId:    "abc",
+		CoverHash:     "def",
 	}
 	actual := tc.Marshal()
 	expected :=
-		`NOTE: Do not delete or edit this file.
+		`NOTE: Do not delete this file. Only description, public and collaborative can be edited.
 
 id 123
 name test playlist name
 dir_name test playlist name
+description test description
+public false
+collaborative false
+owner test owner
+snapshot_id abc
+cover_hash def
 `
 	if expected != actual {
 		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
@@ -53,16 +70,20 @@ func Test_UnmarshalPlaylistContent(t *testing.T) {
 		`id 123
 name test playlist name
 dir_name test playlist name
+description test description
+public true
 `
 
 	actual := UnmarshalPlaylistContent(text)
 	expected := PlaylistContent{
-		Id:      "123",
-		Name:    "test playlist name",
-		DirName: "test playlist name",
+		Id:          "123",
+		Name:        "test playlist name",
+		DirName:     "test playlist name",
+		Description: "test description",
+		Public:      "true",
 	}
 	if expected != actual {
-		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
+		t.Errorf("\nactual:\n%+v \nexpected:\n%+v", actual, expected)
 	}
 }
 
@@ -74,6 +95,7 @@ artist test artist
 album test album
 seconds 123
 isrc ABCDEFG
+position 1
 file_name test track.txt
 `
 
@@ -85,6 +107,7 @@ file_name test track.txt
 		Album:    "test album",
 		Seconds:  "123",
 		Isrc:     "ABCDEFG",
+		Position: "1",
 		FileName: "test track.txt",
 	}
 	if expected != actual {
@@ -125,3 +148,97 @@ func TestSearchQueryWithIsrc(t *testing.T) {
 		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
 	}
 }
+
+func Test_TrackContent_Marshal_Episode(t *testing.T) {
+	tc := TrackContent{
+		Id:          "456",
+		Show:        "test show",
+		Name:        "test episode",
+		ReleaseDate: "2023-01-02",
+		Seconds:     "3600000",
+		Type:        TRACK_TYPE_EPISODE,
+		Position:    "2",
+		FileName:    "test episode.txt",
+	}
+	actual := tc.Marshal()
+	expected :=
+		`id 456
+show test show
+name test episode
+release_date 2023-01-02
+seconds 3600000
+type episode
+position 2
+file_name test episode.txt
+`
+	if expected != actual {
+		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
+	}
+	if UnmarshalTrackContent(actual) != tc {
+		t.Errorf("\nactual:\n%+v \nexpected:\n%+v", UnmarshalTrackContent(actual), tc)
+	}
+	if tc.ItemUri() != "spotify:episode:456" {
+		t.Errorf("unexpected uri: %s", tc.ItemUri())
+	}
+	if (TrackContent{Id: "123"}).ItemUri() != "spotify:track:123" {
+		t.Errorf("unexpected uri: %s", TrackContent{Id: "123"}.ItemUri())
+	}
+}
+
+func Test_TrackContent_Marshal_LocalFile(t *testing.T) {
+	tc := TrackContent{
+		Name:     "demo",
+		Artist:   "me",
+		Seconds:  "1000",
+		Uri:      "spotify:local:me::demo:1",
+		IsLocal:  "true",
+		Position: "3",
+		FileName: "demo.txt",
+	}
+	actual := tc.Marshal()
+	expected :=
+		`id 
+name demo
+artist me
+album 
+seconds 1000
+isrc 
+uri spotify:local:me::demo:1
+is_local true
+position 3
+file_name demo.txt
+`
+	if expected != actual {
+		t.Errorf("\nactual:\n%s \nexpected:\n%s", actual, expected)
+	}
+	if UnmarshalTrackContent(actual) != tc {
+		t.Errorf("\nactual:\n%+v \nexpected:\n%+v", UnmarshalTrackContent(actual), tc)
+	}
+	if tc.Key() != tc.Uri || tc.ItemUri() != "spotify:local:me::demo:1" {
+		t.Errorf("unexpected key: %s", tc.Key())
+	}
+}
+
+func Test_FullTrackToContent_Relinked(t *testing.T) {
+	playable := false
+	track := spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "b", Name: "song"}, LinkedFrom: &spotify.LinkedFromInfo{ID: "a"}}
+	actual := FullTrackToContent(&track)
+	if actual.Id != "a" || actual.PlayableId != "b" || actual.IsPlayable != "" {
+		t.Errorf("unexpected content: %+v", actual)
+	}
+
+	track = spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "c", Name: "song"}, IsPlayable: &playable}
+	actual = FullTrackToContent(&track)
+	if actual.Id != "c" || actual.PlayableId != "" || actual.IsPlayable != "false" {
+		t.Errorf("unexpected content: %+v", actual)
+	}
+	if !strings.Contains(actual.Marshal(), "is_playable false\n") {
+		t.Errorf("is_playable is not written: %s", actual.Marshal())
+	}
+
+	track = spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{Name: "demo", URI: "spotify:local:::demo:1"}}
+	actual = LocalTrackToContent(&track)
+	if actual.Id != "" || actual.Key() != "spotify:local:::demo:1" || !actual.IsLocalFile() {
+		t.Errorf("unexpected content: %+v", actual)
+	}
+}
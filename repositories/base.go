@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+// spotify-fbcが内部で使うファイルを置くディレクトリ
+// プレイリスト用ディレクトリとして扱わないようにドットから始める
+const METADATA_DIR_NAME = ".fbc"
+
+func (r *Repository) metadataPath(fileName string) string {
+	return filepath.Join(r.rootPath, METADATA_DIR_NAME, fileName)
+}
+
+func (r *Repository) writeMetadata(fileName string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	filePath := r.metadataPath(fileName)
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, data, 0666); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// ファイルが存在しない場合はfalseを返す
+func (r *Repository) readMetadata(fileName string, v any) (bool, error) {
+	filePath := r.metadataPath(fileName)
+	b, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+	return true, nil
+}
+
+// 最後にpullした時点のリモートの状態を読み込む
+// まだpullしていない場合はnilを返す
+func (r *Repository) FetchBaseSnapshot() ([]models.PlaylistSnapshot, error) {
+	result := []models.PlaylistSnapshot{}
+	ok, err := r.readMetadata("base.json", &result)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *Repository) SaveBaseSnapshot(snapshots []models.PlaylistSnapshot) error {
+	return r.writeMetadata("base.json", snapshots)
+}
+
+// キャッシュする曲の形式を変えた場合は上げる
+// 1: エピソードを含めるようにした
+// 2: ローカルファイルと再生できない曲を区別するようにした
+const TRACK_CACHE_VERSION = 2
+
+type trackCache struct {
+	Version    int                   `json:"version"`
+	SnapshotId string                `json:"snapshot_id"`
+	Tracks     []models.TrackContent `json:"tracks"`
+}
+
+func trackCacheFileName(playlistId string) string {
+	return filepath.Join("tracks", playlistId+".json")
+}
+
+// snapshot_idが一致する場合のみキャッシュした曲を返す
+func (r *Repository) fetchTrackCache(playlist models.PlaylistContent) ([]models.TrackContent, bool) {
+	if r.fullFetch || playlist.Id == "" || playlist.SnapshotId == "" {
+		return nil, false
+	}
+	r.trackCachesLock.Lock()
+	cache, ok := r.trackCaches[playlist.Id]
+	r.trackCachesLock.Unlock()
+	if ok && cache.SnapshotId == playlist.SnapshotId {
+		return cache.Tracks, true
+	}
+	cache = trackCache{}
+	ok, err := r.readMetadata(trackCacheFileName(playlist.Id), &cache)
+	if err != nil || !ok || cache.Version != TRACK_CACHE_VERSION || cache.SnapshotId != playlist.SnapshotId {
+		return nil, false
+	}
+	return cache.Tracks, true
+}
+
+// memoryCacheがtrueの場合は.fbcに書き込まず、メモリに残す
+func (r *Repository) saveTrackCache(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	if playlist.Id == "" || playlist.SnapshotId == "" {
+		return nil
+	}
+	cache := trackCache{Version: TRACK_CACHE_VERSION, SnapshotId: playlist.SnapshotId, Tracks: tracks}
+	if r.memoryCache {
+		r.trackCachesLock.Lock()
+		defer r.trackCachesLock.Unlock()
+		if r.trackCaches == nil {
+			r.trackCaches = map[string]trackCache{}
+		}
+		r.trackCaches[playlist.Id] = cache
+		return nil
+	}
+	return r.writeMetadata(trackCacheFileName(playlist.Id), cache)
+}
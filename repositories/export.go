@@ -0,0 +1,20 @@
+package repositories
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 書き出したプレイリストファイルを作成する
+// outDirはルートディレクトリではなく、カレントディレクトリからのパス
+func (r *Repository) CreateExportFile(outDir string, fileName string, content string) error {
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create %s: %w", outDir, err)
+	}
+	filePath := filepath.Join(outDir, fileName)
+	if err := os.WriteFile(filePath, []byte(content), 0666); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filePath, err)
+	}
+	return nil
+}
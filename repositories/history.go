@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+const HISTORY_DIR_NAME = "history"
+
+func historyFileName(id string) string {
+	return filepath.Join(HISTORY_DIR_NAME, id+".json")
+}
+
+func (r *Repository) SaveHistory(history models.HistorySnapshot) error {
+	return r.writeMetadata(historyFileName(history.Id()), history)
+}
+
+// 保存されている履歴のidを古い順に返す
+func (r *Repository) FetchHistoryIds() ([]string, error) {
+	dirPath := r.metadataPath(HISTORY_DIR_NAME)
+	entries, err := os.ReadDir(dirPath)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dirPath, err)
+	}
+
+	result := []string{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		result = append(result, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (r *Repository) FetchHistory(id string) (models.HistorySnapshot, error) {
+	result := models.HistorySnapshot{}
+	ok, err := r.readMetadata(historyFileName(id), &result)
+	if err != nil {
+		return models.HistorySnapshot{}, err
+	}
+	if !ok {
+		return models.HistorySnapshot{}, fmt.Errorf("history '%s' not found", id)
+	}
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_History(t *testing.T) {
+	r := NewRepository(nil, context.Background(), t.TempDir())
+
+	ids, err := r.FetchHistoryIds()
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	older := models.HistorySnapshot{
+		Time:      time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local),
+		Playlists: []models.HistoryPlaylist{{Playlist: models.PlaylistContent{Id: "p", Name: "pl"}, Tracks: []models.TrackContent{{Id: "t"}}}},
+	}
+	// 同じ秒に保存した履歴も別のidになる
+	sameSecond := models.HistorySnapshot{Time: time.Date(2023, 1, 2, 3, 4, 5, int(time.Millisecond), time.Local)}
+	newer := models.HistorySnapshot{Time: time.Date(2023, 2, 1, 0, 0, 0, 0, time.Local)}
+	assert.NoError(t, r.SaveHistory(newer))
+	assert.NoError(t, r.SaveHistory(older))
+	assert.NoError(t, r.SaveHistory(sameSecond))
+
+	ids, err = r.FetchHistoryIds()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20230102-030405.000", "20230102-030405.001", "20230201-000000.000"}, ids)
+
+	actual, err := r.FetchHistory("20230102-030405.000")
+	assert.NoError(t, err)
+	assert.Equal(t, older.Playlists, actual.Playlists)
+
+	_, err = r.FetchHistory("unknown")
+	assert.Error(t, err)
+}
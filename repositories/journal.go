@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+const JOURNAL_FILE_NAME = "journal.jsonl"
+
+// 同じ時刻に実行されても重複しないよう、ミリ秒とランダムな値を付ける
+func newRunId() string {
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405.000") + "-" + hex.EncodeToString(suffix)
+}
+
+// この実行がundoの場合に、元に戻した実行のidを指定する
+func (r *Repository) SetUndoneRunId(runId string) {
+	r.undoneRunId = runId
+}
+
+// リモートに対して行った変更をjournalに追記する
+// 追記に失敗してもリモートの変更は済んでいるので、警告だけ表示する
+func (r *Repository) appendJournal(entry models.JournalEntry) {
+	entry.RunId = r.runId
+	entry.UndoneRunId = r.undoneRunId
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write the journal: ", err.Error())
+		return
+	}
+
+	filePath := r.metadataPath(JOURNAL_FILE_NAME)
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write the journal: ", err.Error())
+		return
+	}
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write the journal: ", err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write the journal: ", err.Error())
+	}
+}
+
+// journalに記録された変更を古い順に返す
+func (r *Repository) FetchJournal() ([]models.JournalEntry, error) {
+	result := []models.JournalEntry{}
+	filePath := r.metadataPath(JOURNAL_FILE_NAME)
+	f, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := models.JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+		}
+		result = append(result, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,289 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/zmb3/spotify/v2"
+)
+
+const LIBRARY_SNAPSHOT_FILE_NAME = "library.json"
+
+// 最後にpullした時点のライブラリの状態を読み込む
+// まだpullしていない場合はnilを返す
+func (r *Repository) FetchLibrarySnapshot() (*models.LibrarySnapshot, error) {
+	result := models.LibrarySnapshot{}
+	ok, err := r.readMetadata(LIBRARY_SNAPSHOT_FILE_NAME, &result)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (r *Repository) SaveLibrarySnapshot(snapshot models.LibrarySnapshot) error {
+	return r.writeMetadata(LIBRARY_SNAPSHOT_FILE_NAME, snapshot)
+}
+
+// ディレクトリ内のtxtファイルをファイル名と内容の組で読み込む
+// ディレクトリが無い場合はos.ErrNotExistを含むエラーを返す
+func (r *Repository) readLibraryDir(dirName string, f func(fileName string, content string)) error {
+	dirPath := filepath.Join(r.rootPath, dirName)
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to read directory '%s': %w", dirPath, err)
+	}
+	for _, e := range entries {
+		reText := regexp.MustCompile(".txt$")
+		if !reText.MatchString(e.Name()) || e.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dirPath, e.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read file '%s': %w", filepath.Join(dirPath, e.Name()), err)
+		}
+		f(e.Name(), string(content))
+	}
+	return nil
+}
+
+func (r *Repository) writeLibraryTxt(dirName string, fileName string, textContent string) error {
+	dirPath := filepath.Join(r.rootPath, dirName)
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dirPath, err)
+	}
+	filePath := filepath.Join(dirPath, fileName)
+	if err := os.WriteFile(filePath, []byte(textContent), 0666); err != nil {
+		return fmt.Errorf("failed to create %s", filePath)
+	}
+	return nil
+}
+
+func (r *Repository) removeLibraryTxt(dirName string, fileName string) error {
+	filePath := filepath.Join(r.rootPath, dirName, fileName)
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ユーザーが作成したtxtにはfile_nameが無いことがあるので、実際のファイル名を使う
+func (r *Repository) FetchLocalAlbums() ([]models.AlbumContent, error) {
+	result := []models.AlbumContent{}
+	err := r.readLibraryDir(models.ALBUMS_DIR_NAME, func(fileName string, content string) {
+		a := models.UnmarshalAlbumContent(content)
+		a.FileName = fileName
+		result = append(result, a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *Repository) FetchLocalArtists() ([]models.ArtistContent, error) {
+	result := []models.ArtistContent{}
+	err := r.readLibraryDir(models.ARTISTS_DIR_NAME, func(fileName string, content string) {
+		a := models.UnmarshalArtistContent(content)
+		a.FileName = fileName
+		result = append(result, a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *Repository) CreateAlbumContent(album models.AlbumContent) error {
+	return r.writeLibraryTxt(models.ALBUMS_DIR_NAME, album.FileName, album.Marshal())
+}
+
+func (r *Repository) CreateArtistContent(artist models.ArtistContent) error {
+	return r.writeLibraryTxt(models.ARTISTS_DIR_NAME, artist.FileName, artist.Marshal())
+}
+
+func (r *Repository) RemoveAlbumContent(album models.AlbumContent) error {
+	return r.removeLibraryTxt(models.ALBUMS_DIR_NAME, album.FileName)
+}
+
+func (r *Repository) RemoveArtistContent(artist models.ArtistContent) error {
+	return r.removeLibraryTxt(models.ARTISTS_DIR_NAME, artist.FileName)
+}
+
+// 保存した日時の新しい順に返す
+func (r *Repository) FetchRemoteAlbums() ([]models.AlbumContent, error) {
+	LIMIT := 50
+	result := []models.AlbumContent{}
+	for offset := 0; true; offset += LIMIT {
+		page, err := r.client.CurrentUsersAlbums(r.ctx, spotify.Limit(LIMIT), spotify.Offset(offset))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch saved albums: %w", err)
+		}
+		for i := range page.Albums {
+			result = append(result, models.FullAlbumToContent(&page.Albums[i].FullAlbum))
+		}
+		if len(page.Albums) != LIMIT {
+			break
+		}
+	}
+	return result, nil
+}
+
+// フォローしたアーティストはカーソルでページを辿る
+func (r *Repository) FetchRemoteArtists() ([]models.ArtistContent, error) {
+	LIMIT := 50
+	result := []models.ArtistContent{}
+	after := ""
+	for {
+		opts := []spotify.RequestOption{spotify.Limit(LIMIT)}
+		if after != "" {
+			opts = append(opts, spotify.After(after))
+		}
+		page, err := r.client.CurrentUsersFollowedArtists(r.ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch followed artists: %w", err)
+		}
+		for i := range page.Artists {
+			result = append(result, models.FullArtistToContent(&page.Artists[i]))
+		}
+		after = page.Cursor.After
+		if after == "" || len(page.Artists) == 0 {
+			break
+		}
+	}
+	return result, nil
+}
+
+func albumIds(albums []models.AlbumContent) ([]spotify.ID, error) {
+	ids := []spotify.ID{}
+	for _, v := range albums {
+		if v.Id == "" {
+			return nil, fmt.Errorf("album %v does not have album id", v)
+		}
+		ids = append(ids, spotify.ID(v.Id))
+	}
+	return ids, nil
+}
+
+func artistIds(artists []models.ArtistContent) ([]spotify.ID, error) {
+	ids := []spotify.ID{}
+	for _, v := range artists {
+		if v.Id == "" {
+			return nil, fmt.Errorf("artist %v does not have artist id", v)
+		}
+		ids = append(ids, spotify.ID(v.Id))
+	}
+	return ids, nil
+}
+
+func (r *Repository) SaveRemoteAlbums(albums []models.AlbumContent) error {
+	return splitProcess(50, albums, func(chunk []models.AlbumContent) error {
+		ids, err := albumIds(chunk)
+		if err != nil {
+			return err
+		}
+		if err := r.client.AddAlbumsToLibrary(r.ctx, ids...); err != nil {
+			return fmt.Errorf("failed to save albums: %w", err)
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_SAVE_ALBUMS, Albums: chunk})
+		return nil
+	})
+}
+
+func (r *Repository) RemoveRemoteAlbums(albums []models.AlbumContent) error {
+	return splitProcess(50, albums, func(chunk []models.AlbumContent) error {
+		ids, err := albumIds(chunk)
+		if err != nil {
+			return err
+		}
+		if err := r.client.RemoveAlbumsFromLibrary(r.ctx, ids...); err != nil {
+			return fmt.Errorf("failed to remove saved albums: %w", err)
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REMOVE_ALBUMS, Albums: chunk})
+		return nil
+	})
+}
+
+func (r *Repository) FollowRemoteArtists(artists []models.ArtistContent) error {
+	return splitProcess(50, artists, func(chunk []models.ArtistContent) error {
+		ids, err := artistIds(chunk)
+		if err != nil {
+			return err
+		}
+		if err := r.client.FollowArtist(r.ctx, ids...); err != nil {
+			return fmt.Errorf("failed to follow artists: %w", err)
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_FOLLOW_ARTISTS, Artists: chunk})
+		return nil
+	})
+}
+
+func (r *Repository) UnfollowRemoteArtists(artists []models.ArtistContent) error {
+	return splitProcess(50, artists, func(chunk []models.ArtistContent) error {
+		ids, err := artistIds(chunk)
+		if err != nil {
+			return err
+		}
+		if err := r.client.UnfollowArtist(r.ctx, ids...); err != nil {
+			return fmt.Errorf("failed to unfollow artists: %w", err)
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_UNFOLLOW_ARTISTS, Artists: chunk})
+		return nil
+	})
+}
+
+// idの無いアルバムtxtを検索する
+// 見つからなかった場合はnilを返す
+func (r *Repository) SearchRemoteAlbum(album models.AlbumContent) (*models.AlbumContent, error) {
+	res, err := r.client.Search(r.ctx, album.SearchQuery(), spotify.SearchTypeAlbum, spotify.Limit(MATCH_CANDIDATES))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search album: %w", err)
+	}
+	candidates := []models.AlbumContent{}
+	for i := range res.Albums.Albums {
+		candidates = append(candidates, models.SimpleAlbumToContent(&res.Albums.Albums[i]))
+	}
+	if album.Upc != "" && len(candidates) > 0 {
+		// UPCで検索した場合は一致したものとみなす
+		return &candidates[0], nil
+	}
+	return bestLibraryMatch(candidates, func(c models.AlbumContent) float64 {
+		if album.Artist == "" {
+			return similarity(album.Name, c.Name)
+		}
+		return 0.7*similarity(album.Name, c.Name) + 0.3*artistSimilarity(album.Artist, c.Artist)
+	}), nil
+}
+
+// idの無いアーティストtxtを検索する
+// 見つからなかった場合はnilを返す
+func (r *Repository) SearchRemoteArtist(artist models.ArtistContent) (*models.ArtistContent, error) {
+	res, err := r.client.Search(r.ctx, "artist:"+artist.Name, spotify.SearchTypeArtist, spotify.Limit(MATCH_CANDIDATES))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search artist: %w", err)
+	}
+	candidates := []models.ArtistContent{}
+	for i := range res.Artists.Artists {
+		candidates = append(candidates, models.FullArtistToContent(&res.Artists.Artists[i]))
+	}
+	return bestLibraryMatch(candidates, func(c models.ArtistContent) float64 {
+		return similarity(artist.Name, c.Name)
+	}), nil
+}
+
+// スコアが最も高い候補を返す
+// 同じスコアの場合は検索結果の順番が先のものを選ぶ
+func bestLibraryMatch[T any](candidates []T, score func(T) float64) *T {
+	var best *T
+	bestScore := 0.0
+	for i := range candidates {
+		if s := score(candidates[i]); s >= MATCH_THRESHOLD && (best == nil || s > bestScore) {
+			best = &candidates[i]
+			bestScore = s
+		}
+	}
+	return best
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LibraryContent(t *testing.T) {
+	root := t.TempDir()
+	r := NewRepository(nil, context.Background(), root)
+
+	// pullしていない場合はディレクトリが無い
+	_, err := r.FetchLocalAlbums()
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	snapshot, err := r.FetchLibrarySnapshot()
+	assert.NoError(t, err)
+	assert.Nil(t, snapshot)
+
+	album := models.AlbumContent{Id: "1", Name: "Purpose", Artist: "Justin Bieber", ReleaseDate: "2015-11-13", Upc: "00602547682158", FileName: "Purpose.txt"}
+	assert.NoError(t, r.CreateAlbumContent(album))
+	assert.NoError(t, r.CreateArtistContent(models.ArtistContent{Id: "2", Name: "Justin Bieber", FileName: "Justin Bieber.txt"}))
+	// ユーザーが作成したtxtにはfile_nameが無い
+	assert.NoError(t, os.WriteFile(filepath.Join(root, models.ALBUMS_DIR_NAME, "new.txt"), []byte("name Changes\n"), 0666))
+
+	albums, err := r.FetchLocalAlbums()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AlbumContent{album, {Name: "Changes", FileName: "new.txt"}}, albums)
+	artists, err := r.FetchLocalArtists()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ArtistContent{{Id: "2", Name: "Justin Bieber", FileName: "Justin Bieber.txt"}}, artists)
+
+	// ライブラリのディレクトリはプレイリストとして扱わない
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "playlist"), os.ModePerm))
+	dirs, err := r.fetchLocalPlaylistDir()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"playlist"}, dirs)
+
+	assert.NoError(t, r.RemoveAlbumContent(album))
+	assert.NoError(t, r.RemoveAlbumContent(album))
+	albums, err = r.FetchLocalAlbums()
+	assert.NoError(t, err)
+	assert.Len(t, albums, 1)
+
+	assert.NoError(t, r.SaveLibrarySnapshot(models.LibrarySnapshot{Albums: []models.AlbumContent{album}, Artists: []models.ArtistContent{}}))
+	snapshot, err = r.FetchLibrarySnapshot()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AlbumContent{album}, snapshot.Albums)
+}
@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/zmb3/spotify/v2"
+)
+
+func errLikedSongs(operation string) error {
+	return fmt.Errorf("%s cannot be %s", models.LIKED_SONGS_NAME, operation)
+}
+
+// お気に入りの曲は、曲数と最後に追加した日時が変わっていなければ変更されていないとみなす
+func (r *Repository) fetchLikedSongsContent(owner string) (models.PlaylistContent, error) {
+	page, err := r.client.CurrentUsersTracks(r.ctx, spotify.Limit(1))
+	if err != nil {
+		return models.PlaylistContent{}, fmt.Errorf("failed to fetch %s: %w", models.LIKED_SONGS_NAME, err)
+	}
+	snapshotId := strconv.Itoa(int(page.Total))
+	if len(page.Tracks) > 0 {
+		snapshotId += "-" + page.Tracks[0].AddedAt
+	}
+	return models.NewLikedSongsContent(owner, snapshotId), nil
+}
+
+// 追加した日時の新しい順に返す
+func (r *Repository) fetchLikedSongsTrack(ctx context.Context) ([]models.TrackContent, error) {
+	LIMIT := 50
+	result := []models.TrackContent{}
+	for offset := 0; true; offset += LIMIT {
+		page, err := r.client.CurrentUsersTracks(ctx, spotify.Limit(LIMIT), spotify.Offset(offset), spotify.Market(MARKET_FROM_TOKEN))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", models.LIKED_SONGS_NAME, err)
+		}
+		for idx, v := range page.Tracks {
+			trackContent := models.FullTrackToContent(&v.FullTrack)
+			trackContent.Position = strconv.Itoa(offset + idx + 1)
+			result = append(result, trackContent)
+		}
+		if len(page.Tracks) != LIMIT {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (r *Repository) addLikedSongsTrack(tracks []models.TrackContent, c chan []models.TrackContent) error {
+	return splitProcess(50, tracks, func(chunk []models.TrackContent) error {
+		ids, err := trackIds(chunk)
+		if err != nil {
+			return err
+		}
+		if err := r.client.AddTracksToLibrary(r.ctx, ids...); err != nil {
+			return fmt.Errorf("failed to add tracks to %s: %w", models.LIKED_SONGS_NAME, err)
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_ADD_TRACKS, PlaylistId: models.LIKED_SONGS_ID, PlaylistName: models.LIKED_SONGS_NAME, Tracks: chunk})
+		// 実行の途中結果をすぐに返す
+		c <- chunk
+		return nil
+	})
+}
+
+// 同じ曲は1つしか無いので、positionに関わらずidで削除する
+func (r *Repository) removeLikedSongsTrack(tracks []models.TrackContent) error {
+	return splitProcess(50, tracks, func(chunk []models.TrackContent) error {
+		ids, err := trackIds(chunk)
+		if err != nil {
+			return err
+		}
+		if err := r.client.RemoveTracksFromLibrary(r.ctx, ids...); err != nil {
+			return fmt.Errorf("failed to remove tracks from %s: %w", models.LIKED_SONGS_NAME, err)
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REMOVE_TRACKS, PlaylistId: models.LIKED_SONGS_ID, PlaylistName: models.LIKED_SONGS_NAME, Tracks: chunk})
+		return nil
+	})
+}
+
+// tracksに無い曲を削除し、足りない曲を追加する
+// 順番は追加した日時で決まるので並べ替えない
+func (r *Repository) replaceLikedSongsTrack(tracks []models.TrackContent) error {
+	oldTracks, err := r.fetchLikedSongsTrack(r.ctx)
+	if err != nil {
+		return err
+	}
+	newIds := map[string]struct{}{}
+	for _, v := range tracks {
+		newIds[v.Id] = struct{}{}
+	}
+	oldIds := map[string]struct{}{}
+	removed := []models.TrackContent{}
+	for _, v := range oldTracks {
+		oldIds[v.Id] = struct{}{}
+		if _, ok := newIds[v.Id]; !ok {
+			removed = append(removed, v)
+		}
+	}
+	added := []spotify.ID{}
+	for _, v := range tracks {
+		if _, ok := oldIds[v.Id]; !ok {
+			added = append(added, spotify.ID(v.Id))
+			oldIds[v.Id] = struct{}{}
+		}
+	}
+
+	err = splitProcess(50, removed, func(chunk []models.TrackContent) error {
+		ids, err := trackIds(chunk)
+		if err != nil {
+			return err
+		}
+		return r.client.RemoveTracksFromLibrary(r.ctx, ids...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace tracks of %s: %w", models.LIKED_SONGS_NAME, err)
+	}
+	err = splitProcess(50, added, func(chunk []spotify.ID) error {
+		return r.client.AddTracksToLibrary(r.ctx, chunk...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace tracks of %s: %w", models.LIKED_SONGS_NAME, err)
+	}
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REPLACE_TRACKS, PlaylistId: models.LIKED_SONGS_ID, PlaylistName: models.LIKED_SONGS_NAME, Tracks: tracks, OldTracks: oldTracks})
+	return nil
+}
+
+func trackIds(tracks []models.TrackContent) ([]spotify.ID, error) {
+	ids := []spotify.ID{}
+	for _, v := range tracks {
+		if v.Id == "" {
+			return nil, fmt.Errorf("track %v is not have track id", v)
+		}
+		if v.IsEpisode() {
+			return nil, fmt.Errorf("episode %s cannot be saved to %s", v.Name, models.LIKED_SONGS_NAME)
+		}
+		ids = append(ids, spotify.ID(v.Id))
+	}
+	return ids, nil
+}
@@ -5,15 +5,24 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/kajikentaro/spotify-fbc/models"
 )
 
 func (r *Repository) FetchLocalPlaylistContent() ([]models.PlaylistContent, error) {
+	localPLs, _, err := r.fetchLocalPlaylistContent()
+	return localPLs, err
+}
+
+// どのディレクトリにも対応しなかったプレイリスト情報txtも返す
+func (r *Repository) fetchLocalPlaylistContent() ([]models.PlaylistContent, []models.PlaylistContent, error) {
 	// プレイリスト情報のテキストファイル読み込み
 	playlistContents, err := r.fetchLocalPlaylistTxt()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// 検索しやすいようにmapにする
 	dirNameToPL := map[string]models.PlaylistContent{}
@@ -24,20 +33,121 @@ func (r *Repository) FetchLocalPlaylistContent() ([]models.PlaylistContent, erro
 	// ディレクトリの一覧を取得
 	dirs, err := r.fetchLocalPlaylistDir()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	isDir := map[string]bool{}
+	noTxtDirs := []string{}
+	for _, v := range dirs {
+		isDir[v] = true
+		if _, isExist := dirNameToPL[v]; !isExist {
+			noTxtDirs = append(noTxtDirs, v)
+		}
+	}
+	unusedTxts := []models.PlaylistContent{}
+	for _, v := range playlistContents {
+		if !isDir[v.DirName] {
+			unusedTxts = append(unusedTxts, v)
+		}
 	}
+
+	// ディレクトリ名だけが変更されたプレイリストを探す
+	renamed, err := r.matchRenamedDirectory(unusedTxts, noTxtDirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// ディレクトリを "プレイリスト情報のテキストファイル" の情報と関連付けて配列で保存
 	localPLs := []models.PlaylistContent{}
 	for _, v := range dirs {
 		if w, isExist := dirNameToPL[v]; isExist {
 			// プレイリスト情報txtが存在する場合
 			localPLs = append(localPLs, w)
+		} else if w, isExist := renamed[v]; isExist {
+			localPLs = append(localPLs, w)
 		} else {
 			localPLs = append(localPLs, models.PlaylistContent{DirName: v})
 		}
 	}
 
-	return localPLs, nil
+	matchedIds := map[string]bool{}
+	for _, v := range renamed {
+		matchedIds[v.Id] = true
+	}
+	unused := []models.PlaylistContent{}
+	for _, v := range unusedTxts {
+		if !matchedIds[v.Id] {
+			unused = append(unused, v)
+		}
+	}
+	return localPLs, unused, nil
+}
+
+// ディレクトリ名だけが変更された場合、古いtxtはディレクトリが無く、新しいディレクトリにはtxtが無い
+// txtのidで最後に取得した曲(baseかキャッシュ)を調べ、同じ曲が最も多いディレクトリと対応付ける
+// 曲が1つも一致しない場合は対応付けない
+func (r *Repository) matchRenamedDirectory(txts []models.PlaylistContent, dirs []string) (map[string]models.PlaylistContent, error) {
+	res := map[string]models.PlaylistContent{}
+	if len(txts) == 0 || len(dirs) == 0 {
+		return res, nil
+	}
+	base, err := r.FetchBaseSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	idToTrackIds := map[string][]string{}
+	for _, v := range base {
+		idToTrackIds[v.Id] = v.TrackIds
+	}
+	dirToKeys := map[string]map[string]bool{}
+	for _, d := range dirs {
+		tracks, err := r.FetchLocalPlaylistTrack(d)
+		if err != nil {
+			return nil, err
+		}
+		keys := map[string]bool{}
+		for _, t := range tracks {
+			if t.Key() != "" {
+				keys[t.Key()] = true
+			}
+		}
+		dirToKeys[d] = keys
+	}
+
+	for _, p := range txts {
+		if p.Id == "" {
+			continue
+		}
+		known := idToTrackIds[p.Id]
+		if cached, ok := r.fetchTrackCache(p); ok {
+			for _, t := range cached {
+				known = append(known, t.Key())
+			}
+		}
+		bestDir, bestCount := "", 0
+		for _, d := range dirs {
+			if _, used := res[d]; used {
+				continue
+			}
+			count := 0
+			for _, k := range known {
+				if dirToKeys[d][k] {
+					count++
+				}
+			}
+			if count > bestCount {
+				bestDir, bestCount = d, count
+			}
+		}
+		if bestDir == "" {
+			continue
+		}
+		if p.OldDirName == "" {
+			p.OldDirName = p.DirName
+		}
+		p.DirName = bestDir
+		res[bestDir] = p
+	}
+	return res, nil
 }
 
 // ローカルのプレイリスト情報txtファイルを読み込み
@@ -65,6 +175,12 @@ func (r *Repository) fetchLocalPlaylistTxt() ([]models.PlaylistContent, error) {
 			// おそらくプレイリストtxtではないためスキップ
 			continue
 		}
+		fileStem := strings.TrimSuffix(v.Name(), ".txt")
+		if p.DirName != fileStem {
+			// ユーザーがディレクトリとプレイリストtxtの名前を変更した場合
+			p.OldDirName = p.DirName
+			p.DirName = fileStem
+		}
 		result = append(result, p)
 	}
 	return result, nil
@@ -82,7 +198,12 @@ func (r *Repository) fetchLocalPlaylistDir() ([]string, error) {
 		if !e.IsDir() {
 			continue
 		}
-		if e.Name() == ".git" {
+		if strings.HasPrefix(e.Name(), ".") {
+			// .gitやメタデータ用のディレクトリはプレイリストではない
+			continue
+		}
+		if models.IsLibraryDirName(e.Name()) {
+			// 保存したアルバムとフォローしたアーティストのディレクトリ
 			continue
 		}
 		result = append(result, e.Name())
@@ -121,6 +242,17 @@ func (r *Repository) FetchLocalPlaylistTrack(dirName string) ([]models.TrackCont
 		}
 		result = append(result, t)
 	}
+
+	// positionプロパティの順に並べる
+	// positionが無いもの(ユーザーが新規作成したもの)は末尾にファイル名順で並べる
+	sort.SliceStable(result, func(i, j int) bool {
+		pi, errI := strconv.Atoi(result[i].Position)
+		pj, errJ := strconv.Atoi(result[j].Position)
+		if errI != nil || errJ != nil {
+			return errI == nil && errJ != nil
+		}
+		return pi < pj
+	})
 	return result, nil
 }
 
@@ -147,6 +279,29 @@ func (r *Repository) CreatePlaylistDirectory(playlist models.PlaylistContent) er
 	return nil
 }
 
+// プレイリストのカバー画像を読み込む
+// 存在しない場合はnilを返す
+func (r *Repository) FetchLocalPlaylistCover(dirName string) ([]byte, error) {
+	filePath := filepath.Join(r.rootPath, dirName, models.COVER_FILE_NAME)
+	img, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file '%s': %w", filePath, err)
+	}
+	return img, nil
+}
+
+func (r *Repository) CreatePlaylistCover(dirName string, img []byte) error {
+	filePath := filepath.Join(r.rootPath, dirName, models.COVER_FILE_NAME)
+	err := os.WriteFile(filePath, img, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to create %s", filePath)
+	}
+	return nil
+}
+
 // TODO rootPath と dirNameを引数にするように
 func (r *Repository) CreateTrackContent(dirName string, track models.TrackContent) error {
 	dirPath := filepath.Join(r.rootPath, dirName)
@@ -168,41 +323,53 @@ func (r *Repository) RemoveTrackContent(dirName string, track models.TrackConten
 	return nil
 }
 
-// 不要なプレイリスト情報txtファイルを消去する
-func (r *Repository) CleanUpPlaylistContent() ([]string, error) {
-	dirs, err := r.fetchLocalPlaylistDir()
-	if err != nil {
-		return nil, err
+// ローカルのプレイリスト用ディレクトリとプレイリスト情報txtを削除
+func (r *Repository) RemovePlaylistDirectory(playlist models.PlaylistContent) error {
+	dirPath := filepath.Join(r.rootPath, playlist.DirName)
+	if err := os.RemoveAll(dirPath); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", dirPath, err)
 	}
-	contents, err := r.FetchLocalPlaylistContent()
-	if err != nil {
-		return nil, err
+	filePath := filepath.Join(r.rootPath, playlist.DirName+".txt")
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", filePath, err)
 	}
+	return nil
+}
 
-	txtIsUsed := map[string]bool{}
-	for _, c := range contents {
-		txtIsUsed[c.DirName] = false
+// ローカルのプレイリスト用ディレクトリの名前を変更し、古いプレイリスト情報txtを削除
+func (r *Repository) RenamePlaylistDirectory(playlist models.PlaylistContent, newDirName string) error {
+	oldPath := filepath.Join(r.rootPath, playlist.DirName)
+	newPath := filepath.Join(r.rootPath, newDirName)
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", oldPath, newPath, err)
 	}
+	filePath := filepath.Join(r.rootPath, playlist.DirName+".txt")
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", filePath, err)
+	}
+	return nil
+}
 
-	for _, d := range dirs {
-		txtIsUsed[d] = true
+// どのディレクトリにも対応しない不要なプレイリスト情報txtファイルを消去する
+func (r *Repository) CleanUpPlaylistContent() ([]string, error) {
+	_, unused, err := r.fetchLocalPlaylistContent()
+	if err != nil {
+		return nil, err
 	}
 
 	deletedFiles := []string{}
-	for dirName, isUsed := range txtIsUsed {
-		if !isUsed {
-			fName := filepath.Join(r.rootPath, dirName+".txt")
-			err := os.Remove(fName)
-			if err != nil {
-				return deletedFiles, fmt.Errorf("failed to remove the unused playlist content '%s': %w", fName, err)
-			}
-			deletedFiles = append(deletedFiles, fName)
+	for _, v := range unused {
+		fName := filepath.Join(r.rootPath, v.DirName+".txt")
+		err := os.Remove(fName)
+		if err != nil {
+			return deletedFiles, fmt.Errorf("failed to remove the unused playlist content '%s': %w", fName, err)
 		}
+		deletedFiles = append(deletedFiles, fName)
 	}
 	return deletedFiles, nil
 }
 
-func (r Repository) CreateRootDir() error {
+func (r *Repository) CreateRootDir() error {
 	err := os.Mkdir(r.rootPath, os.ModePerm)
 	if err != nil {
 		return err
@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FetchLocalPlaylistContent_renamedDirectory(t *testing.T) {
+	root := t.TempDir()
+	r := NewRepository(nil, context.Background(), root)
+	old := models.PlaylistContent{Id: "p", Name: "old", DirName: "old", SnapshotId: "s"}
+	assert.NoError(t, r.CreatePlaylistContent(old))
+	assert.NoError(t, r.SaveBaseSnapshot([]models.PlaylistSnapshot{models.NewPlaylistSnapshot(old, []models.TrackContent{{Id: "a"}, {Id: "b"}})}))
+	// ユーザーがディレクトリ名だけを変更した
+	for _, dir := range []string{"new", "other"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(root, dir), os.ModePerm))
+	}
+	assert.NoError(t, r.CreateTrackContent("new", models.TrackContent{Id: "a", FileName: "a.txt"}))
+	assert.NoError(t, r.CreateTrackContent("other", models.TrackContent{Id: "c", FileName: "c.txt"}))
+
+	playlists, err := r.FetchLocalPlaylistContent()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.PlaylistContent{
+		{Id: "p", Name: "old", DirName: "new", SnapshotId: "s", OldDirName: "old"},
+		{DirName: "other"},
+	}, playlists)
+
+	// 対応付けられたtxtは消さない
+	deleted, err := r.CleanUpPlaylistContent()
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	// 新しい名前のtxtを作った後は古いtxtが不要になる
+	assert.NoError(t, r.CreatePlaylistContent(models.PlaylistContent{Id: "p", Name: "new", DirName: "new", SnapshotId: "s"}))
+	deleted, err = r.CleanUpPlaylistContent()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "old.txt")}, deleted)
+}
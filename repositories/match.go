@@ -0,0 +1,252 @@
+package repositories
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+// 1回の検索で取得する候補の数
+const MATCH_CANDIDATES = 10
+
+// この値以上のスコアの候補だけを採用する
+const MATCH_THRESHOLD = 0.7
+
+// 1位と2位のスコアの差がこれより小さい場合は曖昧として採用しない
+const MATCH_AMBIGUOUS_MARGIN = 0.05
+
+// 再生時間の差がこの秒数以内なら一致とみなす
+const DURATION_TOLERANCE_SECONDS = 3
+
+// 再生時間の差がこの秒数以上なら再生時間のスコアを0にする
+const DURATION_MAX_DIFF_SECONDS = 30
+
+// 候補の曲名かアルバム名にだけ含まれている場合に減点する語
+var VERSION_PENALTIES = map[string]float64{
+	"live":         0.3,
+	"karaoke":      0.3,
+	"instrumental": 0.3,
+	"off vocal":    0.3,
+	"remix":        0.2,
+	"acoustic":     0.1,
+	"remaster":     0.05,
+	"remastered":   0.05,
+}
+
+type matchCandidate struct {
+	track models.TrackContent
+	score float64
+}
+
+type matchResult struct {
+	// 採用した候補 (採用しなかった場合はnil)
+	best *models.TrackContent
+	// スコアの高い順の候補
+	candidates []matchCandidate
+	// 同程度のスコアの候補が複数あるため採用しなかった
+	ambiguous bool
+}
+
+// 検索結果の候補からローカルの曲に最も近いものを選ぶ
+func matchTrack(local models.TrackContent, candidates []models.TrackContent) matchResult {
+	res := matchResult{}
+	for _, c := range candidates {
+		res.candidates = append(res.candidates, matchCandidate{track: c, score: scoreTrack(local, c)})
+	}
+	sort.SliceStable(res.candidates, func(i, j int) bool {
+		return res.candidates[i].score > res.candidates[j].score
+	})
+	if len(res.candidates) == 0 || res.candidates[0].score < MATCH_THRESHOLD {
+		return res
+	}
+
+	first := res.candidates[0]
+	for _, c := range res.candidates[1:] {
+		if first.score-c.score >= MATCH_AMBIGUOUS_MARGIN {
+			break
+		}
+		// 同じ録音 (シングルとアルバムなど) は区別しない
+		if c.track.Isrc != "" && c.track.Isrc == first.track.Isrc {
+			continue
+		}
+		res.ambiguous = true
+		return res
+	}
+	res.best = &first.track
+	return res
+}
+
+// 採用しなかった理由と、idを書き込むための候補を表示する
+func printUnmatchedTrack(local models.TrackContent, match matchResult) {
+	if match.ambiguous {
+		fmt.Fprintln(os.Stderr, local.FileName, "matched several tracks. write the id of the correct one to the file:")
+	} else {
+		fmt.Fprintln(os.Stderr, local.FileName, "no confident match found. the closest tracks are:")
+	}
+	for i, c := range match.candidates {
+		if i >= 3 {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %.2f %s / %s / %s (%s)\n", c.score, c.track.Name, c.track.Artist, c.track.Album, c.track.Id)
+	}
+}
+
+// ローカルの曲とリモートの候補の近さを0から1で返す
+// ローカルで空になっている項目は比較しない
+func scoreTrack(local models.TrackContent, candidate models.TrackContent) float64 {
+	if local.Isrc != "" && local.Isrc == candidate.Isrc {
+		return 1
+	}
+
+	total := 0.0
+	weight := 0.0
+	add := func(w float64, score float64) {
+		total += w * score
+		weight += w
+	}
+	if local.Name != "" {
+		add(0.5, similarity(stripVersion(local.Name), stripVersion(candidate.Name)))
+	}
+	if local.Artist != "" {
+		add(0.3, artistSimilarity(local.Artist, candidate.Artist))
+	}
+	if local.Album != "" {
+		add(0.1, similarity(stripVersion(local.Album), stripVersion(candidate.Album)))
+	}
+	if score, ok := durationScore(local.Seconds, candidate.Seconds); ok {
+		add(0.1, score)
+	}
+	if weight == 0 {
+		return 0
+	}
+
+	score := total / weight
+	localText := normalizeText(local.Name + " " + local.Album)
+	candidateText := normalizeText(candidate.Name + " " + candidate.Album)
+	for word, penalty := range VERSION_PENALTIES {
+		if containsWord(candidateText, word) && !containsWord(localText, word) {
+			score -= penalty
+		}
+	}
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// 複数のアーティストはローカルの各アーティストに最も近いものの平均にする
+func artistSimilarity(local string, candidate string) float64 {
+	localArtists := strings.Split(local, ",")
+	candidateArtists := strings.Split(candidate, ",")
+	total := 0.0
+	for _, l := range localArtists {
+		best := 0.0
+		for _, c := range candidateArtists {
+			if s := similarity(l, c); s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+	return total / float64(len(localArtists))
+}
+
+// 再生時間のスコア
+// 比較できない場合はfalseを返す
+func durationScore(local string, candidate string) (float64, bool) {
+	localSeconds, ok := models.ParseSeconds(local)
+	if !ok {
+		return 0, false
+	}
+	candidateSeconds, ok := models.ParseSeconds(candidate)
+	if !ok {
+		return 0, false
+	}
+	diff := localSeconds - candidateSeconds
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff <= DURATION_TOLERANCE_SECONDS {
+		return 1, true
+	}
+	if diff >= DURATION_MAX_DIFF_SECONDS {
+		return 0, true
+	}
+	return 1 - float64(diff-DURATION_TOLERANCE_SECONDS)/float64(DURATION_MAX_DIFF_SECONDS-DURATION_TOLERANCE_SECONDS), true
+}
+
+// 括弧やハイフンの後に書かれたバージョン表記
+var versionPattern = regexp.MustCompile(`\s*(\(.*?\)|\[.*?\]|\s-\s.*$)`)
+
+func stripVersion(v string) string {
+	stripped := versionPattern.ReplaceAllString(v, "")
+	if strings.TrimSpace(stripped) == "" {
+		return v
+	}
+	return stripped
+}
+
+// 大文字小文字と記号の違いを無視するため、小文字にして文字と数字以外を空白にする
+func normalizeText(v string) string {
+	mapped := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, v)
+	return strings.Join(strings.Fields(mapped), " ")
+}
+
+// 正規化したtextに単語としてwordが含まれているか
+func containsWord(text string, word string) bool {
+	return strings.Contains(" "+text+" ", " "+word+" ")
+}
+
+// 正規化した文字列の編集距離から近さを0から1で返す
+func similarity(a string, b string) float64 {
+	ra := []rune(normalizeText(a))
+	rb := []rune(normalizeText(b))
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(maxLen)
+}
+
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	res := values[0]
+	for _, v := range values[1:] {
+		if v < res {
+			res = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_matchTrack(t *testing.T) {
+	original := models.TrackContent{Id: "original", Name: "Yesterday - Remastered 2009", Artist: "The Beatles", Album: "Help!", Seconds: "125666", Isrc: "GBAYE0601477"}
+	live := models.TrackContent{Id: "live", Name: "Yesterday - Live", Artist: "The Beatles", Album: "Live At The Hollywood Bowl", Seconds: "153000", Isrc: "GBUM71603954"}
+	karaoke := models.TrackContent{Id: "karaoke", Name: "Yesterday (Karaoke Version)", Artist: "Karaoke Hits", Album: "Karaoke Hits Vol. 1", Seconds: "126000", Isrc: "USX9P0000001"}
+	cover := models.TrackContent{Id: "cover", Name: "Yesterday", Artist: "Someone Else", Album: "Covers", Seconds: "126000", Isrc: "USX9P0000002"}
+
+	tests := []struct {
+		name       string
+		local      models.TrackContent
+		candidates []models.TrackContent
+		expected   string
+		ambiguous  bool
+	}{
+		{
+			name:       "prefer the studio version",
+			local:      models.TrackContent{Name: "yesterday", Artist: "the beatles", Seconds: "126"},
+			candidates: []models.TrackContent{karaoke, live, original},
+			expected:   "original",
+		},
+		{
+			name:       "keep the live version when it is requested",
+			local:      models.TrackContent{Name: "Yesterday (Live)", Artist: "The Beatles", Album: "Live At The Hollywood Bowl"},
+			candidates: []models.TrackContent{original, live},
+			expected:   "live",
+		},
+		{
+			name:       "isrc",
+			local:      models.TrackContent{Name: "Yesterday", Isrc: "GBUM71603954"},
+			candidates: []models.TrackContent{original, live},
+			expected:   "live",
+		},
+		{
+			name:       "below the threshold",
+			local:      models.TrackContent{Name: "Let It Be", Artist: "The Beatles"},
+			candidates: []models.TrackContent{cover, karaoke},
+			expected:   "",
+		},
+		{
+			name:       "ambiguous without the artist",
+			local:      models.TrackContent{Name: "Yesterday"},
+			candidates: []models.TrackContent{cover, {Id: "another", Name: "Yesterday", Artist: "Another Artist", Isrc: "USX9P0000003"}},
+			expected:   "",
+			ambiguous:  true,
+		},
+		{
+			name:       "same recording is not ambiguous",
+			local:      models.TrackContent{Name: "Yesterday", Artist: "The Beatles"},
+			candidates: []models.TrackContent{{Id: "single", Name: "Yesterday", Artist: "The Beatles", Album: "Yesterday", Isrc: "GBAYE0601477"}, {Id: "album", Name: "Yesterday", Artist: "The Beatles", Album: "Help!", Isrc: "GBAYE0601477"}},
+			expected:   "single",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := matchTrack(tt.local, tt.candidates)
+			assert.Equal(t, tt.ambiguous, actual.ambiguous)
+			if tt.expected == "" {
+				assert.Nil(t, actual.best)
+				return
+			}
+			if assert.NotNil(t, actual.best) {
+				assert.Equal(t, tt.expected, actual.best.Id)
+			}
+		})
+	}
+}
+
+func Test_durationScore(t *testing.T) {
+	tests := []struct {
+		local     string
+		candidate string
+		expected  float64
+		ok        bool
+	}{
+		{"126", "125666", 1, true},
+		{"126000", "128000", 1, true},
+		{"100", "160000", 0, true},
+		{"", "160000", 0, false},
+	}
+	for _, tt := range tests {
+		actual, ok := durationScore(tt.local, tt.candidate)
+		assert.Equal(t, tt.ok, ok)
+		assert.InDelta(t, tt.expected, actual, 0.001)
+	}
+}
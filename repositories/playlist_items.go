@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/zmb3/spotify/v2"
+)
+
+const SPOTIFY_API_URL = "https://api.spotify.com/v1/"
+
+// 曲とエピソードのURIを順番通りに返す
+func trackUris(tracks []models.TrackContent) ([]spotify.URI, error) {
+	uris := []spotify.URI{}
+	for _, v := range tracks {
+		if v.IsLocalFile() {
+			return nil, fmt.Errorf("local file %s cannot be added", v.Name)
+		}
+		if v.Id == "" {
+			return nil, fmt.Errorf("track %v is not have track id", v)
+		}
+		uris = append(uris, v.ItemUri())
+	}
+	return uris, nil
+}
+
+// spotifyライブラリの追加と削除は曲のURIしか扱えないので、エピソードも扱えるようにURIを直接送る
+func (r *Repository) addPlaylistItems(playlistId string, uris []spotify.URI) error {
+	return r.requestApi(http.MethodPost, "playlists/"+playlistId+"/tracks", map[string]any{"uris": uris})
+}
+
+// positionを指定せずに、そのURIの曲をすべて削除する
+func (r *Repository) removePlaylistItems(playlistId string, uris []spotify.URI) error {
+	tracks := []map[string]spotify.URI{}
+	for _, v := range uris {
+		tracks = append(tracks, map[string]spotify.URI{"uri": v})
+	}
+	return r.requestApi(http.MethodDelete, "playlists/"+playlistId+"/tracks", map[string]any{"tracks": tracks})
+}
+
+// spotifyライブラリが対応していないAPIにbodyをJSONで送る
+func (r *Repository) requestApi(method string, path string, body any) error {
+	if r.httpClient == nil {
+		return fmt.Errorf("not logged in")
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(r.ctx, method, r.apiUrl+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func Test_requestApi(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		body   string
+	}
+	requests := []request{}
+	status := http.StatusCreated
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{r.Method, r.URL.Path, string(b)})
+		w.WriteHeader(status)
+		w.Write([]byte(`{"snapshot_id":"abc"}`))
+	}))
+	defer server.Close()
+
+	r := NewRepository(server.Client(), context.Background(), t.TempDir())
+	r.apiUrl = server.URL + "/"
+
+	uris, err := trackUris([]models.TrackContent{{Id: "1"}, {Id: "2", Type: models.TRACK_TYPE_EPISODE}})
+	assert.NoError(t, err)
+	assert.Equal(t, []spotify.URI{"spotify:track:1", "spotify:episode:2"}, uris)
+
+	assert.NoError(t, r.addPlaylistItems("p", uris))
+	status = http.StatusOK
+	assert.NoError(t, r.removePlaylistItems("p", uris))
+	assert.Equal(t, []request{
+		{http.MethodPost, "/playlists/p/tracks", `{"uris":["spotify:track:1","spotify:episode:2"]}`},
+		{http.MethodDelete, "/playlists/p/tracks", `{"tracks":[{"uri":"spotify:track:1"},{"uri":"spotify:episode:2"}]}`},
+	}, requests)
+
+	requests = []request{}
+	assert.NoError(t, r.ChangeRemotePlaylistDetail(models.PlaylistContent{Id: "p", Name: "pl", Description: "d", Public: "false", Collaborative: "true"}))
+	assert.Equal(t, []request{
+		{http.MethodPut, "/playlists/p", `{"collaborative":true,"description":"d","name":"pl","public":false}`},
+	}, requests)
+	// 共同編集のプレイリストは公開できない
+	assert.Error(t, r.ChangeRemotePlaylistDetail(models.PlaylistContent{Id: "p", Public: "true", Collaborative: "true"}))
+
+	status = http.StatusBadRequest
+	assert.Error(t, r.addPlaylistItems("p", uris))
+
+	_, err = trackUris([]models.TrackContent{{Name: "no id"}})
+	assert.Error(t, err)
+}
+
+func Test_RemoveRemoteTrack(t *testing.T) {
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.Write([]byte(`{"snapshot_id":"abc"}`))
+	}))
+	defer server.Close()
+
+	r := NewRepository(server.Client(), context.Background(), t.TempDir())
+	r.apiUrl = server.URL + "/"
+	r.client = spotify.New(server.Client(), spotify.WithBaseURL(server.URL+"/"))
+
+	// positionで指定した曲は、idで曲を削除して位置がずれる前に削除する
+	tracks := []models.TrackContent{{Id: "1"}, {Id: "2", Position: "3"}, {Id: "2", Position: "5"}}
+	assert.NoError(t, r.RemoveRemoteTrack(models.PlaylistContent{Id: "p"}, tracks))
+	assert.Equal(t, []string{
+		`{"tracks":[{"uri":"spotify:track:2","positions":[4]},{"uri":"spotify:track:2","positions":[2]}]}`,
+		`{"tracks":[{"uri":"spotify:track:1"}]}`,
+	}, bodies)
+}
@@ -3,10 +3,9 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/kajikentaro/spotify-fbc/models"
-	"github.com/kajikentaro/spotify-fbc/services/interfaces"
-	"github.com/zmb3/spotify/v2"
 )
 
 type ReadOnlyRepository struct {
@@ -15,11 +14,26 @@ type ReadOnlyRepository struct {
 	showLog        bool
 }
 
-func NewReadOnlyRepository(client *spotify.Client, ctx context.Context, rootPath string, showLog bool) interfaces.Repository {
+func NewReadOnlyRepository(client *http.Client, ctx context.Context, rootPath string, showLog bool) *ReadOnlyRepository {
 	real := NewRepository(client, ctx, rootPath)
+	// 比較やdry runでは.fbcを変更しない
+	real.memoryCache = true
 	return &ReadOnlyRepository{rootPath: rootPath, realRepository: real, showLog: showLog}
 }
 
+// キャッシュを使わずにリモートのプレイリストの曲をすべて取得する
+func (r *ReadOnlyRepository) SetFullFetch(fullFetch bool) {
+	r.realRepository.SetFullFetch(fullFetch)
+}
+
+func (r *ReadOnlyRepository) SetConcurrency(concurrency int) {
+	r.realRepository.SetConcurrency(concurrency)
+}
+
+func (r *ReadOnlyRepository) SetUndoneRunId(runId string) {
+	r.realRepository.SetUndoneRunId(runId)
+}
+
 func (r *ReadOnlyRepository) AddRemoteTrack(playlistId string, tracks []models.TrackContent, c chan []models.TrackContent) error {
 	c <- tracks
 	if r.showLog {
@@ -28,6 +42,13 @@ func (r *ReadOnlyRepository) AddRemoteTrack(playlistId string, tracks []models.T
 	return nil
 }
 
+func (r *ReadOnlyRepository) ChangeRemotePlaylistDetail(playlist models.PlaylistContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== ChangeRemotePlaylistDetail: playlist=%v\n", playlist)
+	}
+	return nil
+}
+
 func (r *ReadOnlyRepository) CleanUpPlaylistContent() ([]string, error) {
 	if r.showLog {
 		fmt.Println("===DRY RUN=== CleanUpPlaylistContent")
@@ -35,6 +56,27 @@ func (r *ReadOnlyRepository) CleanUpPlaylistContent() ([]string, error) {
 	return nil, nil
 }
 
+func (r *ReadOnlyRepository) CreateAlbumContent(album models.AlbumContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== CreateAlbumContent: album=%v\n", album)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) CreateArtistContent(artist models.ArtistContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== CreateArtistContent: artist=%v\n", artist)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) CreateExportFile(outDir string, fileName string, content string) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== CreateExportFile: outDir=%s, fileName=%s, size=%d\n", outDir, fileName, len(content))
+	}
+	return nil
+}
+
 func (r *ReadOnlyRepository) CreatePlaylistContent(playlist models.PlaylistContent) error {
 	if r.showLog {
 		fmt.Printf("===DRY RUN=== CreatePlaylistContent: playlist=%v\n", playlist)
@@ -42,6 +84,13 @@ func (r *ReadOnlyRepository) CreatePlaylistContent(playlist models.PlaylistConte
 	return nil
 }
 
+func (r *ReadOnlyRepository) CreatePlaylistCover(dirName string, img []byte) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== CreatePlaylistCover: dirName=%s, size=%d\n", dirName, len(img))
+	}
+	return nil
+}
+
 func (r *ReadOnlyRepository) CreatePlaylistDirectory(playlist models.PlaylistContent) error {
 	if r.showLog {
 		fmt.Printf("===DRY RUN=== CreatePlaylistDirectory: playlist=%v\n", playlist)
@@ -49,11 +98,11 @@ func (r *ReadOnlyRepository) CreatePlaylistDirectory(playlist models.PlaylistCon
 	return nil
 }
 
-func (r *ReadOnlyRepository) CreateRemotePlaylist(name string) (models.PlaylistContent, error) {
+func (r *ReadOnlyRepository) CreateRemotePlaylist(playlist models.PlaylistContent) (models.PlaylistContent, error) {
 	if r.showLog {
-		fmt.Printf("===DRY RUN=== CreateRemotePlaylist: name=%s\n", name)
+		fmt.Printf("===DRY RUN=== CreateRemotePlaylist: playlist=%v\n", playlist)
 	}
-	return models.PlaylistContent{Name: name, DirName: name}, nil
+	return models.PlaylistContent{Name: playlist.DirName, DirName: playlist.DirName, Description: playlist.Description, Public: playlist.Public, Collaborative: playlist.Collaborative}, nil
 }
 
 func (r *ReadOnlyRepository) CreateRootDir() error {
@@ -70,20 +119,118 @@ func (r *ReadOnlyRepository) CreateTrackContent(dirName string, track models.Tra
 	return nil
 }
 
+func (r *ReadOnlyRepository) FetchBaseSnapshot() ([]models.PlaylistSnapshot, error) {
+	return r.realRepository.FetchBaseSnapshot()
+}
+
+func (r *ReadOnlyRepository) FetchExcludedPlaylistIds() ([]string, error) {
+	return r.realRepository.FetchExcludedPlaylistIds()
+}
+
+func (r *ReadOnlyRepository) FetchHistory(id string) (models.HistorySnapshot, error) {
+	return r.realRepository.FetchHistory(id)
+}
+
+func (r *ReadOnlyRepository) FetchHistoryIds() ([]string, error) {
+	return r.realRepository.FetchHistoryIds()
+}
+
+func (r *ReadOnlyRepository) FetchJournal() ([]models.JournalEntry, error) {
+	return r.realRepository.FetchJournal()
+}
+
+func (r *ReadOnlyRepository) FetchSettings() (models.Settings, error) {
+	return r.realRepository.FetchSettings()
+}
+
+func (r *ReadOnlyRepository) FetchLibrarySnapshot() (*models.LibrarySnapshot, error) {
+	return r.realRepository.FetchLibrarySnapshot()
+}
+
+func (r *ReadOnlyRepository) FetchLocalAlbums() ([]models.AlbumContent, error) {
+	return r.realRepository.FetchLocalAlbums()
+}
+
+func (r *ReadOnlyRepository) FetchLocalArtists() ([]models.ArtistContent, error) {
+	return r.realRepository.FetchLocalArtists()
+}
+
 func (r *ReadOnlyRepository) FetchLocalPlaylistContent() ([]models.PlaylistContent, error) {
 	return r.realRepository.FetchLocalPlaylistContent()
 }
 
+func (r *ReadOnlyRepository) FetchLocalPlaylistCover(dirName string) ([]byte, error) {
+	return r.realRepository.FetchLocalPlaylistCover(dirName)
+}
+
 func (r *ReadOnlyRepository) FetchLocalPlaylistTrack(dirName string) ([]models.TrackContent, error) {
 	return r.realRepository.FetchLocalPlaylistTrack(dirName)
 }
 
+func (r *ReadOnlyRepository) FetchRemoteAlbums() ([]models.AlbumContent, error) {
+	return r.realRepository.FetchRemoteAlbums()
+}
+
+func (r *ReadOnlyRepository) FetchRemoteArtists() ([]models.ArtistContent, error) {
+	return r.realRepository.FetchRemoteArtists()
+}
+
 func (r *ReadOnlyRepository) FetchRemotePlaylistContent() ([]models.PlaylistContent, error) {
 	return r.realRepository.FetchRemotePlaylistContent()
 }
 
-func (r *ReadOnlyRepository) FetchRemotePlaylistTrack(id string) ([]models.TrackContent, error) {
-	return r.realRepository.FetchRemotePlaylistTrack(id)
+func (r *ReadOnlyRepository) FetchRemotePlaylistCover(playlist models.PlaylistContent) ([]byte, error) {
+	return r.realRepository.FetchRemotePlaylistCover(playlist)
+}
+
+func (r *ReadOnlyRepository) FetchRemotePlaylistTrack(playlist models.PlaylistContent) ([]models.TrackContent, error) {
+	return r.realRepository.FetchRemotePlaylistTrack(playlist)
+}
+
+func (r *ReadOnlyRepository) FetchRemotePlaylistTracks(playlists []models.PlaylistContent) ([][]models.TrackContent, error) {
+	return r.realRepository.FetchRemotePlaylistTracks(playlists)
+}
+
+func (r *ReadOnlyRepository) FollowRemoteArtists(artists []models.ArtistContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== FollowRemoteArtists: artists=%v\n", artists)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) FollowRemotePlaylist(playlistId string, public bool) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== FollowRemotePlaylist: playlistId=%s, public=%v\n", playlistId, public)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) RemoveAlbumContent(album models.AlbumContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== RemoveAlbumContent: album=%v\n", album)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) RemoveArtistContent(artist models.ArtistContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== RemoveArtistContent: artist=%v\n", artist)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) RemovePlaylistDirectory(playlist models.PlaylistContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== RemovePlaylistDirectory: playlist=%v\n", playlist)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) RemoveRemoteAlbums(albums []models.AlbumContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== RemoveRemoteAlbums: albums=%v\n", albums)
+	}
+	return nil
 }
 
 func (r *ReadOnlyRepository) RemoveRemotePlaylist(playlist models.PlaylistContent) error {
@@ -106,3 +253,89 @@ func (r *ReadOnlyRepository) RemoveTrackContent(dirName string, track models.Tra
 	}
 	return nil
 }
+
+func (r *ReadOnlyRepository) RenamePlaylistDirectory(playlist models.PlaylistContent, newDirName string) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== RenamePlaylistDirectory: playlist=%v, newDirName=%s\n", playlist, newDirName)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) RenameRemotePlaylist(playlist models.PlaylistContent, name string) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== RenameRemotePlaylist: playlist=%v, name=%s\n", playlist, name)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) ReorderRemoteTrack(playlist models.PlaylistContent, rangeStart int, insertBefore int) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== ReorderRemoteTrack: playlist=%v, rangeStart=%d, insertBefore=%d\n", playlist, rangeStart, insertBefore)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) ReplaceRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== ReplaceRemoteTrack: playlist=%v, tracks=%v\n", playlist, tracks)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) SaveBaseSnapshot(snapshots []models.PlaylistSnapshot) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== SaveBaseSnapshot: %d playlists\n", len(snapshots))
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) SaveHistory(history models.HistorySnapshot) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== SaveHistory: id=%s\n", history.Id())
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) SaveLibrarySnapshot(snapshot models.LibrarySnapshot) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== SaveLibrarySnapshot: %d albums, %d artists\n", len(snapshot.Albums), len(snapshot.Artists))
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) SaveRemoteAlbums(albums []models.AlbumContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== SaveRemoteAlbums: albums=%v\n", albums)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) SearchRemoteAlbum(album models.AlbumContent) (*models.AlbumContent, error) {
+	return r.realRepository.SearchRemoteAlbum(album)
+}
+
+func (r *ReadOnlyRepository) SearchRemoteArtist(artist models.ArtistContent) (*models.ArtistContent, error) {
+	return r.realRepository.SearchRemoteArtist(artist)
+}
+
+func (r *ReadOnlyRepository) SearchRemoteTrack(tracks []models.TrackContent) ([]models.TrackContent, []models.TrackContent, error) {
+	return r.realRepository.SearchRemoteTrack(tracks)
+}
+
+func (r *ReadOnlyRepository) SearchRemoteTrackCandidates(track models.TrackContent, query string) ([]models.TrackContent, error) {
+	return r.realRepository.SearchRemoteTrackCandidates(track, query)
+}
+
+func (r *ReadOnlyRepository) UnfollowRemoteArtists(artists []models.ArtistContent) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== UnfollowRemoteArtists: artists=%v\n", artists)
+	}
+	return nil
+}
+
+func (r *ReadOnlyRepository) UploadRemotePlaylistCover(playlist models.PlaylistContent, img []byte) error {
+	if r.showLog {
+		fmt.Printf("===DRY RUN=== UploadRemotePlaylistCover: playlist=%v, size=%d\n", playlist, len(img))
+	}
+	return models.ValidateCover(img)
+}
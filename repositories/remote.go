@@ -1,19 +1,91 @@
 package repositories
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/kajikentaro/spotify-fbc/models"
 	"github.com/zmb3/spotify/v2"
 )
 
+// 先頭にお気に入りの曲を含める
+// 他のユーザーのプレイリストはReadOnlyにする
+// 設定で除外されている場合は返さない
 func (r *Repository) FetchRemotePlaylistContent() ([]models.PlaylistContent, error) {
-	LIMIT := 20
+	settings, err := r.FetchSettings()
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.client.CurrentUser(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a current user info: %w", err)
+	}
 	result := []models.PlaylistContent{}
+	if settings.LikedSongs {
+		liked, err := r.fetchLikedSongsContent(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, liked)
+	}
 
+	playlists, err := r.fetchRemotePlaylists(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range playlists {
+		if v.ReadOnly && settings.ExcludeFollowed {
+			continue
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// 設定で除外されている他のユーザーのプレイリストとお気に入りの曲のidを返す
+// 除外していない場合は空
+func (r *Repository) FetchExcludedPlaylistIds() ([]string, error) {
+	settings, err := r.FetchSettings()
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	if !settings.LikedSongs {
+		result = append(result, models.LIKED_SONGS_ID)
+	}
+	if !settings.ExcludeFollowed {
+		return result, nil
+	}
+	user, err := r.client.CurrentUser(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a current user info: %w", err)
+	}
+	playlists, err := r.fetchRemotePlaylists(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range playlists {
+		if v.ReadOnly {
+			result = append(result, v.Id)
+		}
+	}
+	return result, nil
+}
+
+// ユーザーがフォローしているプレイリストをすべて返す
+// 他のユーザーのプレイリストはReadOnlyにする
+func (r *Repository) fetchRemotePlaylists(userId string) ([]models.PlaylistContent, error) {
+	LIMIT := 20
+	result := []models.PlaylistContent{}
 	for offset := 0; true; offset += LIMIT {
 		playlists, err := r.client.CurrentUsersPlaylists(r.ctx, spotify.Offset(offset), spotify.Limit(LIMIT))
 		if err != nil {
@@ -21,35 +93,71 @@ func (r *Repository) FetchRemotePlaylistContent() ([]models.PlaylistContent, err
 		}
 		for _, v := range playlists.Playlists {
 			content := models.SimplePlaylistToContent(v)
+			content.ReadOnly = v.Owner.ID != userId && !v.Collaborative
 			result = append(result, content)
 		}
 		if len(playlists.Playlists) != LIMIT {
 			break
 		}
 	}
+	return result, nil
+}
+
+// snapshot_idが前回取得した時から変わっていない場合はキャッシュを返す
+func (r *Repository) FetchRemotePlaylistTrack(playlist models.PlaylistContent) ([]models.TrackContent, error) {
+	return r.fetchRemotePlaylistTrackWithCache(r.ctx, playlist)
+}
+
+// 複数のプレイリストの曲を同時に取得し、playlistsと同じ順番で返す
+// 1つでも失敗した場合は実行中の取得を中断してエラーを返す
+func (r *Repository) FetchRemotePlaylistTracks(playlists []models.PlaylistContent) ([][]models.TrackContent, error) {
+	return parallelProcess(r.ctx, r.concurrency, playlists, r.fetchRemotePlaylistTrackWithCache)
+}
+
+func (r *Repository) fetchRemotePlaylistTrackWithCache(ctx context.Context, playlist models.PlaylistContent) ([]models.TrackContent, error) {
+	if cached, ok := r.fetchTrackCache(playlist); ok {
+		return cached, nil
+	}
 
+	result, err := r.fetchRemotePlaylistTrack(ctx, playlist.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.saveTrackCache(playlist, result); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to save the track cache: ", err.Error())
+	}
 	return result, nil
 }
 
-func (r *Repository) FetchRemotePlaylistTrack(id string) ([]models.TrackContent, error) {
+// ユーザーの国で再生できるかどうかと、再生できる同じ曲を取得するために指定する
+const MARKET_FROM_TOKEN = "from_token"
+
+func (r *Repository) fetchRemotePlaylistTrack(ctx context.Context, id string) ([]models.TrackContent, error) {
+	if id == models.LIKED_SONGS_ID {
+		return r.fetchLikedSongsTrack(ctx)
+	}
 	LIMIT := 100
 	result := []models.TrackContent{}
 	for offset := 0; true; offset += LIMIT {
-		playlistItemPage, err := r.client.GetPlaylistItems(r.ctx, spotify.ID(id), spotify.Limit(LIMIT), spotify.Offset(offset))
+		playlistItemPage, err := r.client.GetPlaylistItems(ctx, spotify.ID(id), spotify.Limit(LIMIT), spotify.Offset(offset), spotify.Market(MARKET_FROM_TOKEN))
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch playlist %s: %s", id, err)
 		}
-		for _, playlistItem := range playlistItemPage.Items {
-			if playlistItem.Track.Track == nil {
-				if playlistItem.Track.Episode != nil {
-					// TODO: PodCastの場合
-					continue
-				} else {
-					panic(fmt.Sprintf("playlist item is not track and episode: %v", playlistItem))
-				}
+		for idx, playlistItem := range playlistItemPage.Items {
+			var trackContent models.TrackContent
+			if playlistItem.IsLocal && playlistItem.Track.Track != nil {
+				trackContent = models.LocalTrackToContent(playlistItem.Track.Track)
+			} else if playlistItem.Track.Track != nil {
+				trackContent = models.FullTrackToContent(playlistItem.Track.Track)
+			} else if playlistItem.Track.Episode != nil {
+				trackContent = models.EpisodeToContent(playlistItem.Track.Episode)
+			} else {
+				// 曲でもエピソードでもないものは扱えないので飛ばす
+				// 後ろの曲の位置がずれないようにpositionは詰めない
+				fmt.Fprintf(os.Stderr, "playlist %s: item %d is neither a track nor an episode, skipped\n", id, offset+idx+1)
+				continue
 			}
-			track := playlistItem.Track.Track
-			trackContent := models.FullTrackToContent(track)
+			trackContent.Position = strconv.Itoa(offset + idx + 1)
 			result = append(result, trackContent)
 		}
 		if len(playlistItemPage.Items) != LIMIT {
@@ -59,103 +167,239 @@ func (r *Repository) FetchRemotePlaylistTrack(id string) ([]models.TrackContent,
 	return result, nil
 }
 
-func (r *Repository) CreateRemotePlaylist(name string) (models.PlaylistContent, error) {
+func (r *Repository) CreateRemotePlaylist(playlist models.PlaylistContent) (models.PlaylistContent, error) {
+	name := playlist.DirName
+	public, err := parseBoolProperty("public", playlist.Public)
+	if err != nil {
+		return models.PlaylistContent{}, err
+	}
+	collaborative, err := parseBoolProperty("collaborative", playlist.Collaborative)
+	if err != nil {
+		return models.PlaylistContent{}, err
+	}
+
 	user, err := r.client.CurrentUser(r.ctx)
 	if err != nil {
 		return models.PlaylistContent{}, fmt.Errorf("failed to get a current user info: %w", err)
 	}
-	new, err := r.client.CreatePlaylistForUser(r.ctx, user.ID, name, "", false, false)
+	new, err := r.client.CreatePlaylistForUser(r.ctx, user.ID, name, playlist.Description, public, collaborative)
 	if err != nil {
 		return models.PlaylistContent{}, fmt.Errorf("failed to create playlist %s: %w", name, err)
 	}
 	res := models.SimplePlaylistToContent(new.SimplePlaylist)
 	res.DirName = res.Name
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_CREATE_PLAYLIST, PlaylistId: res.Id, PlaylistName: res.Name})
 	return res, nil
 }
 
-func (r *Repository) addRemoteTrack(playlistId string, tracks []models.TrackContent) ([]models.TrackContent, error) {
-	if playlistId == "" {
-		return nil, fmt.Errorf("playlistId is empty")
+// プレイリストの名前、説明、公開設定と共同編集の設定をリモートに反映する
+// spotifyライブラリはcollaborativeの変更に対応していないので、APIを直接呼び出す
+func (r *Repository) ChangeRemotePlaylistDetail(playlist models.PlaylistContent) error {
+	if playlist.Id == "" {
+		return errors.New("playlist id is empty")
+	}
+	if playlist.IsLikedSongs() {
+		return errLikedSongs("changed")
+	}
+	public, err := parseBoolProperty("public", playlist.Public)
+	if err != nil {
+		return err
+	}
+	collaborative, err := parseBoolProperty("collaborative", playlist.Collaborative)
+	if err != nil {
+		return err
+	}
+	if public && collaborative {
+		return fmt.Errorf("playlist %s cannot be public and collaborative at the same time", playlist.Name)
+	}
+	body := map[string]any{"name": playlist.Name, "description": playlist.Description, "public": public, "collaborative": collaborative}
+	err = r.requestApi(http.MethodPut, "playlists/"+playlist.Id, body)
+	if err != nil {
+		return fmt.Errorf("failed to change playlist details %s: %w", playlist.Id, err)
+	}
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_CHANGE_DETAIL, PlaylistId: playlist.Id, PlaylistName: playlist.Name, OldDetail: playlist.RemoteDetail})
+	return nil
+}
+
+// 空の場合はfalseとして扱う
+func parseBoolProperty(title string, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("property %s must be true or false: '%s'", title, value)
 	}
+	return b, nil
+}
 
-	confirmedIds := []spotify.ID{}
-	confirmedTracks := []models.TrackContent{}
+// IDが無い曲は検索結果のキャッシュがあればそれを使い、検索した結果はキャッシュに保存する
+func (r *Repository) searchRemoteTrack(tracks []models.TrackContent, cache map[string]searchCacheEntry) []*models.TrackContent {
+	result := make([]*models.TrackContent, len(tracks))
 
 	// IDが存在するものから先に処理
 	inputIds := []spotify.ID{}
-	inputTracks := []models.TrackContent{} // ログ用
-	for _, v := range tracks {
+	inputIdx := []int{}
+	for i, v := range tracks {
 		if v.Id == "" {
 			continue
 		}
+		if v.IsEpisode() {
+			// エピソードは曲として検索できないので、idをそのまま使う
+			t := v
+			result[i] = &t
+			continue
+		}
 		inputIds = append(inputIds, spotify.ID(v.Id))
-		inputTracks = append(inputTracks, v)
+		inputIdx = append(inputIdx, i)
 	}
 	if len(inputIds) > 0 {
-		result, err := r.client.GetTracks(r.ctx, inputIds)
+		found, err := r.client.GetTracks(r.ctx, inputIds)
 		if err != nil {
 			// 失敗したときはIDが存在するすべてのトラックをエラーにする
-			for _, w := range inputTracks {
-				fmt.Fprintln(os.Stderr, w.FileName, "failed to search track: ", err.Error())
+			for _, i := range inputIdx {
+				fmt.Fprintln(os.Stderr, tracks[i].FileName, "failed to search track: ", err.Error())
 			}
 		} else {
-			for idx, w := range result {
+			for idx, w := range found {
+				v := tracks[inputIdx[idx]]
 				if w == nil {
-					fmt.Fprintln(os.Stderr, inputTracks[idx].FileName, "no search result found", err.Error())
+					fmt.Fprintln(os.Stderr, v.FileName, "no search result found")
 					continue
 				}
 				t := models.FullTrackToContent(w)
-				t.FileName = inputTracks[idx].FileName
-				confirmedIds = append(confirmedIds, spotify.ID(t.Id))
-				confirmedTracks = append(confirmedTracks, t)
+				t.FileName = v.FileName
+				t.Position = v.Position
+				result[inputIdx[idx]] = &t
 				fmt.Fprintln(os.Stderr, t.Name, "was found")
 			}
 		}
 	}
 
-	for _, v := range tracks {
+	for i, v := range tracks {
 		if v.Id != "" {
 			continue
 		}
+		if v.IsEpisode() {
+			fmt.Fprintln(os.Stderr, v.FileName, "episode does not have id")
+			continue
+		}
+		if v.IsLocalFile() {
+			fmt.Fprintln(os.Stderr, v.FileName, "local file cannot be added")
+			continue
+		}
+		now := time.Now()
+		if t, found, ok := lookupSearchCache(cache, v, now); ok {
+			if found {
+				result[i] = t
+				fmt.Fprintln(os.Stderr, t.Name, "was found (cached)")
+			} else {
+				fmt.Fprintln(os.Stderr, v.FileName, "no search result found (cached)")
+			}
+			continue
+		}
+
 		// IDがないときは検索する
-		res, err := r.client.Search(r.ctx, v.SearchQuery(), spotify.SearchTypeTrack, spotify.Limit(1))
-		// 30秒ごとのaccess limitがあるので1秒待機する
-		time.Sleep(time.Second * 1)
+		candidates, err := r.searchCandidates(v.SearchQuery())
 		if err != nil {
+			// 一時的な失敗かもしれないのでキャッシュしない
 			fmt.Fprintln(os.Stderr, v.FileName, "failed to search track: ", err.Error())
 			continue
 		}
-		if len(res.Tracks.Tracks) == 0 {
+		if len(candidates) == 0 {
+			storeSearchCache(cache, v, nil, now)
 			fmt.Fprintln(os.Stderr, v.FileName, "no search result found")
 			continue
 		}
-		t := models.FullTrackToContent(&res.Tracks.Tracks[0])
+		match := matchTrack(v, candidates)
+		if match.best == nil {
+			// 候補はあるので、--interactiveで選べるようにキャッシュしない
+			printUnmatchedTrack(v, match)
+			continue
+		}
+		storeSearchCache(cache, v, match.best, now)
+		t := *match.best
 		t.FileName = v.FileName
-		confirmedIds = append(confirmedIds, spotify.ID(t.Id))
-		confirmedTracks = append(confirmedTracks, t)
+		t.Position = v.Position
+		result[i] = &t
 		fmt.Fprintln(os.Stderr, t.Name, "was found")
 	}
-	if len(confirmedIds) == 0 {
-		// 検索結果が何も見つからなかった場合
-		return nil, nil
-	}
+	return result
+}
 
-	_, err := r.client.AddTracksToPlaylist(r.ctx, spotify.ID(playlistId), confirmedIds...)
+func (r *Repository) searchCandidates(query string) ([]models.TrackContent, error) {
+	res, err := r.client.Search(r.ctx, query, spotify.SearchTypeTrack, spotify.Limit(MATCH_CANDIDATES))
 	if err != nil {
 		return nil, err
 	}
-	return confirmedTracks, nil
+	candidates := []models.TrackContent{}
+	for i := range res.Tracks.Tracks {
+		candidates = append(candidates, models.FullTrackToContent(&res.Tracks.Tracks[i]))
+	}
+	return candidates, nil
+}
+
+// queryで検索した曲を、trackに近い順に返す
+// queryが空の場合はtrackの情報で検索する
+func (r *Repository) SearchRemoteTrackCandidates(track models.TrackContent, query string) ([]models.TrackContent, error) {
+	if query == "" {
+		query = track.SearchQuery()
+	}
+	candidates, err := r.searchCandidates(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search track: %w", err)
+	}
+	res := []models.TrackContent{}
+	for _, c := range matchTrack(track, candidates).candidates {
+		res = append(res, c.track)
+	}
+	return res, nil
+}
+
+// ローカルの曲に対応するリモートの曲を検索する
+// 見つかった曲と見つからなかった曲をそれぞれ入力の順番で返す
+func (r *Repository) SearchRemoteTrack(tracks []models.TrackContent) (found []models.TrackContent, notFound []models.TrackContent, err error) {
+	found = []models.TrackContent{}
+	notFound = []models.TrackContent{}
+	cache, err := r.fetchSearchCache()
+	if err != nil {
+		return nil, nil, err
+	}
+	// 50個ずつに分割して実行
+	err = splitProcess(50, tracks, func(chunk []models.TrackContent) error {
+		for i, v := range r.searchRemoteTrack(chunk, cache) {
+			if v == nil {
+				notFound = append(notFound, chunk[i])
+			} else {
+				found = append(found, *v)
+			}
+		}
+		// 途中で失敗しても検索した分は残す
+		return r.saveSearchCache(cache)
+	})
+	return found, notFound, err
 }
 
+// 検索済みの(idを持つ)曲をプレイリストの末尾に追加する
 func (r *Repository) AddRemoteTrack(playlistId string, tracks []models.TrackContent, c chan []models.TrackContent) error {
+	if playlistId == "" {
+		return fmt.Errorf("playlistId is empty")
+	}
+	if playlistId == models.LIKED_SONGS_ID {
+		return r.addLikedSongsTrack(tracks, c)
+	}
 	// 50個ずつに分割して実行
 	err := splitProcess(50, tracks, func(chunk []models.TrackContent) error {
-		doneTracks, err := r.addRemoteTrack(playlistId, chunk)
+		uris, err := trackUris(chunk)
 		if err != nil {
 			return err
 		}
+		if err := r.addPlaylistItems(playlistId, uris); err != nil {
+			return fmt.Errorf("failed to add tracks to playlist %s: %w", playlistId, err)
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_ADD_TRACKS, PlaylistId: playlistId, Tracks: chunk})
 		// 実行の途中結果をすぐに返す
-		c <- doneTracks
+		c <- chunk
 		return nil
 	})
 	return err
@@ -181,27 +425,251 @@ func splitProcess[T any](limit int, massiveArray []T, f func([]T) error) error {
 	return nil
 }
 
+// itemsをconcurrency個ずつ同時にfで処理し、itemsと同じ順番で結果を返す
+// 最初のエラーでctxをキャンセルし、実行中の処理が終わるのを待ってからそのエラーを返す
+func parallelProcess[T any, R any](ctx context.Context, concurrency int, items []T, f func(context.Context, T) (R, error)) ([]R, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]R, len(items))
+	indexes := make(chan int)
+	var once sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				res, err := f(ctx, items[i])
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				results[i] = res
+			}
+		}()
+	}
+
+send:
+	for i := range items {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// 同じ曲が複数含まれる場合もあるため、positionで指定された位置の曲だけを削除する
+// positionが無い場合は、そのidの曲をすべて削除する
 func (r *Repository) RemoveRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) error {
 	if playlist.Id == "" {
 		return errors.New("playlist id is empty")
 	}
+	if playlist.IsLikedSongs() {
+		return r.removeLikedSongsTrack(tracks)
+	}
+	tracks = withoutLocalFiles(tracks)
 
-	trackIds := []spotify.ID{}
+	uris := []spotify.URI{}
+	tracksToRemove := []spotify.TrackToRemove{}
 	for _, v := range tracks {
 		if v.Id == "" {
 			return fmt.Errorf("track %v is not have track id", v)
 		}
-		trackIds = append(trackIds, spotify.ID(v.Id))
+		position, err := strconv.Atoi(v.Position)
+		if err != nil {
+			uris = append(uris, v.ItemUri())
+			continue
+		}
+		tracksToRemove = append(tracksToRemove, spotify.TrackToRemove{URI: string(v.ItemUri()), Positions: []int{position - 1}})
 	}
 
-	err := splitProcess(50, trackIds, func(chunk []spotify.ID) error {
-		_, err := r.client.RemoveTracksFromPlaylist(r.ctx, spotify.ID(playlist.Id), chunk...)
+	// 後ろから削除すれば、前にある曲の位置はずれない
+	sort.Slice(tracksToRemove, func(i, j int) bool {
+		return tracksToRemove[i].Positions[0] > tracksToRemove[j].Positions[0]
+	})
+	positionToTrack := map[int]models.TrackContent{}
+	for _, v := range tracks {
+		if position, err := strconv.Atoi(v.Position); err == nil {
+			positionToTrack[position-1] = v
+		}
+	}
+	err := splitProcess(50, tracksToRemove, func(chunk []spotify.TrackToRemove) error {
+		_, err := r.client.RemoveTracksFromPlaylistOpt(r.ctx, spotify.ID(playlist.Id), chunk, "")
+		if err != nil {
+			return err
+		}
+		removed := []models.TrackContent{}
+		for _, v := range chunk {
+			removed = append(removed, positionToTrack[v.Positions[0]])
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REMOVE_TRACKS, PlaylistId: playlist.Id, PlaylistName: playlist.Name, Tracks: removed})
+		return nil
+	})
+	if err != nil {
 		return err
+	}
+
+	// idで削除すると曲の位置がずれるので、positionで指定された曲を削除した後に行う
+	err = splitProcess(50, uris, func(chunk []spotify.URI) error {
+		return r.removePlaylistItems(playlist.Id, chunk)
 	})
 	if err != nil {
 		return err
 	}
+	if len(uris) > 0 {
+		removed := []models.TrackContent{}
+		for _, v := range tracks {
+			if _, err := strconv.Atoi(v.Position); err != nil {
+				removed = append(removed, v)
+			}
+		}
+		r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REMOVE_TRACKS, PlaylistId: playlist.Id, PlaylistName: playlist.Name, Tracks: removed})
+	}
+	return nil
+}
+
+// ローカルファイルはAPIで削除できないので、残すことを表示して除く
+func withoutLocalFiles(tracks []models.TrackContent) []models.TrackContent {
+	res := []models.TrackContent{}
+	for _, v := range tracks {
+		if v.IsLocalFile() {
+			fmt.Fprintln(os.Stderr, v.Name, "is a local file and cannot be removed")
+			continue
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// プレイリストの曲をすべてtracksに置き換える
+func (r *Repository) ReplaceRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	if playlist.Id == "" {
+		return errors.New("playlist id is empty")
+	}
+	if playlist.IsLikedSongs() {
+		return r.replaceLikedSongsTrack(tracks)
+	}
+	// undoのために置き換える前の曲を記録する
+	oldTracks, err := r.fetchRemotePlaylistTrack(r.ctx, playlist.Id)
+	if err != nil {
+		return err
+	}
+	// ローカルファイルはAPIで追加できないので、置き換えると失われる
+	for _, v := range oldTracks {
+		if v.IsLocalFile() {
+			return fmt.Errorf("playlist %s has local files, which would be lost by replacing its tracks", playlist.Name)
+		}
+	}
 
+	uris, err := trackUris(tracks)
+	if err != nil {
+		return err
+	}
+	// 一度に置き換えられるのは100曲までなので、残りは追加する
+	first := uris
+	if len(first) > 100 {
+		first = uris[:100]
+	}
+	if _, err := r.client.ReplacePlaylistItems(r.ctx, spotify.ID(playlist.Id), first...); err != nil {
+		return fmt.Errorf("failed to replace tracks of playlist %s: %w", playlist.Id, err)
+	}
+	err = splitProcess(100, uris[len(first):], func(chunk []spotify.URI) error {
+		return r.addPlaylistItems(playlist.Id, chunk)
+	})
+	if err != nil {
+		return err
+	}
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REPLACE_TRACKS, PlaylistId: playlist.Id, PlaylistName: playlist.Name, Tracks: tracks, OldTracks: oldTracks})
+	return nil
+}
+
+func (r *Repository) RenameRemotePlaylist(playlist models.PlaylistContent, name string) error {
+	if playlist.Id == "" {
+		return errors.New("playlist id is empty")
+	}
+	if playlist.IsLikedSongs() {
+		return errLikedSongs("renamed")
+	}
+	err := r.client.ChangePlaylistName(r.ctx, spotify.ID(playlist.Id), name)
+	if err != nil {
+		return fmt.Errorf("failed to rename playlist %s: %w", playlist.Id, err)
+	}
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_RENAME_PLAYLIST, PlaylistId: playlist.Id, PlaylistName: name, OldName: playlist.Name})
+	return nil
+}
+
+// リモートのカバー画像をダウンロードする
+// カバー画像が無い場合はnilを返す
+func (r *Repository) FetchRemotePlaylistCover(playlist models.PlaylistContent) ([]byte, error) {
+	if playlist.CoverUrl == "" {
+		return nil, nil
+	}
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, playlist.CoverUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the cover of %s: %w", playlist.Name, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the cover of %s: %s", playlist.Name, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+func (r *Repository) UploadRemotePlaylistCover(playlist models.PlaylistContent, img []byte) error {
+	if playlist.Id == "" {
+		return errors.New("playlist id is empty")
+	}
+	if playlist.IsLikedSongs() {
+		return errLikedSongs("given a cover")
+	}
+	if err := models.ValidateCover(img); err != nil {
+		return err
+	}
+	err := r.client.SetPlaylistImage(r.ctx, spotify.ID(playlist.Id), bytes.NewReader(img))
+	if err != nil {
+		return fmt.Errorf("failed to upload the cover of %s: %w", playlist.Name, err)
+	}
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_UPLOAD_COVER, PlaylistId: playlist.Id, PlaylistName: playlist.Name})
+	return nil
+}
+
+// rangeStart番目(0始まり)の曲をinsertBefore番目の前に移動する
+func (r *Repository) ReorderRemoteTrack(playlist models.PlaylistContent, rangeStart int, insertBefore int) error {
+	if playlist.Id == "" {
+		return errors.New("playlist id is empty")
+	}
+	if playlist.IsLikedSongs() {
+		return errLikedSongs("reordered")
+	}
+	_, err := r.client.ReorderPlaylistTracks(r.ctx, spotify.ID(playlist.Id), spotify.PlaylistReorderOptions{
+		RangeStart:   rangeStart,
+		RangeLength:  1,
+		InsertBefore: insertBefore,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reorder playlist %s: %w", playlist.Id, err)
+	}
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REORDER_TRACK, PlaylistId: playlist.Id, PlaylistName: playlist.Name, RangeStart: rangeStart, InsertBefore: insertBefore})
 	return nil
 }
 
@@ -209,9 +677,29 @@ func (r *Repository) RemoveRemotePlaylist(playlist models.PlaylistContent) error
 	if playlist.Id == "" {
 		return errors.New("playlist id is empty")
 	}
+	if playlist.IsLikedSongs() {
+		return errLikedSongs("removed")
+	}
 	err := r.client.UnfollowPlaylist(r.ctx, spotify.ID(playlist.Id))
 	if err != nil {
 		return err
 	}
+	public, _ := parseBoolProperty("public", playlist.Public)
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_REMOVE_PLAYLIST, PlaylistId: playlist.Id, PlaylistName: playlist.Name, Public: public})
+	return nil
+}
+
+// フォローを外したプレイリストを再びフォローする
+func (r *Repository) FollowRemotePlaylist(playlistId string, public bool) error {
+	if playlistId == "" {
+		return errors.New("playlist id is empty")
+	}
+	if playlistId == models.LIKED_SONGS_ID {
+		return errLikedSongs("followed")
+	}
+	if err := r.client.FollowPlaylist(r.ctx, spotify.ID(playlistId), public); err != nil {
+		return fmt.Errorf("failed to follow playlist %s: %w", playlistId, err)
+	}
+	r.appendJournal(models.JournalEntry{Operation: models.JOURNAL_FOLLOW_PLAYLIST, PlaylistId: playlistId})
 	return nil
 }
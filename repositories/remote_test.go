@@ -1,8 +1,12 @@
 package repositories
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func Test_splitProcess(t *testing.T) {
@@ -23,3 +27,56 @@ func Test_splitProcess(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func Test_parallelProcess(t *testing.T) {
+	items := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	var running, maxRunning int32
+	actual, err := parallelProcess(context.Background(), 3, items, func(ctx context.Context, v int) (int, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		// 後の要素ほど早く終わっても順番は変わらない
+		time.Sleep(time.Duration(10-v) * time.Millisecond)
+		return v * v, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{0, 1, 4, 9, 16, 25, 36, 49, 64, 81}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Error("actual:", actual, "expected:", expected)
+	}
+	if maxRunning > 3 {
+		t.Error("too many workers:", maxRunning)
+	}
+}
+
+func Test_parallelProcess_cancel(t *testing.T) {
+	items := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	errFailed := errors.New("failed")
+	var called int32
+	_, err := parallelProcess(context.Background(), 2, items, func(ctx context.Context, v int) (int, error) {
+		atomic.AddInt32(&called, 1)
+		if v == 1 {
+			return 0, errFailed
+		}
+		// 他の処理はキャンセルされるまで待つ
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Second):
+			return v, nil
+		}
+	})
+	if !errors.Is(err, errFailed) {
+		t.Error("actual:", err, "expected:", errFailed)
+	}
+	if called == int32(len(items)) {
+		t.Error("remaining items must not be processed after the error")
+	}
+}
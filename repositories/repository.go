@@ -2,16 +2,56 @@ package repositories
 
 import (
 	"context"
+	"net/http"
+	"sync"
+
+	"github.com/kajikentaro/spotify-fbc/models"
 
 	"github.com/zmb3/spotify/v2"
 )
 
 type Repository struct {
-	client   *spotify.Client
-	ctx      context.Context
-	rootPath string
+	client *spotify.Client
+	// spotifyライブラリが対応していないAPIを呼び出すためのクライアント
+	httpClient *http.Client
+	apiUrl     string
+	ctx        context.Context
+	rootPath   string
+	// trueの場合はsnapshot_idのキャッシュを使わない
+	fullFetch bool
+	// journalに記録する実行ごとのid
+	runId string
+	// undoで元に戻している実行のid
+	undoneRunId string
+	// 複数のプレイリストの曲を同時に取得する数
+	concurrency int
+	// trueの場合はキャッシュを.fbcに書き込まず、メモリにだけ残す
+	memoryCache bool
+	searchCache map[string]searchCacheEntry
+	// memoryCacheの場合に取得した曲 (プレイリストのidがキー)
+	// 複数のプレイリストの曲を同時に取得するのでmutexで守る
+	trackCaches     map[string]trackCache
+	trackCachesLock sync.Mutex
+	// SetSettingsで指定された、まだ保存していない設定
+	settings *models.Settings
+}
+
+const DEFAULT_CONCURRENCY = 4
+
+// httpClientは認証済みのクライアント
+func NewRepository(httpClient *http.Client, ctx context.Context, rootPath string) *Repository {
+	return &Repository{client: spotify.New(httpClient), httpClient: httpClient, apiUrl: SPOTIFY_API_URL, ctx: ctx, rootPath: rootPath, runId: newRunId(), concurrency: DEFAULT_CONCURRENCY}
+}
+
+// キャッシュを使わずにリモートのプレイリストの曲をすべて取得する
+func (r *Repository) SetFullFetch(fullFetch bool) {
+	r.fullFetch = fullFetch
 }
 
-func NewRepository(client *spotify.Client, ctx context.Context, rootPath string) *Repository {
-	return &Repository{client: client, ctx: ctx, rootPath: rootPath}
+// 1未満の場合は1つずつ取得する
+func (r *Repository) SetConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	r.concurrency = concurrency
 }
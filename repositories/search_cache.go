@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+const SEARCH_CACHE_FILE_NAME = "search_cache.json"
+
+// 見つからなかった検索結果を再検索するまでの期間
+const SEARCH_CACHE_NOT_FOUND_TTL = 7 * 24 * time.Hour
+
+type searchCacheEntry struct {
+	// 検索結果が0件だった場合はnil
+	Track *models.TrackContent `json:"track"`
+	Time  time.Time            `json:"time"`
+}
+
+func (e searchCacheEntry) expired(now time.Time) bool {
+	return e.Track == nil && now.Sub(e.Time) > SEARCH_CACHE_NOT_FOUND_TTL
+}
+
+// 検索に使う値を正規化したものをキャッシュのキーにする
+func searchCacheKey(track models.TrackContent) string {
+	if track.Isrc != "" {
+		return "isrc:" + strings.ToUpper(track.Isrc)
+	}
+	seconds := ""
+	if s, ok := models.ParseSeconds(track.Seconds); ok {
+		seconds = strconv.Itoa(s)
+	}
+	return strings.Join([]string{normalizeText(track.Name), normalizeText(track.Artist), normalizeText(track.Album), seconds}, "|")
+}
+
+func (r *Repository) fetchSearchCache() (map[string]searchCacheEntry, error) {
+	if r.searchCache != nil {
+		return r.searchCache, nil
+	}
+	cache := map[string]searchCacheEntry{}
+	if _, err := r.readMetadata(SEARCH_CACHE_FILE_NAME, &cache); err != nil {
+		return nil, err
+	}
+	if r.memoryCache {
+		r.searchCache = cache
+	}
+	return cache, nil
+}
+
+// memoryCacheがtrueの場合はfetchSearchCacheで返したmapに残るので書き込まない
+func (r *Repository) saveSearchCache(cache map[string]searchCacheEntry) error {
+	if r.memoryCache {
+		return nil
+	}
+	return r.writeMetadata(SEARCH_CACHE_FILE_NAME, cache)
+}
+
+// キャッシュされた検索結果を返す
+// 見つからなかった結果はfoundがfalseになる
+func lookupSearchCache(cache map[string]searchCacheEntry, track models.TrackContent, now time.Time) (result *models.TrackContent, found bool, ok bool) {
+	entry, ok := cache[searchCacheKey(track)]
+	if !ok || entry.expired(now) {
+		return nil, false, false
+	}
+	if entry.Track == nil {
+		return nil, false, true
+	}
+	t := *entry.Track
+	t.FileName = track.FileName
+	t.Position = track.Position
+	return &t, true, true
+}
+
+func storeSearchCache(cache map[string]searchCacheEntry, track models.TrackContent, result *models.TrackContent, now time.Time) {
+	entry := searchCacheEntry{Time: now}
+	if result != nil {
+		t := *result
+		t.FileName = ""
+		t.Position = ""
+		entry.Track = &t
+	}
+	cache[searchCacheKey(track)] = entry
+}
+
+type SearchCacheStats struct {
+	Found    int
+	NotFound int
+	// 期限が切れていて次回は再検索される数
+	Expired int
+}
+
+func (r *Repository) FetchSearchCacheStats() (SearchCacheStats, error) {
+	cache, err := r.fetchSearchCache()
+	if err != nil {
+		return SearchCacheStats{}, err
+	}
+	res := SearchCacheStats{}
+	now := time.Now()
+	for _, v := range cache {
+		if v.expired(now) {
+			res.Expired++
+		} else if v.Track == nil {
+			res.NotFound++
+		} else {
+			res.Found++
+		}
+	}
+	return res, nil
+}
+
+func (r *Repository) ClearSearchCache() error {
+	r.searchCache = nil
+	err := os.Remove(r.metadataPath(SEARCH_CACHE_FILE_NAME))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify/v2"
+)
+
+func Test_SearchCache(t *testing.T) {
+	r := NewRepository(nil, context.Background(), t.TempDir())
+	now := time.Now()
+
+	cache, err := r.fetchSearchCache()
+	assert.NoError(t, err)
+	assert.Empty(t, cache)
+
+	local := models.TrackContent{Name: "What Do You Mean?", Artist: "Justin Bieber", FileName: "a.txt", Position: "3"}
+	remote := models.TrackContent{Id: "1", Name: "What Do You Mean?", Artist: "Justin Bieber", FileName: "a.txt", Position: "3"}
+	missing := models.TrackContent{Name: "unknown", FileName: "b.txt"}
+	expired := models.TrackContent{Name: "expired", FileName: "c.txt"}
+	storeSearchCache(cache, local, &remote, now)
+	storeSearchCache(cache, missing, nil, now)
+	storeSearchCache(cache, expired, nil, now.Add(-SEARCH_CACHE_NOT_FOUND_TTL-time.Hour))
+	assert.NoError(t, r.saveSearchCache(cache))
+
+	cache, err = r.fetchSearchCache()
+	assert.NoError(t, err)
+
+	// 大文字小文字や記号の違いは同じ検索とみなす
+	result, found, ok := lookupSearchCache(cache, models.TrackContent{Name: "what do you mean", Artist: "justin bieber", FileName: "d.txt"}, now)
+	assert.True(t, ok)
+	assert.True(t, found)
+	assert.Equal(t, "1", result.Id)
+	assert.Equal(t, "d.txt", result.FileName)
+
+	_, found, ok = lookupSearchCache(cache, missing, now)
+	assert.True(t, ok)
+	assert.False(t, found)
+
+	_, _, ok = lookupSearchCache(cache, expired, now)
+	assert.False(t, ok)
+
+	stats, err := r.FetchSearchCacheStats()
+	assert.NoError(t, err)
+	assert.Equal(t, SearchCacheStats{Found: 1, NotFound: 1, Expired: 1}, stats)
+
+	assert.NoError(t, r.ClearSearchCache())
+	assert.NoError(t, r.ClearSearchCache())
+	stats, err = r.FetchSearchCacheStats()
+	assert.NoError(t, err)
+	assert.Equal(t, SearchCacheStats{}, stats)
+}
+
+func Test_SearchCache_memoryCache(t *testing.T) {
+	root := t.TempDir()
+	r := NewReadOnlyRepository(nil, context.Background(), root, false).realRepository
+	now := time.Now()
+
+	cache, err := r.fetchSearchCache()
+	assert.NoError(t, err)
+	local := models.TrackContent{Name: "What Do You Mean?", Artist: "Justin Bieber"}
+	storeSearchCache(cache, local, &models.TrackContent{Id: "1", Name: "What Do You Mean?"}, now)
+	assert.NoError(t, r.saveSearchCache(cache))
+	assert.NoError(t, r.saveTrackCache(models.PlaylistContent{Id: "p", SnapshotId: "s"}, []models.TrackContent{{Id: "1"}}))
+
+	// .fbcには何も書き込まない
+	_, err = os.Stat(filepath.Join(root, METADATA_DIR_NAME))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// 検索結果はメモリに残る
+	cache, err = r.fetchSearchCache()
+	assert.NoError(t, err)
+	result, found, ok := lookupSearchCache(cache, local, now)
+	assert.True(t, ok)
+	assert.True(t, found)
+	assert.Equal(t, "1", result.Id)
+
+	// 取得した曲もメモリに残る
+	tracks, ok := r.fetchTrackCache(models.PlaylistContent{Id: "p", SnapshotId: "s"})
+	assert.True(t, ok)
+	assert.Equal(t, []models.TrackContent{{Id: "1"}}, tracks)
+	_, ok = r.fetchTrackCache(models.PlaylistContent{Id: "p", SnapshotId: "changed"})
+	assert.False(t, ok)
+}
+
+func Test_searchRemoteTrack_cache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Query().Get("q"), "unknown") {
+			w.Write([]byte(`{"tracks":{"items":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"tracks":{"items":[{"id":"1","name":"Something Else","artists":[{"name":"someone"}],"album":{"name":"other"}}]}}`))
+	}))
+	defer server.Close()
+
+	r := NewRepository(server.Client(), context.Background(), t.TempDir())
+	r.client = spotify.New(server.Client(), spotify.WithBaseURL(server.URL+"/"))
+
+	missing := models.TrackContent{Name: "unknown", FileName: "a.txt"}
+	weak := models.TrackContent{Name: "What Do You Mean?", Artist: "Justin Bieber", FileName: "b.txt"}
+	cache := map[string]searchCacheEntry{}
+	result := r.searchRemoteTrack([]models.TrackContent{missing, weak}, cache)
+	assert.Equal(t, []*models.TrackContent{nil, nil}, result)
+
+	// 検索結果が0件の場合だけキャッシュし、近い曲が無かった場合は候補を選べるように次回も検索する
+	_, found, ok := lookupSearchCache(cache, missing, time.Now())
+	assert.True(t, ok)
+	assert.False(t, found)
+	_, _, ok = lookupSearchCache(cache, weak, time.Now())
+	assert.False(t, ok)
+}
@@ -0,0 +1,27 @@
+package repositories
+
+import "github.com/kajikentaro/spotify-fbc/models"
+
+const SETTINGS_FILE_NAME = "settings.json"
+
+// 設定ファイルが無い場合は初期値を返す
+// SetSettingsで設定を指定した場合はそれを返す
+func (r *Repository) FetchSettings() (models.Settings, error) {
+	if r.settings != nil {
+		return *r.settings, nil
+	}
+	result := models.Settings{}
+	if _, err := r.readMetadata(SETTINGS_FILE_NAME, &result); err != nil {
+		return models.Settings{}, err
+	}
+	return result, nil
+}
+
+// 保存せずに、このRepositoryでだけ使う設定を指定する
+func (r *Repository) SetSettings(settings models.Settings) {
+	r.settings = &settings
+}
+
+func (r *Repository) SaveSettings(settings models.Settings) error {
+	return r.writeMetadata(SETTINGS_FILE_NAME, settings)
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+)
+
+const (
+	COMPARE_FORMAT_TEXT = "text"
+	COMPARE_FORMAT_JSON = "json"
+	COMPARE_FORMAT_DIFF = "diff"
+)
+
+// ローカルとリモートの差分をformatの形式でwに出力する
+// 差分があればtrueを返す
+func (m *service) ComparePlaylists(format string, w io.Writer) (bool, error) {
+	if format != COMPARE_FORMAT_TEXT && format != COMPARE_FORMAT_JSON && format != COMPARE_FORMAT_DIFF {
+		return false, fmt.Errorf("unknown format: %s", format)
+	}
+
+	fmt.Fprintln(os.Stderr, "now loading ...")
+	compare := service_compares.NewCompare(m.repository)
+	plans, err := compare.PlanAllPlaylist()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, v := range plans {
+		changed = changed || v.HasDifference()
+	}
+
+	switch format {
+	case COMPARE_FORMAT_JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return changed, encoder.Encode(plans)
+	case COMPARE_FORMAT_DIFF:
+		for _, v := range plans {
+			if !v.HasDifference() {
+				continue
+			}
+			if _, err := io.WriteString(w, unifiedDiff(v.PlaylistTrackDiff)); err != nil {
+				return changed, err
+			}
+		}
+		return changed, nil
+	}
+	return changed, writePlanText(w, plans)
+}
+
+// overwriteで行われる変更を、実行した場合と同じ形式で出力する
+func writePlanText(w io.Writer, plans []service_compares.PlaylistPlan) error {
+	sb := strings.Builder{}
+	changed := false
+	for _, v := range plans {
+		changed = changed || v.HasDifference()
+		pl := v.Playlist
+		if v.Skipped {
+			if pl.V.IsLikedSongs() && pl.DiffState == service_compares.LocalOnly {
+				sb.WriteString("! " + pl.V.DirName + " (pull --liked-songs is not enabled. local changes are ignored)\n")
+			} else if pl.DiffState != service_compares.RemoteOnly && v.PlaylistTrackDiff.HasDifference() {
+				sb.WriteString("! " + pl.V.Name + " (not owned by you. local changes are ignored)\n")
+			}
+			continue
+		}
+		switch pl.DiffState {
+		case service_compares.LocalOnly:
+			sb.WriteString("+ " + pl.V.DirName + "\n")
+		case service_compares.RemoteOnly:
+			sb.WriteString("- " + pl.V.Name + "\n")
+			for _, t := range v.RemovedTracks {
+				sb.WriteString("  - " + t.Name + "\n")
+			}
+			continue
+		default:
+			if pl.V.OldDirName != "" {
+				sb.WriteString("~ " + pl.V.OldDirName + " -> " + pl.V.DirName + "\n")
+			} else {
+				sb.WriteString("  " + pl.V.Name + "\n")
+			}
+			for _, c := range pl.V.ChangedDetails() {
+				sb.WriteString("  ~ " + c + "\n")
+			}
+		}
+		if v.CoverChanged {
+			sb.WriteString("  ~ cover\n")
+		} else if v.RemoteCoverChanged {
+			sb.WriteString("  ! cover (changed on remote. run pull to download it)\n")
+		}
+		for _, t := range v.AddedTracks {
+			sb.WriteString(fmt.Sprintf("  + %s -> %s (%s)\n", t.FileName, t.Name, t.Id))
+		}
+		for _, t := range v.NotFoundTracks {
+			sb.WriteString("  ? " + t.FileName + " (not found)\n")
+		}
+		for _, t := range v.RemovedTracks {
+			sb.WriteString("  - " + t.Name + "\n")
+		}
+		for _, t := range v.KeptTracks {
+			sb.WriteString("  ! " + t.Name + " (local file. cannot be removed)\n")
+		}
+		idToFileName := v.IdToFileName()
+		for _, move := range v.Moves {
+			sb.WriteString("  ~ " + idToFileName[move.Id] + "\n")
+		}
+	}
+	if !changed {
+		sb.WriteString("\nthere was no change on remote\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// リモートを変更前、ローカルを変更後とした unified diff 形式の文字列を返す
+func unifiedDiff(v service_compares.PlaylistTrackDiff) string {
+	pl := v.Playlist
+	remoteName := "remote/" + pl.V.Name
+	localName := "local/" + pl.V.DirName
+	if pl.V.OldName != "" {
+		remoteName = "remote/" + pl.V.OldName
+	}
+	if pl.DiffState == service_compares.LocalOnly {
+		remoteName = "/dev/null"
+	}
+	if pl.DiffState == service_compares.RemoteOnly {
+		localName = "/dev/null"
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("--- " + remoteName + "\n")
+	sb.WriteString("+++ " + localName + "\n")
+
+	// プレイリストのプロパティ
+	if pl.DiffState == service_compares.Both {
+		remoteLines := []string{}
+		localLines := []string{}
+		if pl.V.OldDirName != "" {
+			remoteLines = append(remoteLines, "name "+pl.V.Name)
+			localLines = append(localLines, "name "+pl.V.DirName)
+		}
+		if pl.V.RemoteDetail != nil {
+			remoteDetail := *pl.V.RemoteDetail
+			localDetail := pl.V.Detail()
+			for _, field := range pl.V.ChangedDetails() {
+				remoteLines = append(remoteLines, field+" "+detailValue(remoteDetail, field))
+				localLines = append(localLines, field+" "+detailValue(localDetail, field))
+			}
+		}
+		if len(remoteLines) > 0 {
+			sb.WriteString(fmt.Sprintf("@@ -1,%d +1,%d @@ properties\n", len(remoteLines), len(localLines)))
+			for _, l := range remoteLines {
+				sb.WriteString("-" + l + "\n")
+			}
+			for _, l := range localLines {
+				sb.WriteString("+" + l + "\n")
+			}
+		}
+	}
+
+	remoteKeys, localKeys, labels := trackDiffKeys(v)
+	if len(remoteKeys) == 0 && len(localKeys) == 0 {
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("@@ -%s +%s @@ tracks\n", hunkRange(len(remoteKeys)), hunkRange(len(localKeys))))
+	for _, l := range diffLines(remoteKeys, localKeys) {
+		sb.WriteString(l.prefix + labels[l.key] + "\n")
+	}
+	return sb.String()
+}
+
+func detailValue(detail models.PlaylistDetail, field string) string {
+	switch field {
+	case "description":
+		return detail.Description
+	case "public":
+		return detail.Public
+	case "collaborative":
+		return detail.Collaborative
+	}
+	return ""
+}
+
+func hunkRange(length int) string {
+	if length == 0 {
+		return "0,0"
+	}
+	return fmt.Sprintf("1,%d", length)
+}
+
+// リモートとローカルの曲の並びを、対応する曲が同じになるキーの列に変換する
+// 同じidの曲はそれぞれの並びでの出現順に対応させる
+func trackDiffKeys(v service_compares.PlaylistTrackDiff) (remoteKeys []string, localKeys []string, labels map[string]string) {
+	labels = map[string]string{}
+	fileNameToTrack := map[string]models.TrackContent{}
+	idToName := map[string]string{}
+	for _, w := range v.Tracks {
+		if w.DiffState != service_compares.RemoteOnly {
+			fileNameToTrack[w.V.FileName] = w.V
+		}
+		if w.DiffState != service_compares.LocalOnly {
+			idToName[w.V.Key()] = w.V.Name
+		}
+	}
+
+	count := map[string]int{}
+	for _, id := range v.RemoteOrder {
+		count[id]++
+		key := fmt.Sprintf("%s#%d", id, count[id])
+		remoteKeys = append(remoteKeys, key)
+		labels[key] = idToName[id]
+	}
+
+	count = map[string]int{}
+	for _, fileName := range v.LocalOrder {
+		track := fileNameToTrack[fileName]
+		key := "file:" + fileName
+		if track.Key() != "" {
+			count[track.Key()]++
+			key = fmt.Sprintf("%s#%d", track.Key(), count[track.Key()])
+		}
+		localKeys = append(localKeys, key)
+		labels[key] = fileName
+	}
+	return remoteKeys, localKeys, labels
+}
+
+type diffLine struct {
+	prefix string
+	key    string
+}
+
+// 最長共通部分列を使って a から b への差分を行単位で返す
+func diffLines(a []string, b []string) []diffLine {
+	// lcs[i][j]: a[i:]とb[j:]の最長共通部分列の長さ
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	res := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			res = append(res, diffLine{prefix: " ", key: a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			res = append(res, diffLine{prefix: "-", key: a[i]})
+			i++
+		} else {
+			res = append(res, diffLine{prefix: "+", key: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		res = append(res, diffLine{prefix: "-", key: a[i]})
+	}
+	for ; j < len(b); j++ {
+		res = append(res, diffLine{prefix: "+", key: b[j]})
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+)
+
+func Test_unifiedDiff(t *testing.T) {
+	remoteDetail := models.PlaylistDetail{Description: "old", Public: "true"}
+	diff := service_compares.PlaylistTrackDiff{
+		Playlist: service_compares.WithDiffState[models.PlaylistContent]{
+			V:         models.PlaylistContent{Id: "p", Name: "pl", DirName: "pl", Description: "new", Public: "true", RemoteDetail: &remoteDetail},
+			DiffState: service_compares.Both,
+		},
+		Tracks: []service_compares.WithDiffState[models.TrackContent]{
+			{V: models.TrackContent{FileName: "d.txt"}, DiffState: service_compares.LocalOnly},
+			{V: models.TrackContent{Id: "c", Name: "c"}, DiffState: service_compares.RemoteOnly},
+			{V: models.TrackContent{Id: "a", Name: "a", FileName: "a.txt"}, DiffState: service_compares.Both},
+			{V: models.TrackContent{Id: "b", Name: "b", FileName: "b.txt"}, DiffState: service_compares.Both},
+		},
+		LocalOrder:  []string{"a.txt", "d.txt", "b.txt"},
+		RemoteOrder: []string{"a", "c", "b"},
+	}
+
+	actual := unifiedDiff(diff)
+	expected := `--- remote/pl
++++ local/pl
+@@ -1,1 +1,1 @@ properties
+-description old
++description new
+@@ -1,3 +1,3 @@ tracks
+ a.txt
+-c
++d.txt
+ b.txt
+`
+	if actual != expected {
+		t.Errorf("\nactual:\n%s\nexpected:\n%s", actual, expected)
+	}
+	if !diff.HasDifference() {
+		t.Errorf("HasDifference must be true")
+	}
+}
+
+func Test_diffLines(t *testing.T) {
+	actual := diffLines([]string{"a", "b", "c"}, []string{"b", "c", "a"})
+	expected := []diffLine{{"-", "a"}, {" ", "b"}, {" ", "c"}, {"+", "a"}}
+	if len(actual) != len(expected) {
+		t.Fatalf("actual: %v, expected: %v", actual, expected)
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Errorf("actual: %v, expected: %v", actual, expected)
+		}
+	}
+}
+
+func Test_writePlanText(t *testing.T) {
+	plans := []service_compares.PlaylistPlan{
+		{
+			PlaylistTrackDiff: service_compares.PlaylistTrackDiff{
+				Playlist: service_compares.WithDiffState[models.PlaylistContent]{
+					V:         models.PlaylistContent{DirName: "new"},
+					DiffState: service_compares.LocalOnly,
+				},
+			},
+			AddedTracks:    []models.TrackContent{{Id: "1", Name: "found", FileName: "a.txt"}},
+			NotFoundTracks: []models.TrackContent{{FileName: "b.txt"}},
+		},
+		{
+			PlaylistTrackDiff: service_compares.PlaylistTrackDiff{
+				Playlist: service_compares.WithDiffState[models.PlaylistContent]{
+					V:         models.PlaylistContent{Id: "p", Name: "old"},
+					DiffState: service_compares.RemoteOnly,
+				},
+			},
+			RemovedTracks: []models.TrackContent{{Id: "2", Name: "removed"}},
+		},
+		{
+			PlaylistTrackDiff: service_compares.PlaylistTrackDiff{
+				Playlist: service_compares.WithDiffState[models.PlaylistContent]{
+					V:         models.PlaylistContent{Id: "c", Name: "cover", DirName: "cover"},
+					DiffState: service_compares.Both,
+				},
+			},
+			RemoteCoverChanged: true,
+		},
+	}
+
+	sb := strings.Builder{}
+	if err := writePlanText(&sb, plans); err != nil {
+		t.Fatal(err)
+	}
+	expected := `+ new
+  + a.txt -> found (1)
+  ? b.txt (not found)
+- old
+  - removed
+  cover
+  ! cover (changed on remote. run pull to download it)
+`
+	if sb.String() != expected {
+		t.Errorf("\nactual:\n%s\nexpected:\n%s", sb.String(), expected)
+	}
+}
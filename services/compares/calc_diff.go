@@ -1,60 +1,102 @@
 package service_compares
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type DiffState int
 
 const (
 	LocalOnly DiffState = iota + 1
 	RemoteOnly
 	Both
+	// 両方に存在するが、プレイリスト内での順番が異なる
+	Moved
 )
 
+func (d DiffState) String() string {
+	switch d {
+	case LocalOnly:
+		return "local_only"
+	case RemoteOnly:
+		return "remote_only"
+	case Both:
+		return "both"
+	case Moved:
+		return "moved"
+	}
+	return "unknown"
+}
+
+func (d DiffState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *DiffState) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for _, v := range []DiffState{LocalOnly, RemoteOnly, Both, Moved} {
+		if v.String() == s {
+			*d = v
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid diff state: %s", s)
+}
+
 type WithDiffState[T any] struct {
-	V         T
-	DiffState DiffState
+	V         T         `json:"value"`
+	DiffState DiffState `json:"diff_state"`
 }
 
+// 同じidが複数回現れる場合は、localとremoteで出現順に1つずつ対応させる
 func calcDiff[T any](local []T, remote []T, getId func(T) string, merge func(local T, remote T) T) []WithDiffState[T] {
-	res := []WithDiffState[T]{}
+	localOnly := []WithDiffState[T]{}
+	remoteOnly := []WithDiffState[T]{}
+	both := []WithDiffState[T]{}
 
-	idToPlaylist := map[string]WithDiffState[T]{}
-	for _, v := range remote {
+	// idごとにまだ対応していないremoteのindexを出現順に保持する
+	idToRemoteIdx := map[string][]int{}
+	for i, v := range remote {
 		id := getId(v)
-		idToPlaylist[id] = WithDiffState[T]{V: v, DiffState: RemoteOnly} // まずRemoteOnlyで登録しておく
+		idToRemoteIdx[id] = append(idToRemoteIdx[id], i)
 	}
+
+	matched := make([]bool, len(remote))
 	for _, v := range local {
 		id := getId(v)
 		if id == "" {
 			// ユーザーが作成してSyncされていないプレイリストはIDが空になる
-			// この時点でLocalOnlyが確定するので、resに追加
-			res = append(res, WithDiffState[T]{V: v, DiffState: LocalOnly})
+			// この時点でLocalOnlyが確定する
+			localOnly = append(localOnly, WithDiffState[T]{V: v, DiffState: LocalOnly})
 			continue
 		}
 
-		remote, ok := idToPlaylist[id]
-		if ok {
+		if queue := idToRemoteIdx[id]; len(queue) > 0 {
 			// Remoteにも存在する場合
-			idToPlaylist[id] = WithDiffState[T]{V: merge(v, remote.V), DiffState: Both}
+			idToRemoteIdx[id] = queue[1:]
+			matched[queue[0]] = true
+			both = append(both, WithDiffState[T]{V: merge(v, remote[queue[0]]), DiffState: Both})
 		} else {
 			// Remoteに存在しない場合
-			idToPlaylist[id] = WithDiffState[T]{V: v, DiffState: LocalOnly}
+			localOnly = append(localOnly, WithDiffState[T]{V: v, DiffState: LocalOnly})
 		}
 	}
 
-	// LocalOnly -> RemoteOnly -> Bothの順でresに追加する
-	for _, v := range idToPlaylist {
-		if v.DiffState == LocalOnly {
-			res = append(res, v)
-		}
-	}
-	for _, v := range idToPlaylist {
-		if v.DiffState == RemoteOnly {
-			res = append(res, v)
-		}
-	}
-	for _, v := range idToPlaylist {
-		if v.DiffState == Both {
-			res = append(res, v)
+	for i, v := range remote {
+		if !matched[i] {
+			remoteOnly = append(remoteOnly, WithDiffState[T]{V: v, DiffState: RemoteOnly})
 		}
 	}
+
+	// LocalOnly -> RemoteOnly -> Bothの順で返す
+	// 各グループ内では入力の順番を保つ
+	res := []WithDiffState[T]{}
+	res = append(res, localOnly...)
+	res = append(res, remoteOnly...)
+	res = append(res, both...)
 	return res
 }
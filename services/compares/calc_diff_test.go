@@ -58,6 +58,19 @@ func TestCalcDiff(t *testing.T) {
 				{V: "b", DiffState: Both},
 			},
 		},
+		{
+			name: "duplicated",
+			args: args{
+				local:  []string{"a", "a", "b"},
+				remote: []string{"a", "b", "b"},
+			},
+			want: []WithDiffState[string]{
+				{V: "a", DiffState: LocalOnly},
+				{V: "b", DiffState: RemoteOnly},
+				{V: "a", DiffState: Both},
+				{V: "b", DiffState: Both},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
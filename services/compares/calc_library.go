@@ -0,0 +1,29 @@
+package service_compares
+
+import "github.com/kajikentaro/spotify-fbc/models"
+
+// 保存したアルバムのtxtとリモートの差分を計算する
+func CalcDiffAlbum(local []models.AlbumContent, remote []models.AlbumContent) []WithDiffState[models.AlbumContent] {
+	return calcDiffLibrary(local, remote, func(v models.AlbumContent) string { return v.Id })
+}
+
+// フォローしたアーティストのtxtとリモートの差分を計算する
+func CalcDiffArtist(local []models.ArtistContent, remote []models.ArtistContent) []WithDiffState[models.ArtistContent] {
+	return calcDiffLibrary(local, remote, func(v models.ArtistContent) string { return v.Id })
+}
+
+// ライブラリには同じものを2回保存できないので、同じidのtxtが複数あっても1つとして扱う
+// 両方にある場合はファイル名を持つローカルの値を使う
+func calcDiffLibrary[T any](local []T, remote []T, getId func(T) string) []WithDiffState[T] {
+	seen := map[string]bool{}
+	unique := []T{}
+	for _, v := range local {
+		id := getId(v)
+		if id != "" && seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, v)
+	}
+	return calcDiff(unique, remote, getId, func(local T, remote T) T { return local })
+}
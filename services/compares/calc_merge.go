@@ -0,0 +1,77 @@
+package service_compares
+
+type MergeState int
+
+const (
+	Unchanged MergeState = iota + 1
+	// baseから見てローカルで追加された
+	LocalAdded
+	// baseから見てローカルで削除された
+	LocalRemoved
+	// baseから見てリモートで追加された
+	RemoteAdded
+	// baseから見てリモートで削除された
+	RemoteRemoved
+	// ローカルとリモートの両方で矛盾する変更がされた
+	Conflict
+)
+
+type WithMergeState[T any] struct {
+	V          T
+	MergeState MergeState
+}
+
+// baseIdsを共通の祖先としてlocalとremoteの3-way mergeを行う
+// 両方で追加された/削除されたものは変更なしとして扱う
+// 同じidが複数回現れる場合は個数で判定する
+func calcMerge[T any](baseIds []string, local []T, remote []T, getId func(T) string, merge func(local T, remote T) T) []WithMergeState[T] {
+	baseCount := map[string]int{}
+	for _, id := range baseIds {
+		baseCount[id]++
+	}
+	localCount := map[string]int{}
+	for _, v := range local {
+		localCount[getId(v)]++
+	}
+	remoteCount := map[string]int{}
+	for _, v := range remote {
+		remoteCount[getId(v)]++
+	}
+
+	// 片方にしか無いもののうち、baseに存在していた(もう片方で削除された)ものの個数
+	removedCount := func(id string, own int, other int) int {
+		n := own
+		if baseCount[id] < n {
+			n = baseCount[id]
+		}
+		if n-other < 0 {
+			return 0
+		}
+		return n - other
+	}
+
+	res := []WithMergeState[T]{}
+	seen := map[string]int{}
+	for _, v := range calcDiff(local, remote, getId, merge) {
+		id := getId(v.V)
+		switch v.DiffState {
+		case Both:
+			res = append(res, WithMergeState[T]{V: v.V, MergeState: Unchanged})
+		case LocalOnly:
+			seen["local "+id]++
+			if id != "" && seen["local "+id] <= removedCount(id, localCount[id], remoteCount[id]) {
+				res = append(res, WithMergeState[T]{V: v.V, MergeState: RemoteRemoved})
+			} else {
+				res = append(res, WithMergeState[T]{V: v.V, MergeState: LocalAdded})
+			}
+		case RemoteOnly:
+			seen["remote "+id]++
+			if seen["remote "+id] <= removedCount(id, remoteCount[id], localCount[id]) {
+				res = append(res, WithMergeState[T]{V: v.V, MergeState: LocalRemoved})
+			} else {
+				res = append(res, WithMergeState[T]{V: v.V, MergeState: RemoteAdded})
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,223 @@
+package service_compares
+
+import (
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcMerge(t *testing.T) {
+	type args struct {
+		base   []string
+		local  []string
+		remote []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []WithMergeState[string]
+	}{
+		{
+			name: "no change",
+			args: args{
+				base:   []string{"a", "b"},
+				local:  []string{"a", "b"},
+				remote: []string{"a", "b"},
+			},
+			want: []WithMergeState[string]{
+				{V: "a", MergeState: Unchanged},
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "added",
+			args: args{
+				base:   []string{"a"},
+				local:  []string{"a", "b"},
+				remote: []string{"a", "c"},
+			},
+			want: []WithMergeState[string]{
+				{V: "b", MergeState: LocalAdded},
+				{V: "c", MergeState: RemoteAdded},
+				{V: "a", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "removed",
+			args: args{
+				base:   []string{"a", "b", "c"},
+				local:  []string{"a", "b"},
+				remote: []string{"a", "c"},
+			},
+			want: []WithMergeState[string]{
+				{V: "b", MergeState: RemoteRemoved},
+				{V: "c", MergeState: LocalRemoved},
+				{V: "a", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "no base",
+			args: args{
+				base:   []string{},
+				local:  []string{"a", "b"},
+				remote: []string{"b", "c"},
+			},
+			want: []WithMergeState[string]{
+				{V: "a", MergeState: LocalAdded},
+				{V: "c", MergeState: RemoteAdded},
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "duplicated",
+			args: args{
+				base:   []string{"a", "a", "b"},
+				local:  []string{"a", "b", "b"},
+				remote: []string{"a", "a", "b"},
+			},
+			want: []WithMergeState[string]{
+				{V: "b", MergeState: LocalAdded},
+				{V: "a", MergeState: LocalRemoved},
+				{V: "a", MergeState: Unchanged},
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getId := func(s string) string { return s }
+			merge := func(local, remote string) string { return local }
+
+			actual := calcMerge(tt.args.base, tt.args.local, tt.args.remote, getId, merge)
+			assert.Equal(t, tt.want, actual)
+		})
+	}
+}
+
+func TestMarkTrackConflicts(t *testing.T) {
+	type args struct {
+		base   []string
+		local  []string
+		remote []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []WithMergeState[string]
+	}{
+		{
+			name: "no change",
+			args: args{
+				base:   []string{"a", "b"},
+				local:  []string{"a", "b"},
+				remote: []string{"a", "b"},
+			},
+			want: []WithMergeState[string]{
+				{V: "a", MergeState: Unchanged},
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "changed on one side",
+			args: args{
+				base:   []string{"a", "b", "c"},
+				local:  []string{"a", "b", "d"},
+				remote: []string{"b", "c", "e"},
+			},
+			want: []WithMergeState[string]{
+				{V: "d", MergeState: LocalAdded},
+				{V: "a", MergeState: RemoteRemoved},
+				{V: "c", MergeState: LocalRemoved},
+				{V: "e", MergeState: RemoteAdded},
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+		{
+			// 他の曲の並べ替えは、ローカルで削除した曲と競合しない
+			name: "removed on local and others reordered on remote",
+			args: args{
+				base:   []string{"a", "b", "c"},
+				local:  []string{"a", "b"},
+				remote: []string{"b", "a", "c"},
+			},
+			want: []WithMergeState[string]{
+				{V: "c", MergeState: LocalRemoved},
+				{V: "a", MergeState: Unchanged},
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "removed on local and reordered on remote",
+			args: args{
+				base:   []string{"a", "b", "c"},
+				local:  []string{"b", "c"},
+				remote: []string{"b", "c", "a"},
+			},
+			want: []WithMergeState[string]{
+				{V: "a", MergeState: Conflict},
+				{V: "b", MergeState: Unchanged},
+				{V: "c", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "removed on local and added again on remote",
+			args: args{
+				base:   []string{"a", "b"},
+				local:  []string{"b"},
+				remote: []string{"a", "b", "a"},
+			},
+			want: []WithMergeState[string]{
+				{V: "a", MergeState: Conflict},
+				{V: "a", MergeState: Conflict},
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+		{
+			name: "removed on remote and added again on local",
+			args: args{
+				base:   []string{"a", "b"},
+				local:  []string{"a", "b", "b"},
+				remote: []string{"a"},
+			},
+			want: []WithMergeState[string]{
+				{V: "b", MergeState: Conflict},
+				{V: "b", MergeState: Conflict},
+				{V: "a", MergeState: Unchanged},
+			},
+		},
+		{
+			// 両方で削除された場合は競合しない
+			name: "removed on both",
+			args: args{
+				base:   []string{"a", "b"},
+				local:  []string{"b"},
+				remote: []string{"b"},
+			},
+			want: []WithMergeState[string]{
+				{V: "b", MergeState: Unchanged},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toTracks := func(ids []string) []models.TrackContent {
+				res := []models.TrackContent{}
+				for _, id := range ids {
+					res = append(res, models.TrackContent{Id: id})
+				}
+				return res
+			}
+			getId := func(track models.TrackContent) string { return track.Id }
+			merge := func(local, remote models.TrackContent) models.TrackContent { return remote }
+			remote := toTracks(tt.args.remote)
+			merged := calcMerge(tt.args.base, toTracks(tt.args.local), remote, getId, merge)
+
+			actual := []WithMergeState[string]{}
+			for _, w := range markTrackConflicts(tt.args.base, remote, merged) {
+				actual = append(actual, WithMergeState[string]{V: w.V.Id, MergeState: w.MergeState})
+			}
+			assert.ElementsMatch(t, tt.want, actual)
+		})
+	}
+}
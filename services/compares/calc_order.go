@@ -0,0 +1,178 @@
+package service_compares
+
+import "strconv"
+
+// Spotifyのreorder APIに渡す1回分の移動
+// RangeStart, InsertBeforeはどちらも移動前の位置(0始まり)
+type TrackMove struct {
+	Id           string `json:"id"`
+	RangeStart   int    `json:"range_start"`
+	InsertBefore int    `json:"insert_before"`
+}
+
+// 同じidが複数回現れても区別できるように、出現回数を付けたキーに変換する
+func occurrenceKeys(ids []string) []string {
+	count := map[string]int{}
+	res := make([]string, len(ids))
+	for i, id := range ids {
+		count[id]++
+		res[i] = occurrenceKey(id, count[id])
+	}
+	return res
+}
+
+func occurrenceKey(id string, n int) string {
+	return id + "#" + strconv.Itoa(n)
+}
+
+// currentとdesiredに共通するキーのうち、順番を保ったまま残せないものを返す
+// (最長増加部分列に含まれないもの)
+// キーはoccurrenceKeysで変換したもの
+func calcMovedKeys(current []string, desired []string) map[string]struct{} {
+	desiredIdx := map[string]int{}
+	for i, id := range desired {
+		if _, ok := desiredIdx[id]; !ok {
+			desiredIdx[id] = i
+		}
+	}
+
+	// currentの順番でdesired内の位置を並べた列
+	ids := []string{}
+	seq := []int{}
+	for _, id := range current {
+		if i, ok := desiredIdx[id]; ok {
+			ids = append(ids, id)
+			seq = append(seq, i)
+		}
+	}
+
+	kept := longestIncreasingSubsequence(seq)
+	moved := map[string]struct{}{}
+	for i, id := range ids {
+		if _, ok := kept[i]; !ok {
+			moved[id] = struct{}{}
+		}
+	}
+	return moved
+}
+
+// currentの順番をdesiredの順番に並べ替えるための移動を返す
+// desiredに含まれないidは相対的な位置を保ったまま残る
+func CalcReorder(currentIds []string, desiredIds []string) []TrackMove {
+	current := occurrenceKeys(currentIds)
+	desired := occurrenceKeys(desiredIds)
+	keyToId := map[string]string{}
+	for i, key := range current {
+		keyToId[key] = currentIds[i]
+	}
+	moved := calcMovedKeys(current, desired)
+
+	cur := make([]string, len(current))
+	copy(cur, current)
+	indexOf := func(id string) int {
+		for i, v := range cur {
+			if v == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	res := []TrackMove{}
+	placed := map[string]struct{}{}
+	for _, id := range desired {
+		if indexOf(id) == -1 {
+			continue
+		}
+		if _, ok := moved[id]; !ok {
+			placed[id] = struct{}{}
+		}
+	}
+
+	prev := ""
+	for _, id := range desired {
+		from := indexOf(id)
+		if from == -1 {
+			continue
+		}
+		if _, ok := moved[id]; ok {
+			to := -1
+			if prev != "" {
+				// 直前の曲のすぐ後ろに移動する
+				to = indexOf(prev) + 1
+			} else {
+				// 先頭の場合は配置済みの曲のうち最も前にあるものの前に移動する
+				for i, v := range cur {
+					if _, ok := placed[v]; ok {
+						to = i
+						break
+					}
+				}
+			}
+			if to != -1 && to != from && to != from+1 {
+				res = append(res, TrackMove{Id: keyToId[id], RangeStart: from, InsertBefore: to})
+				cur = append(cur[:from], cur[from+1:]...)
+				if to > from {
+					to--
+				}
+				cur = append(cur[:to], append([]string{id}, cur[to:]...)...)
+			}
+			placed[id] = struct{}{}
+		}
+		prev = id
+	}
+	return res
+}
+
+// currentにmovesを順番に適用した後の並び順を返す
+func applyMoves(current []string, moves []TrackMove) []string {
+	res := make([]string, len(current))
+	copy(res, current)
+	for _, m := range moves {
+		id := res[m.RangeStart]
+		res = append(res[:m.RangeStart], res[m.RangeStart+1:]...)
+		to := m.InsertBefore
+		if to > m.RangeStart {
+			to--
+		}
+		res = append(res[:to], append([]string{id}, res[to:]...)...)
+	}
+	return res
+}
+
+// 最長増加部分列に含まれる要素のindexを返す
+func longestIncreasingSubsequence(seq []int) map[int]struct{} {
+	// tails[k]: 長さk+1の増加部分列の末尾になりうる要素のindex
+	tails := []int{}
+	parent := make([]int, len(seq))
+	for i, v := range seq {
+		lo, hi := 0, len(tails)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if seq[tails[mid]] < v {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		if lo > 0 {
+			parent[i] = tails[lo-1]
+		} else {
+			parent[i] = -1
+		}
+		if lo == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[lo] = i
+		}
+	}
+
+	res := map[int]struct{}{}
+	if len(tails) == 0 {
+		return res
+	}
+	for i := tails[len(tails)-1]; i != -1; i = parent[i] {
+		res[i] = struct{}{}
+	}
+	return res
+}
@@ -0,0 +1,68 @@
+package service_compares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Spotifyのreorder APIと同じ規則で移動を適用する
+func TestCalcReorder(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   []string
+		desired   []string
+		want      []string
+		wantMoves int
+	}{
+		{
+			name:      "same order",
+			current:   []string{"a", "b", "c"},
+			desired:   []string{"a", "b", "c"},
+			want:      []string{"a", "b", "c"},
+			wantMoves: 0,
+		},
+		{
+			name:      "first to last",
+			current:   []string{"a", "b", "c", "d"},
+			desired:   []string{"b", "c", "d", "a"},
+			want:      []string{"b", "c", "d", "a"},
+			wantMoves: 1,
+		},
+		{
+			name:      "last to first",
+			current:   []string{"a", "b", "c", "d"},
+			desired:   []string{"d", "a", "b", "c"},
+			want:      []string{"d", "a", "b", "c"},
+			wantMoves: 1,
+		},
+		{
+			name:      "reverse",
+			current:   []string{"a", "b", "c", "d"},
+			desired:   []string{"d", "c", "b", "a"},
+			want:      []string{"d", "c", "b", "a"},
+			wantMoves: 3,
+		},
+		{
+			name:      "duplicated",
+			current:   []string{"a", "b", "a", "c"},
+			desired:   []string{"a", "a", "b", "c"},
+			want:      []string{"a", "a", "b", "c"},
+			wantMoves: 1,
+		},
+		{
+			name:      "unknown ids stay",
+			current:   []string{"x", "a", "b", "y", "c"},
+			desired:   []string{"c", "a", "b"},
+			want:      []string{"x", "c", "a", "b", "y"},
+			wantMoves: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moves := CalcReorder(tt.current, tt.desired)
+			assert.Equal(t, tt.wantMoves, len(moves))
+			assert.Equal(t, tt.want, applyMoves(tt.current, moves))
+		})
+	}
+}
@@ -10,6 +10,12 @@ import (
 
 type compare struct {
 	repository interfaces.Repository
+	// 先に同時に取得しておいたリモートの曲 (プレイリストのidがキー)
+	remoteTracks map[string][]models.TrackContent
+	// 最後に取得したリモートのプレイリスト
+	remotePlaylists []models.PlaylistContent
+	// 最後にpullした時のプレイリスト (プレイリストのidがキー)
+	base map[string]models.PlaylistSnapshot
 }
 
 func NewCompare(repository interfaces.Repository) compare {
@@ -17,8 +23,29 @@ func NewCompare(repository interfaces.Repository) compare {
 }
 
 type PlaylistTrackDiff struct {
-	Playlist WithDiffState[models.PlaylistContent]
-	Tracks   []WithDiffState[models.TrackContent]
+	Playlist WithDiffState[models.PlaylistContent] `json:"playlist"`
+	Tracks   []WithDiffState[models.TrackContent]  `json:"tracks"`
+	// ローカルの曲の並び順 (FileName)
+	LocalOrder []string `json:"local_order"`
+	// リモートの曲の並び順 (Id)
+	RemoteOrder []string `json:"remote_order"`
+}
+
+// プレイリストか曲に差分があるかどうか
+func (d PlaylistTrackDiff) HasDifference() bool {
+	pl := d.Playlist
+	if pl.DiffState != Both {
+		return true
+	}
+	if pl.V.OldDirName != "" || pl.V.OldName != "" || len(pl.V.ChangedDetails()) > 0 {
+		return true
+	}
+	for _, v := range d.Tracks {
+		if v.DiffState != Both {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *compare) CompareAllPlaylistWithRemote() ([]PlaylistTrackDiff, error) {
@@ -27,6 +54,16 @@ func (m *compare) CompareAllPlaylistWithRemote() ([]PlaylistTrackDiff, error) {
 		return nil, err
 	}
 
+	remotePLs := []models.PlaylistContent{}
+	for _, v := range playlistDiff {
+		if v.DiffState != LocalOnly {
+			remotePLs = append(remotePLs, v.V)
+		}
+	}
+	if err := m.prefetchRemotePlaylistTrack(remotePLs); err != nil {
+		return nil, err
+	}
+
 	res := []PlaylistTrackDiff{}
 	for _, v := range playlistDiff {
 		partial, err := m.CompareSinglePlaylistWithRemote(v)
@@ -39,6 +76,27 @@ func (m *compare) CompareAllPlaylistWithRemote() ([]PlaylistTrackDiff, error) {
 	return res, nil
 }
 
+// 複数のプレイリストの曲をまとめて同時に取得しておく
+func (m *compare) prefetchRemotePlaylistTrack(playlists []models.PlaylistContent) error {
+	tracks, err := m.repository.FetchRemotePlaylistTracks(playlists)
+	if err != nil {
+		return err
+	}
+	m.remoteTracks = map[string][]models.TrackContent{}
+	for i, v := range playlists {
+		m.remoteTracks[v.Id] = tracks[i]
+	}
+	return nil
+}
+
+// 先に取得しておいた曲があればそれを返す
+func (m *compare) fetchRemotePlaylistTrack(playlist models.PlaylistContent) ([]models.TrackContent, error) {
+	if tracks, ok := m.remoteTracks[playlist.Id]; ok {
+		return tracks, nil
+	}
+	return m.repository.FetchRemotePlaylistTrack(playlist)
+}
+
 func (m *compare) CompareSinglePlaylistWithRemote(v WithDiffState[models.PlaylistContent]) (PlaylistTrackDiff, error) {
 	if v.DiffState == LocalOnly {
 		tracks, err := m.repository.FetchLocalPlaylistTrack(v.V.DirName)
@@ -46,25 +104,36 @@ func (m *compare) CompareSinglePlaylistWithRemote(v WithDiffState[models.Playlis
 			return PlaylistTrackDiff{}, err
 		}
 		trackWithDiffStates := make([]WithDiffState[models.TrackContent], len(tracks))
+		localOrder := make([]string, len(tracks))
 		for i, track := range tracks {
 			trackWithDiffStates[i] = WithDiffState[models.TrackContent]{V: track, DiffState: LocalOnly}
+			localOrder[i] = track.FileName
 		}
-		r := PlaylistTrackDiff{Playlist: v, Tracks: trackWithDiffStates}
+		r := PlaylistTrackDiff{Playlist: v, Tracks: trackWithDiffStates, LocalOrder: localOrder}
 		return r, nil
 	}
 
 	if v.DiffState == RemoteOnly {
-		// パフォーマンスのため、Remoteにのみ存在するTrackはfetchしない (必要があれば後で修正する)
-		r := PlaylistTrackDiff{Playlist: v}
+		tracks, err := m.fetchRemotePlaylistTrack(v.V)
+		if err != nil {
+			return PlaylistTrackDiff{}, err
+		}
+		trackWithDiffStates := make([]WithDiffState[models.TrackContent], len(tracks))
+		remoteOrder := make([]string, len(tracks))
+		for i, track := range tracks {
+			trackWithDiffStates[i] = WithDiffState[models.TrackContent]{V: track, DiffState: RemoteOnly}
+			remoteOrder[i] = track.Key()
+		}
+		r := PlaylistTrackDiff{Playlist: v, Tracks: trackWithDiffStates, RemoteOrder: remoteOrder}
 		return r, nil
 	}
 
 	if v.DiffState == Both {
-		diff, err := m.calcDiffTrack(v.V)
+		r, err := m.calcDiffTrack(v.V)
 		if err != nil {
 			return PlaylistTrackDiff{}, err
 		}
-		r := PlaylistTrackDiff{Playlist: v, Tracks: diff}
+		r.Playlist = v
 		return r, nil
 	}
 
@@ -81,41 +150,101 @@ func (m *compare) CalcDiffPlaylist() ([]WithDiffState[models.PlaylistContent], e
 	if err != nil {
 		return nil, err
 	}
+	m.remotePlaylists = remotePLs
 
 	getId := func(p models.PlaylistContent) string {
 		return p.Id
 	}
-	merge := func(local models.PlaylistContent, remote models.PlaylistContent) models.PlaylistContent {
-		return models.PlaylistContent{Name: remote.Name, DirName: local.DirName, Id: remote.Id}
-	}
-	diff := calcDiff(localPLs, remotePLs, getId, merge)
+	diff := calcDiff(localPLs, remotePLs, getId, mergePlaylist)
 
 	return diff, nil
 }
 
-func (m *compare) calcDiffTrack(playlist models.PlaylistContent) ([]WithDiffState[models.TrackContent], error) {
+// ローカルとリモートの両方に存在するプレイリストの情報をまとめる
+// リモートでプレイリスト名が変更されていればOldNameに変更前の名前を残す
+// 編集可能なプロパティはローカルの値を使い、リモートの値はRemoteDetailに残す
+func mergePlaylist(local models.PlaylistContent, remote models.PlaylistContent) models.PlaylistContent {
+	res := models.PlaylistContent{
+		Id:         remote.Id,
+		Name:       remote.Name,
+		DirName:    local.DirName,
+		Owner:      remote.Owner,
+		SnapshotId: remote.SnapshotId,
+		CoverHash:  local.CoverHash,
+		CoverUrl:   remote.CoverUrl,
+		OldDirName: local.OldDirName,
+		ReadOnly:   remote.ReadOnly,
+	}
+	if local.Name != "" && local.Name != remote.Name {
+		res.OldName = local.Name
+	}
+
+	remoteDetail := remote.Detail()
+	res.RemoteDetail = &remoteDetail
+	if remote.IsLikedSongs() {
+		// お気に入りの曲は名前とプロパティを変更できないので、ローカルの変更は無視する
+		res.OldName = ""
+		res.OldDirName = ""
+		res.SetDetail(remoteDetail)
+		return res
+	}
+	if local.SnapshotId == "" {
+		// snapshot_idが無いtxtは編集可能なプロパティを持たない古い形式なので、リモートの値を使う
+		res.SetDetail(remoteDetail)
+	} else {
+		res.SetDetail(local.Detail())
+	}
+	return res
+}
+
+func (m *compare) calcDiffTrack(playlist models.PlaylistContent) (PlaylistTrackDiff, error) {
 	if playlist.DirName == "" {
-		return nil, fmt.Errorf("property DirName is empty")
+		return PlaylistTrackDiff{}, fmt.Errorf("property DirName is empty")
 	}
 	if playlist.Id == "" {
-		return nil, fmt.Errorf("property Id is empty")
+		return PlaylistTrackDiff{}, fmt.Errorf("property Id is empty")
 	}
 
 	localTracks, err := m.repository.FetchLocalPlaylistTrack(playlist.DirName)
 	if err != nil {
-		return nil, err
+		return PlaylistTrackDiff{}, err
 	}
-	remoteTracks, err := m.repository.FetchRemotePlaylistTrack(playlist.Id)
+	remoteTracks, err := m.fetchRemotePlaylistTrack(playlist)
 	if err != nil {
-		return nil, err
+		return PlaylistTrackDiff{}, err
 	}
 	getId := func(track models.TrackContent) string {
-		return track.Id
+		return track.Key()
 	}
 	merge := func(local models.TrackContent, remote models.TrackContent) models.TrackContent {
-		return models.TrackContent{Id: remote.Id, Name: remote.Name, FileName: local.FileName}
+		return models.TrackContent{Id: remote.Id, Name: remote.Name, Type: remote.Type, Uri: remote.Uri, IsLocal: remote.IsLocal, Position: local.Position, FileName: local.FileName}
+	}
+
+	res := PlaylistTrackDiff{}
+	for _, v := range localTracks {
+		res.LocalOrder = append(res.LocalOrder, v.FileName)
+	}
+	for _, v := range remoteTracks {
+		res.RemoteOrder = append(res.RemoteOrder, v.Key())
 	}
 
-	res := calcDiff(localTracks, remoteTracks, getId, merge)
+	// 両方に存在する曲のうち、順番が異なるものはMovedにする
+	localIds := []string{}
+	for _, v := range localTracks {
+		localIds = append(localIds, v.Key())
+	}
+	moved := calcMovedKeys(occurrenceKeys(res.RemoteOrder), occurrenceKeys(localIds))
+
+	res.Tracks = calcDiff(localTracks, remoteTracks, getId, merge)
+	count := map[string]int{}
+	for i, v := range res.Tracks {
+		if v.DiffState != Both {
+			continue
+		}
+		count[v.V.Key()]++
+		if _, ok := moved[occurrenceKey(v.V.Key(), count[v.V.Key()])]; ok {
+			res.Tracks[i].DiffState = Moved
+		}
+	}
 	return res, nil
 }
@@ -0,0 +1,199 @@
+package service_compares
+
+import (
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+type PlaylistTrackMerge struct {
+	Playlist WithMergeState[models.PlaylistContent]
+	// baseに存在しないプレイリストの場合はnil
+	Base   *models.PlaylistSnapshot
+	Tracks []WithMergeState[models.TrackContent]
+}
+
+// 最後にpullした時点の状態をbaseとして、ローカルとリモートの3-way mergeを行う
+func (m *compare) MergeAllPlaylistWithBase(base []models.PlaylistSnapshot) ([]PlaylistTrackMerge, error) {
+	localPLs, err := m.repository.FetchLocalPlaylistContent()
+	if err != nil {
+		return nil, err
+	}
+	remotePLs, err := m.repository.FetchRemotePlaylistContent()
+	if err != nil {
+		return nil, err
+	}
+
+	idToBase := map[string]models.PlaylistSnapshot{}
+	baseIds := []string{}
+	for _, v := range base {
+		idToBase[v.Id] = v
+		baseIds = append(baseIds, v.Id)
+	}
+
+	getId := func(p models.PlaylistContent) string {
+		return p.Id
+	}
+
+	merged := calcMerge(baseIds, localPLs, remotePLs, getId, mergePlaylist)
+	// pullでもそのまま使えるように、すべてのリモートのプレイリストの曲を取得しておく
+	if err := m.prefetchRemotePlaylistTrack(remotePLs); err != nil {
+		return nil, err
+	}
+	m.remotePlaylists = remotePLs
+
+	res := []PlaylistTrackMerge{}
+	for _, v := range merged {
+		var b *models.PlaylistSnapshot
+		if w, ok := idToBase[v.V.Id]; ok {
+			b = &w
+		}
+		partial, err := m.mergeSinglePlaylistWithBase(v, b)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, partial)
+	}
+	return res, nil
+}
+
+// MergeAllPlaylistWithBaseかCompareAllPlaylistWithRemoteで取得したリモートのプレイリストと曲を返す
+// まだ曲まで取得していない場合はnilを返す
+func (m *compare) FetchedRemotePlaylists() ([]models.PlaylistContent, [][]models.TrackContent) {
+	if m.remotePlaylists == nil || m.remoteTracks == nil {
+		return nil, nil
+	}
+	tracks := [][]models.TrackContent{}
+	for _, v := range m.remotePlaylists {
+		tracks = append(tracks, m.remoteTracks[v.Id])
+	}
+	return m.remotePlaylists, tracks
+}
+
+func (m *compare) mergeSinglePlaylistWithBase(v WithMergeState[models.PlaylistContent], base *models.PlaylistSnapshot) (PlaylistTrackMerge, error) {
+	r := PlaylistTrackMerge{Playlist: v, Base: base}
+
+	switch v.MergeState {
+	case Unchanged:
+		localTracks, err := m.repository.FetchLocalPlaylistTrack(v.V.DirName)
+		if err != nil {
+			return PlaylistTrackMerge{}, err
+		}
+		remoteTracks, err := m.fetchRemotePlaylistTrack(v.V)
+		if err != nil {
+			return PlaylistTrackMerge{}, err
+		}
+		baseTrackIds := []string{}
+		if base != nil {
+			baseTrackIds = base.TrackIds
+		}
+		getId := func(track models.TrackContent) string {
+			return track.Key()
+		}
+		merge := func(local models.TrackContent, remote models.TrackContent) models.TrackContent {
+			return models.TrackContent{Id: remote.Id, Name: remote.Name, Type: remote.Type, Uri: remote.Uri, IsLocal: remote.IsLocal, FileName: local.FileName}
+		}
+		r.Tracks = markTrackConflicts(baseTrackIds, remoteTracks, calcMerge(baseTrackIds, localTracks, remoteTracks, getId, merge))
+
+	case LocalAdded:
+		localTracks, err := m.repository.FetchLocalPlaylistTrack(v.V.DirName)
+		if err != nil {
+			return PlaylistTrackMerge{}, err
+		}
+		r.Tracks = withMergeStates(localTracks, LocalAdded)
+
+	case RemoteAdded:
+		remoteTracks, err := m.fetchRemotePlaylistTrack(v.V)
+		if err != nil {
+			return PlaylistTrackMerge{}, err
+		}
+		r.Tracks = withMergeStates(remoteTracks, RemoteAdded)
+
+	case LocalRemoved:
+		// ローカルで削除されたがリモートで変更されている場合は競合
+		if base == nil || base.SnapshotId != v.V.SnapshotId {
+			r.Playlist.MergeState = Conflict
+		}
+
+	case RemoteRemoved:
+		// リモートで削除されたがローカルで変更されている場合は競合
+		localTracks, err := m.repository.FetchLocalPlaylistTrack(v.V.DirName)
+		if err != nil {
+			return PlaylistTrackMerge{}, err
+		}
+		if base == nil || !isSameTrackIds(localTracks, base.TrackIds) {
+			r.Playlist.MergeState = Conflict
+		}
+		r.Tracks = withMergeStates(localTracks, RemoteRemoved)
+	}
+	return r, nil
+}
+
+// 同じ曲に対するローカルとリモートの変更が矛盾する場合はConflictにする
+// ローカルで削除した曲がリモートで追加されたか並べ替えられた場合と、
+// リモートで削除された曲がローカルで追加された場合
+func markTrackConflicts(baseIds []string, remoteTracks []models.TrackContent, tracks []WithMergeState[models.TrackContent]) []WithMergeState[models.TrackContent] {
+	states := map[string]map[MergeState]struct{}{}
+	for _, w := range tracks {
+		key := w.V.Key()
+		if states[key] == nil {
+			states[key] = map[MergeState]struct{}{}
+		}
+		states[key][w.MergeState] = struct{}{}
+	}
+	has := func(key string, state MergeState) bool {
+		_, ok := states[key][state]
+		return ok
+	}
+
+	// baseから見てリモートで並べ替えられた曲
+	remoteIds := []string{}
+	for _, v := range remoteTracks {
+		remoteIds = append(remoteIds, v.Key())
+	}
+	baseKeys := occurrenceKeys(baseIds)
+	keyToId := map[string]string{}
+	for i, key := range baseKeys {
+		keyToId[key] = baseIds[i]
+	}
+	movedOnRemote := map[string]struct{}{}
+	for key := range calcMovedKeys(baseKeys, occurrenceKeys(remoteIds)) {
+		movedOnRemote[keyToId[key]] = struct{}{}
+	}
+
+	res := make([]WithMergeState[models.TrackContent], len(tracks))
+	for i, w := range tracks {
+		key := w.V.Key()
+		_, moved := movedOnRemote[key]
+		conflicted := has(key, LocalRemoved) && (has(key, RemoteAdded) || moved)
+		conflicted = conflicted || (has(key, RemoteRemoved) && has(key, LocalAdded))
+		if key != "" && conflicted && w.MergeState != Unchanged {
+			w.MergeState = Conflict
+		}
+		res[i] = w
+	}
+	return res
+}
+
+func withMergeStates[T any](values []T, state MergeState) []WithMergeState[T] {
+	res := make([]WithMergeState[T], len(values))
+	for i, v := range values {
+		res[i] = WithMergeState[T]{V: v, MergeState: state}
+	}
+	return res
+}
+
+func isSameTrackIds(tracks []models.TrackContent, ids []string) bool {
+	if len(tracks) != len(ids) {
+		return false
+	}
+	count := map[string]int{}
+	for _, id := range ids {
+		count[id]++
+	}
+	for _, t := range tracks {
+		if count[t.Key()] == 0 {
+			return false
+		}
+		count[t.Key()]--
+	}
+	return true
+}
@@ -0,0 +1,257 @@
+package service_compares
+
+import (
+	"strconv"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+// overwriteでリモートに行われる変更
+// 実行前に副作用なしで計算する
+type PlaylistPlan struct {
+	PlaylistTrackDiff
+	// ローカルにのみ存在する曲のうち、検索で見つかった曲 (ローカルの順番)
+	AddedTracks []models.TrackContent `json:"added_tracks"`
+	// ローカルにのみ存在する曲のうち、検索で見つからなかった曲
+	NotFoundTracks []models.TrackContent `json:"not_found_tracks"`
+	// リモートにのみ存在する曲
+	RemovedTracks []models.TrackContent `json:"removed_tracks"`
+	// リモートにのみ存在するが、APIでは削除できないローカルファイル
+	KeptTracks []models.TrackContent `json:"kept_tracks"`
+	// 追加/削除の後にローカルの順番に並べ替えるための移動
+	Moves []TrackMove `json:"moves"`
+	// cover.jpgが最後に同期した時から変更されているか
+	CoverChanged bool `json:"cover_changed"`
+	// 変更されている場合はアップロードするcover.jpg
+	Cover []byte `json:"cover,omitempty"`
+	// リモートのカバー画像が最後にpullした時から変更されているか
+	RemoteCoverChanged bool `json:"remote_cover_changed"`
+	// 他のユーザーのプレイリストのため、リモートを変更しない
+	Skipped bool `json:"skipped"`
+}
+
+// プレイリストか曲に変更があるかどうか
+func (p PlaylistPlan) HasDifference() bool {
+	if p.Skipped {
+		return false
+	}
+	return p.PlaylistTrackDiff.HasDifference() || p.CoverChanged || p.RemoteCoverChanged
+}
+
+// 曲のidからローカルのファイル名を引く
+func (p PlaylistPlan) IdToFileName() map[string]string {
+	res := map[string]string{}
+	for _, w := range p.Tracks {
+		if w.DiffState == Both || w.DiffState == Moved {
+			res[w.V.Key()] = w.V.FileName
+		}
+	}
+	for _, w := range p.AddedTracks {
+		res[w.Key()] = w.FileName
+	}
+	return res
+}
+
+// 検索で見つからなかった曲のうち、resolvedの曲を追加する曲にした計画を返す
+// resolvedにはNotFoundTracksと同じFileNameを持つ、idのある曲を渡す
+func (p PlaylistPlan) WithResolvedTracks(resolved []models.TrackContent) PlaylistPlan {
+	fileNameToTrack := map[string]models.TrackContent{}
+	for _, w := range resolved {
+		fileNameToTrack[w.FileName] = w
+	}
+	notFound := []models.TrackContent{}
+	for _, w := range p.NotFoundTracks {
+		if _, ok := fileNameToTrack[w.FileName]; !ok {
+			notFound = append(notFound, w)
+		}
+	}
+	for _, w := range p.AddedTracks {
+		fileNameToTrack[w.FileName] = w
+	}
+	// 追加する曲はローカルの順番に並べる
+	added := []models.TrackContent{}
+	for _, fileName := range p.LocalOrder {
+		if w, ok := fileNameToTrack[fileName]; ok {
+			added = append(added, w)
+		}
+	}
+
+	p.AddedTracks = added
+	p.NotFoundTracks = notFound
+	if !p.Playlist.V.IsLikedSongs() {
+		p.Moves = calcPlanMoves(p.PlaylistTrackDiff, p.AddedTracks, p.RemovedTracks)
+	}
+	return p
+}
+
+func (m *compare) PlanAllPlaylist() ([]PlaylistPlan, error) {
+	diff, err := m.CompareAllPlaylistWithRemote()
+	if err != nil {
+		return nil, err
+	}
+
+	res := []PlaylistPlan{}
+	for _, v := range diff {
+		plan, err := m.planPlaylist(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, plan)
+	}
+	return res, nil
+}
+
+func (m *compare) PlanSinglePlaylist(v WithDiffState[models.PlaylistContent]) (PlaylistPlan, error) {
+	diff, err := m.CompareSinglePlaylistWithRemote(v)
+	if err != nil {
+		return PlaylistPlan{}, err
+	}
+	return m.planPlaylist(diff)
+}
+
+func (m *compare) planPlaylist(diff PlaylistTrackDiff) (PlaylistPlan, error) {
+	res := PlaylistPlan{PlaylistTrackDiff: diff}
+	if diff.Playlist.V.ReadOnly {
+		// 他のユーザーのプレイリストは変更も削除 (フォロー解除) もしない
+		res.Skipped = true
+		return res, nil
+	}
+	liked := diff.Playlist.V.IsLikedSongs()
+	if liked && diff.Playlist.DiffState == RemoteOnly {
+		// ディレクトリが無くてもお気に入りの曲を全て削除することはしない
+		res.Skipped = true
+		return res, nil
+	}
+	if liked && diff.Playlist.DiffState == LocalOnly {
+		// pull --liked-songsで扱う設定にしていない場合は、同じ名前のプレイリストを作らない
+		res.Skipped = true
+		return res, nil
+	}
+	if liked {
+		// お気に入りの曲の順番は追加した日時で決まるので、順番の違いは差分にしない
+		res.Tracks = make([]WithDiffState[models.TrackContent], len(diff.Tracks))
+		for i, w := range diff.Tracks {
+			if w.DiffState == Moved {
+				w.DiffState = Both
+			}
+			res.Tracks[i] = w
+		}
+	}
+
+	localOnlyTracks := []models.TrackContent{}
+	for _, w := range diff.Tracks {
+		if w.DiffState == LocalOnly {
+			localOnlyTracks = append(localOnlyTracks, w.V)
+		}
+		if w.DiffState == RemoteOnly && w.V.IsLocalFile() && diff.Playlist.DiffState != RemoteOnly {
+			res.KeptTracks = append(res.KeptTracks, w.V)
+			continue
+		}
+		if w.DiffState == RemoteOnly {
+			res.RemovedTracks = append(res.RemovedTracks, w.V)
+		}
+	}
+	if diff.Playlist.DiffState == RemoteOnly {
+		// プレイリストごと削除するので曲の変更は行わない
+		return res, nil
+	}
+
+	// ローカルの曲がどのリモートの曲になるか検索する
+	found, notFound, err := m.repository.SearchRemoteTrack(localOnlyTracks)
+	if err != nil {
+		return PlaylistPlan{}, err
+	}
+	res.AddedTracks = found
+	res.NotFoundTracks = notFound
+	if liked {
+		return res, nil
+	}
+	res.Moves = calcPlanMoves(diff, res.AddedTracks, res.RemovedTracks)
+
+	cover, err := m.repository.FetchLocalPlaylistCover(diff.Playlist.V.DirName)
+	if err != nil {
+		return PlaylistPlan{}, err
+	}
+	res.CoverChanged = cover != nil && models.CoverHash(cover) != diff.Playlist.V.CoverHash
+	if res.CoverChanged {
+		res.Cover = cover
+	}
+	res.RemoteCoverChanged, err = m.isRemoteCoverChanged(diff.Playlist.V)
+	if err != nil {
+		return PlaylistPlan{}, err
+	}
+	return res, nil
+}
+
+// リモートのカバー画像が最後に同期したものと異なるかどうか
+// URLが最後にpullした時と同じ場合はダウンロードしない
+func (m *compare) isRemoteCoverChanged(playlist models.PlaylistContent) (bool, error) {
+	if m.base == nil {
+		base, err := m.repository.FetchBaseSnapshot()
+		if err != nil {
+			return false, err
+		}
+		m.base = map[string]models.PlaylistSnapshot{}
+		for _, v := range base {
+			m.base[v.Id] = v
+		}
+	}
+	base, ok := m.base[playlist.Id]
+	if !ok || !base.IsCoverUrlChanged(playlist.CoverUrl) {
+		return false, nil
+	}
+	cover, err := m.repository.FetchRemotePlaylistCover(playlist)
+	if err != nil {
+		return false, err
+	}
+	return cover != nil && models.CoverHash(cover) != playlist.CoverHash, nil
+}
+
+// 追加/削除を反映した後のリモートの曲の順番 (Key) を返す
+// 追加した曲はリモートの末尾に並ぶ
+func remoteOrderAfterEdit(diff PlaylistTrackDiff, addedTracks []models.TrackContent, removedTracks []models.TrackContent) []string {
+	removedPositions := map[string]struct{}{}
+	for _, w := range removedTracks {
+		removedPositions[w.Position] = struct{}{}
+	}
+	res := []string{}
+	for i, id := range diff.RemoteOrder {
+		if _, ok := removedPositions[strconv.Itoa(i+1)]; !ok {
+			res = append(res, id)
+		}
+	}
+	for _, w := range addedTracks {
+		res = append(res, w.Key())
+	}
+	return res
+}
+
+// planを全て実行した後のリモートの曲の順番 (Key) を返す
+func (p PlaylistPlan) RemoteOrderAfterPlan() []string {
+	return applyMoves(remoteOrderAfterEdit(p.PlaylistTrackDiff, p.AddedTracks, p.RemovedTracks), p.Moves)
+}
+
+// 追加/削除後のリモートの曲の順番をローカルの順番に並べ替えるための移動を返す
+// 追加した曲はリモートの末尾に並ぶ
+func calcPlanMoves(diff PlaylistTrackDiff, addedTracks []models.TrackContent, removedTracks []models.TrackContent) []TrackMove {
+	current := remoteOrderAfterEdit(diff, addedTracks, removedTracks)
+
+	// ローカルの順番 (検索で見つからなかった曲は除く)
+	fileNameToTrack := map[string]models.TrackContent{}
+	for _, w := range diff.Tracks {
+		if w.DiffState == Both || w.DiffState == Moved {
+			fileNameToTrack[w.V.FileName] = w.V
+		}
+	}
+	for _, w := range addedTracks {
+		fileNameToTrack[w.FileName] = w
+	}
+	desired := []string{}
+	for _, fileName := range diff.LocalOrder {
+		if w, ok := fileNameToTrack[fileName]; ok {
+			desired = append(desired, w.Key())
+		}
+	}
+
+	return CalcReorder(current, desired)
+}
@@ -0,0 +1,131 @@
+package service_compares
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/kajikentaro/spotify-fbc/services/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcPlanMoves(t *testing.T) {
+	diff := PlaylistTrackDiff{
+		Tracks: []WithDiffState[models.TrackContent]{
+			{V: models.TrackContent{FileName: "d.txt"}, DiffState: LocalOnly},
+			{V: models.TrackContent{Id: "c", Position: "2"}, DiffState: RemoteOnly},
+			{V: models.TrackContent{Id: "a", FileName: "a.txt"}, DiffState: Moved},
+			{V: models.TrackContent{Id: "b", FileName: "b.txt"}, DiffState: Both},
+		},
+		LocalOrder:  []string{"d.txt", "b.txt", "a.txt"},
+		RemoteOrder: []string{"a", "c", "b"},
+	}
+	added := []models.TrackContent{{Id: "d", FileName: "d.txt"}}
+	removed := []models.TrackContent{{Id: "c", Position: "2"}}
+
+	moves := calcPlanMoves(diff, added, removed)
+	// 削除と追加の後は a, b, d の順になる
+	actual := applyMoves([]string{"a", "b", "d"}, moves)
+	assert.Equal(t, []string{"d", "b", "a"}, actual)
+
+	plan := PlaylistPlan{PlaylistTrackDiff: diff, AddedTracks: added, RemovedTracks: removed, Moves: moves}
+	assert.Equal(t, []string{"d", "b", "a"}, plan.RemoteOrderAfterPlan())
+}
+
+func TestPlaylistPlanJSON(t *testing.T) {
+	plan := PlaylistPlan{
+		PlaylistTrackDiff: PlaylistTrackDiff{
+			Playlist: WithDiffState[models.PlaylistContent]{V: models.PlaylistContent{Id: "p", SnapshotId: "s"}, DiffState: Both},
+			Tracks: []WithDiffState[models.TrackContent]{
+				{V: models.TrackContent{Id: "a", FileName: "a.txt"}, DiffState: Moved},
+			},
+			LocalOrder:  []string{"a.txt"},
+			RemoteOrder: []string{"a"},
+		},
+		AddedTracks: []models.TrackContent{{Id: "b", FileName: "b.txt"}},
+		Moves:       []TrackMove{{Id: "a", RangeStart: 0, InsertBefore: 2}},
+	}
+
+	data, err := json.Marshal(plan)
+	assert.NoError(t, err)
+	actual := PlaylistPlan{}
+	assert.NoError(t, json.Unmarshal(data, &actual))
+	assert.Equal(t, plan, actual)
+
+	assert.Error(t, json.Unmarshal([]byte(`"unknown"`), new(DiffState)))
+}
+
+func TestPlanLikedSongs(t *testing.T) {
+	liked := models.NewLikedSongsContent("user", "10-2023-01-01T00:00:00Z")
+
+	// ディレクトリが削除されてもお気に入りの曲は削除しない
+	m := compare{}
+	plan, err := m.planPlaylist(PlaylistTrackDiff{
+		Playlist: WithDiffState[models.PlaylistContent]{V: liked, DiffState: RemoteOnly},
+		Tracks:   []WithDiffState[models.TrackContent]{{V: models.TrackContent{Id: "a", Position: "1"}, DiffState: RemoteOnly}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, plan.Skipped)
+	assert.False(t, plan.HasDifference())
+
+	// 名前とプロパティのローカルの変更は無視する
+	local := liked
+	local.DirName = "Favorites"
+	local.OldDirName = "Liked Songs"
+	local.Description = "edited"
+	merged := mergePlaylist(local, liked)
+	assert.Equal(t, "Favorites", merged.DirName)
+	assert.Empty(t, merged.OldDirName)
+	assert.Empty(t, merged.ChangedDetails())
+}
+
+func TestCalcPlanMovesWithLocalFile(t *testing.T) {
+	local := models.TrackContent{Uri: "spotify:local:x", IsLocal: "true", Position: "1"}
+	diff := PlaylistTrackDiff{
+		Tracks: []WithDiffState[models.TrackContent]{
+			{V: local, DiffState: RemoteOnly},
+			{V: models.TrackContent{Id: "a", FileName: "a.txt"}, DiffState: Moved},
+			{V: models.TrackContent{Id: "b", FileName: "b.txt"}, DiffState: Both},
+		},
+		LocalOrder:  []string{"b.txt", "a.txt"},
+		RemoteOrder: []string{local.Key(), "a", "b"},
+	}
+
+	// 削除できないローカルファイルは残したまま並べ替える
+	moves := calcPlanMoves(diff, nil, nil)
+	actual := applyMoves([]string{local.Key(), "a", "b"}, moves)
+	assert.Equal(t, []string{local.Key(), "b", "a"}, actual)
+}
+
+// リモートのカバー画像だけを返すリポジトリ
+type coverRepository struct {
+	interfaces.Repository
+	cover []byte
+}
+
+func (r coverRepository) FetchRemotePlaylistCover(playlist models.PlaylistContent) ([]byte, error) {
+	return r.cover, nil
+}
+
+func TestIsRemoteCoverChanged(t *testing.T) {
+	playlist := models.PlaylistContent{Id: "p", CoverHash: models.CoverHash([]byte("base")), CoverUrl: "new"}
+	base := map[string]models.PlaylistSnapshot{"p": {Id: "p", CoverUrl: "old"}}
+
+	m := compare{repository: coverRepository{cover: []byte("remote")}, base: base}
+	changed, err := m.isRemoteCoverChanged(playlist)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// URLだけが変わった場合
+	m = compare{repository: coverRepository{cover: []byte("base")}, base: base}
+	changed, err = m.isRemoteCoverChanged(playlist)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// URLが変わっていない場合はダウンロードしない
+	m = compare{base: base}
+	playlist.CoverUrl = "old"
+	changed, err = m.isRemoteCoverChanged(playlist)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+// 形式ごとにプレイリストファイルの内容を作成する
+func exportText(format string, playlist models.PlaylistContent, tracks []models.TrackContent) (string, error) {
+	switch format {
+	case models.EXPORT_FORMAT_M3U8:
+		return models.ExportM3u8(playlist, tracks), nil
+	case models.EXPORT_FORMAT_XSPF:
+		return models.ExportXspf(playlist, tracks)
+	}
+	return "", unknownExportFormatError(format)
+}
+
+func unknownExportFormatError(format string) error {
+	return fmt.Errorf("unknown export format: %s (must be %s or %s)", format, models.EXPORT_FORMAT_M3U8, models.EXPORT_FORMAT_XSPF)
+}
+
+// ローカルのプレイリストをformatsの形式のファイルとしてoutDirに書き出す
+// playlistNameが空の場合はすべてのプレイリストを書き出す
+func (m *service) ExportPlaylists(outDir string, formats []string, playlistName string) error {
+	for _, f := range formats {
+		if f != models.EXPORT_FORMAT_M3U8 && f != models.EXPORT_FORMAT_XSPF {
+			return unknownExportFormatError(f)
+		}
+	}
+
+	playlists, err := m.repository.FetchLocalPlaylistContent()
+	if err != nil {
+		return err
+	}
+	exported := false
+	for _, v := range playlists {
+		if playlistName != "" && v.DirName != playlistName {
+			continue
+		}
+		tracks, err := m.repository.FetchLocalPlaylistTrack(v.DirName)
+		if err != nil {
+			return err
+		}
+		for _, f := range formats {
+			text, err := exportText(f, v, tracks)
+			if err != nil {
+				return err
+			}
+			fileName := v.DirName + "." + f
+			if err := m.repository.CreateExportFile(outDir, fileName, text); err != nil {
+				return err
+			}
+			fmt.Println(filepath.Join(outDir, fileName))
+		}
+		exported = true
+	}
+	if playlistName != "" && !exported {
+		return fmt.Errorf("playlist '%s' not found", playlistName)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+func Test_ExportPlaylists(t *testing.T) {
+	newRepository := func() *fakeRepository {
+		return &fakeRepository{
+			localPlaylists: []models.PlaylistContent{{Id: "a", Name: "a", DirName: "a"}, {DirName: "b"}},
+			localTracks:    map[string][]models.TrackContent{"a": {{Id: "1", Name: "song"}}},
+		}
+	}
+	tests := []struct {
+		name         string
+		formats      []string
+		playlistName string
+		expected     []string
+		wantErr      bool
+	}{
+		{
+			name:     "all playlists",
+			formats:  []string{models.EXPORT_FORMAT_M3U8, models.EXPORT_FORMAT_XSPF},
+			expected: []string{"CreateExportFile out/a.m3u8", "CreateExportFile out/a.xspf", "CreateExportFile out/b.m3u8", "CreateExportFile out/b.xspf"},
+		},
+		{
+			name:         "filtered by the name",
+			formats:      []string{models.EXPORT_FORMAT_M3U8},
+			playlistName: "b",
+			expected:     []string{"CreateExportFile out/b.m3u8"},
+		},
+		{
+			name:         "playlist not found",
+			formats:      []string{models.EXPORT_FORMAT_M3U8},
+			playlistName: "c",
+			wantErr:      true,
+		},
+		{
+			// 何も書き出す前にエラーにする
+			name:    "unknown format",
+			formats: []string{models.EXPORT_FORMAT_M3U8, "pls"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := newRepository()
+			m := NewService(repository)
+			err := m.ExportPlaylists("out", tt.formats, tt.playlistName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: %v, wantErr: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(repository.calls) != 0 {
+					t.Errorf("unexpected calls: %v", repository.calls)
+				}
+				return
+			}
+			if !reflect.DeepEqual(repository.calls, tt.expected) {
+				t.Errorf("actual: %v, expected: %v", repository.calls, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+)
+
+// 一度に削除できる量の上限
+// ルートディレクトリの削除などで全てのプレイリストが消えることを防ぐ
+type DeleteLimit struct {
+	// 一度に削除できるプレイリストの数
+	MaxPlaylists int
+	// 1つのプレイリストから一度に削除できる曲の割合 (%)
+	MaxTrackPercent int
+	// trueの場合は上限を超えても削除する
+	AllowMassDelete bool
+}
+
+var DEFAULT_DELETE_LIMIT = DeleteLimit{MaxPlaylists: 3, MaxTrackPercent: 50}
+
+// 曲の割合の上限は、この数以上の曲を持つプレイリストにだけ適用する
+const MIN_GUARDED_TRACKS = 10
+
+func (m *service) SetDeleteLimit(limit DeleteLimit) {
+	m.deleteLimit = limit
+}
+
+type trackDeletion struct {
+	playlistName string
+	removed      int
+	total        int
+}
+
+// リモートから削除される内容
+type deletionSummary struct {
+	playlists []string
+	tracks    []trackDeletion
+	// 保存したアルバムとフォローしたアーティスト
+	library []trackDeletion
+}
+
+func (d deletionSummary) String() string {
+	if len(d.playlists) == 0 && len(d.tracks) == 0 && len(d.library) == 0 {
+		return ""
+	}
+	sb := strings.Builder{}
+	sb.WriteString("The following will be deleted from your spotify account:\n")
+	for _, v := range d.playlists {
+		sb.WriteString("- " + v + "\n")
+	}
+	for _, v := range d.tracks {
+		sb.WriteString(fmt.Sprintf("  - %d of %d songs in %s\n", v.removed, v.total, v.playlistName))
+	}
+	for _, v := range d.library {
+		sb.WriteString(fmt.Sprintf("- %d of %d in %s\n", v.removed, v.total, v.playlistName))
+	}
+	return sb.String()
+}
+
+// 上限を超えている削除の内容を返す
+func (d deletionSummary) exceeded(limit DeleteLimit) []string {
+	res := []string{}
+	if len(d.playlists) > limit.MaxPlaylists {
+		res = append(res, fmt.Sprintf("%d playlists will be deleted (limit: %d)", len(d.playlists), limit.MaxPlaylists))
+	}
+	for _, v := range d.tracks {
+		if v.total < MIN_GUARDED_TRACKS {
+			continue
+		}
+		if v.removed*100 > v.total*limit.MaxTrackPercent {
+			res = append(res, fmt.Sprintf("%d of %d songs in %s will be deleted (limit: %d%%)", v.removed, v.total, v.playlistName, limit.MaxTrackPercent))
+		}
+	}
+	// ライブラリにもプレイリストの曲と同じ割合の上限を適用する
+	for _, v := range d.library {
+		if v.total < MIN_GUARDED_TRACKS {
+			continue
+		}
+		if v.removed*100 > v.total*limit.MaxTrackPercent {
+			res = append(res, fmt.Sprintf("%d of %d in %s will be deleted (limit: %d%%)", v.removed, v.total, v.playlistName, limit.MaxTrackPercent))
+		}
+	}
+	return res
+}
+
+func summarizePlanDeletion(plans []service_compares.PlaylistPlan) deletionSummary {
+	res := deletionSummary{}
+	for _, v := range plans {
+		if v.Skipped {
+			continue
+		}
+		if v.Playlist.DiffState == service_compares.RemoteOnly {
+			res.playlists = append(res.playlists, v.Playlist.V.Name)
+			continue
+		}
+		if len(v.RemovedTracks) > 0 {
+			res.tracks = append(res.tracks, trackDeletion{playlistName: v.Playlist.V.Name, removed: len(v.RemovedTracks), total: len(v.RemoteOrder)})
+		}
+	}
+	return res
+}
+
+func summarizeMergeDeletion(merged []service_compares.PlaylistTrackMerge) deletionSummary {
+	res := deletionSummary{}
+	for _, v := range merged {
+		if v.Playlist.V.ReadOnly {
+			continue
+		}
+		if v.Playlist.MergeState == service_compares.LocalRemoved {
+			if v.Playlist.V.IsLikedSongs() {
+				continue
+			}
+			res.playlists = append(res.playlists, v.Playlist.V.Name)
+			continue
+		}
+		if v.Playlist.MergeState == service_compares.Conflict || v.Base == nil {
+			continue
+		}
+		removed := len(tracksWithMergeState(v.Tracks, service_compares.LocalRemoved))
+		if removed > 0 {
+			res.tracks = append(res.tracks, trackDeletion{playlistName: v.Playlist.V.Name, removed: removed, total: len(v.Base.TrackIds)})
+		}
+	}
+	return res
+}
+
+// 削除の量を確認し、confirmで実行してよいか確認する
+// 上限を超えている場合はAllowMassDeleteが無い限りエラーを返す
+// confirmがnilの場合は確認せずに実行する
+func (m *service) confirmDeletion(summary deletionSummary, confirm func(summary string) bool) (bool, error) {
+	exceeded := summary.exceeded(m.deleteLimit)
+	if len(exceeded) > 0 && !m.deleteLimit.AllowMassDelete {
+		for _, v := range exceeded {
+			fmt.Fprintln(os.Stderr, v)
+		}
+		return false, fmt.Errorf("too many deletions were detected. check your local directories, or run with --allow-mass-delete to delete them")
+	}
+	if confirm == nil {
+		return true, nil
+	}
+	return confirm(summary.String()), nil
+}
+
+// dry runの場合は上限を超えている削除を警告だけする
+func (m *service) warnMassDeletion(summary deletionSummary) {
+	for _, v := range summary.exceeded(m.deleteLimit) {
+		fmt.Fprintln(os.Stderr, "Warning:", v)
+	}
+}
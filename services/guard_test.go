@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+)
+
+func Test_deletionSummary_exceeded(t *testing.T) {
+	limit := DeleteLimit{MaxPlaylists: 1, MaxTrackPercent: 50}
+	tests := []struct {
+		name     string
+		summary  deletionSummary
+		expected int
+	}{
+		{
+			name:     "within the limits",
+			summary:  deletionSummary{playlists: []string{"a"}, tracks: []trackDeletion{{"b", 5, 10}}},
+			expected: 0,
+		},
+		{
+			name:     "too many playlists",
+			summary:  deletionSummary{playlists: []string{"a", "b"}},
+			expected: 1,
+		},
+		{
+			name:     "too many tracks",
+			summary:  deletionSummary{tracks: []trackDeletion{{"b", 6, 10}}},
+			expected: 1,
+		},
+		{
+			name:     "small playlist",
+			summary:  deletionSummary{tracks: []trackDeletion{{"b", 3, 3}}},
+			expected: 0,
+		},
+		{
+			name:     "too many albums",
+			summary:  deletionSummary{library: []trackDeletion{{models.ALBUMS_DIR_NAME, 6, 10}}},
+			expected: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.summary.exceeded(limit); len(actual) != tt.expected {
+				t.Errorf("actual: %v, expected: %d", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_summarizePlanDeletion(t *testing.T) {
+	plans := []service_compares.PlaylistPlan{
+		{PlaylistTrackDiff: service_compares.PlaylistTrackDiff{
+			Playlist: service_compares.WithDiffState[models.PlaylistContent]{V: models.PlaylistContent{Name: "removed"}, DiffState: service_compares.RemoteOnly},
+		}},
+		{
+			PlaylistTrackDiff: service_compares.PlaylistTrackDiff{
+				Playlist:    service_compares.WithDiffState[models.PlaylistContent]{V: models.PlaylistContent{Name: "edited"}, DiffState: service_compares.Both},
+				RemoteOrder: []string{"a", "b", "c"},
+			},
+			RemovedTracks: []models.TrackContent{{Id: "a"}},
+		},
+		{
+			PlaylistTrackDiff: service_compares.PlaylistTrackDiff{
+				Playlist: service_compares.WithDiffState[models.PlaylistContent]{V: models.PlaylistContent{Name: "followed", ReadOnly: true}, DiffState: service_compares.RemoteOnly},
+			},
+			Skipped: true,
+		},
+	}
+	actual := summarizePlanDeletion(plans).String()
+	expected := `The following will be deleted from your spotify account:
+- removed
+  - 1 of 3 songs in edited
+`
+	if actual != expected {
+		t.Errorf("\nactual:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+// 取得済みのリモートのプレイリストと曲の状態を履歴として保存する
+// playlistTracksにはplaylistsと同じ順番で曲を渡す
+func (m *service) archiveRemoteState(playlists []models.PlaylistContent, playlistTracks [][]models.TrackContent) error {
+	history := models.HistorySnapshot{Time: time.Now()}
+	for i, v := range playlists {
+		history.Playlists = append(history.Playlists, models.HistoryPlaylist{Playlist: v, Tracks: playlistTracks[i]})
+	}
+	return m.saveHistory(history)
+}
+
+func (m *service) saveHistory(history models.HistorySnapshot) error {
+	if err := m.repository.SaveHistory(history); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "the remote state was saved to the history", history.Id())
+	return nil
+}
+
+func (m *service) ListHistory() error {
+	ids, err := m.repository.FetchHistoryIds()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		history, err := m.repository.FetchHistory(id)
+		if err != nil {
+			return err
+		}
+		trackCount := 0
+		for _, v := range history.Playlists {
+			trackCount += len(v.Tracks)
+		}
+		fmt.Printf("%s  %d playlists  %d tracks\n", id, len(history.Playlists), trackCount)
+	}
+	return nil
+}
+
+func (m *service) ShowHistory(id string) error {
+	history, err := m.repository.FetchHistory(id)
+	if err != nil {
+		return err
+	}
+	for _, v := range history.Playlists {
+		fmt.Println(v.Playlist.Name)
+		for _, t := range v.Tracks {
+			if t.IsEpisode() {
+				fmt.Println("  ", t.Name, "-", t.Show)
+				continue
+			}
+			fmt.Println("  ", t.Name, "-", t.Artist)
+		}
+	}
+	return nil
+}
+
+// 履歴のプレイリストをローカル、またはリモートに復元する
+// playlistNameが空の場合は全てのプレイリストを復元する
+func (m *service) RestoreHistory(id string, playlistName string, remote bool) error {
+	history, err := m.repository.FetchHistory(id)
+	if err != nil {
+		return err
+	}
+	targets := []models.HistoryPlaylist{}
+	for _, v := range history.Playlists {
+		if playlistName == "" || v.Playlist.Name == playlistName || v.Playlist.DirName == playlistName {
+			targets = append(targets, v)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("playlist '%s' not found in the history %s", playlistName, id)
+	}
+
+	if remote {
+		remotePLs, err := m.repository.FetchRemotePlaylistContent()
+		if err != nil {
+			return err
+		}
+		for _, v := range targets {
+			if err := m.restoreRemotePlaylist(v, remotePLs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := m.repository.CreateRootDir(); err != nil && !os.IsExist(err) {
+		return err
+	}
+	localPLs, err := m.repository.FetchLocalPlaylistContent()
+	if err != nil {
+		return err
+	}
+	base, err := m.repository.FetchBaseSnapshot()
+	if err != nil {
+		return err
+	}
+	idToLocal := map[string]models.PlaylistContent{}
+	usedDirName := newDirNameUnique()
+	for _, v := range localPLs {
+		if v.Id != "" {
+			idToLocal[v.Id] = v
+		}
+		usedDirName.Add(v.DirName)
+	}
+	for _, v := range targets {
+		playlist := v.Playlist
+		if local, ok := idToLocal[playlist.Id]; ok {
+			// 既存のディレクトリを上書きする
+			playlist.DirName = local.DirName
+			playlist.CoverHash = local.CoverHash
+		} else {
+			playlist.DirName = takeDirName(usedDirName, playlist)
+			playlist.CoverHash = ""
+		}
+		if err := m.repository.CreatePlaylistDirectory(playlist); err != nil {
+			return err
+		}
+		if err := m.writePlaylistDirectory(playlist, v.Tracks); err != nil {
+			return err
+		}
+		fmt.Println("~", playlist.DirName)
+		base = replaceBaseSnapshot(base, models.NewPlaylistSnapshot(playlist, v.Tracks))
+	}
+
+	// 復元したディレクトリがローカルの変更として扱われないよう、baseも履歴の状態にする
+	// baseが無い場合は次のpullで作られるので保存しない
+	if base == nil {
+		return nil
+	}
+	return m.repository.SaveBaseSnapshot(base)
+}
+
+// baseの同じidのプレイリストをsnapshotで置き換える
+// baseに無い場合は追加する
+func replaceBaseSnapshot(base []models.PlaylistSnapshot, snapshot models.PlaylistSnapshot) []models.PlaylistSnapshot {
+	if base == nil {
+		return nil
+	}
+	for i, v := range base {
+		if v.Id == snapshot.Id {
+			base[i] = snapshot
+			return base
+		}
+	}
+	return append(base, snapshot)
+}
+
+// リモートのプレイリストを履歴の状態に戻す
+// フォローを外したプレイリストは再びフォローする
+// 他のユーザーのプレイリストはフォローし直すだけで、変更しない
+// remotePLsには現在のリモートのプレイリストを渡す
+func (m *service) restoreRemotePlaylist(v models.HistoryPlaylist, remotePLs []models.PlaylistContent) error {
+	var current *models.PlaylistContent
+	for _, w := range remotePLs {
+		if w.Id == v.Playlist.Id {
+			current = &w
+			break
+		}
+	}
+	if current == nil {
+		public := v.Playlist.Public == "true"
+		if err := m.repository.FollowRemotePlaylist(v.Playlist.Id, public); err != nil {
+			return err
+		}
+		fmt.Println("+", v.Playlist.Name)
+		current = &v.Playlist
+	}
+	if v.Playlist.ReadOnly || current.ReadOnly {
+		fmt.Fprintln(os.Stderr, "Warning: only following is restored because you don't own the playlist:", v.Playlist.Name)
+		return nil
+	}
+
+	if current.Name != v.Playlist.Name {
+		if err := m.repository.RenameRemotePlaylist(*current, v.Playlist.Name); err != nil {
+			return err
+		}
+		fmt.Println("~", current.Name, "->", v.Playlist.Name)
+	}
+	if current.Detail() != v.Playlist.Detail() {
+		playlist := v.Playlist
+		remoteDetail := current.Detail()
+		playlist.RemoteDetail = &remoteDetail
+		if err := m.repository.ChangeRemotePlaylistDetail(playlist); err != nil {
+			return err
+		}
+		fmt.Println("  ~ properties")
+	}
+	if err := m.repository.ReplaceRemoteTrack(v.Playlist, tracksWithId(v.Playlist.Name, v.Tracks)); err != nil {
+		return err
+	}
+	fmt.Println("  ~", len(v.Tracks), "tracks of", v.Playlist.Name)
+	return nil
+}
+
+// idを持たない曲を除く
+// 除いた曲はリモートに戻せないので警告を表示する
+func tracksWithId(playlistName string, tracks []models.TrackContent) []models.TrackContent {
+	res := []models.TrackContent{}
+	for _, v := range tracks {
+		if v.Id != "" {
+			res = append(res, v)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, "Warning: the track without id cannot be restored:", filepath.Join(playlistName, v.Name))
+	}
+	return res
+}
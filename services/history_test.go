@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_restoreRemotePlaylist(t *testing.T) {
+	history := models.HistoryPlaylist{
+		Playlist: models.PlaylistContent{Id: "p", Name: "old name", Description: "old"},
+		Tracks:   []models.TrackContent{{Id: "a"}},
+	}
+	tests := []struct {
+		name     string
+		readOnly bool
+		remote   []models.PlaylistContent
+		expected []string
+	}{
+		{
+			name:     "own playlist",
+			remote:   []models.PlaylistContent{{Id: "p", Name: "new name"}},
+			expected: []string{"RenameRemotePlaylist p", "ChangeRemotePlaylistDetail p old name", "ReplaceRemoteTrack p"},
+		},
+		{
+			name:     "unfollowed playlist of another user",
+			readOnly: true,
+			remote:   []models.PlaylistContent{},
+			expected: []string{"FollowRemotePlaylist p"},
+		},
+		{
+			name:     "playlist of another user",
+			remote:   []models.PlaylistContent{{Id: "p", Name: "new name", ReadOnly: true}},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeRepository{remotePlaylists: tt.remote}
+			m := NewService(repository)
+			v := history
+			v.Playlist.ReadOnly = tt.readOnly
+			assert.NoError(t, m.restoreRemotePlaylist(v, tt.remote))
+			assert.Equal(t, tt.expected, repository.calls)
+		})
+	}
+}
+
+func Test_RestoreHistory_local(t *testing.T) {
+	history := models.HistorySnapshot{Playlists: []models.HistoryPlaylist{
+		{Playlist: models.PlaylistContent{Id: "p", Name: "pl", SnapshotId: "old"}, Tracks: []models.TrackContent{{Id: "a", Name: "a"}}},
+	}}
+	repository := &fakeRepository{
+		localPlaylists: []models.PlaylistContent{{Id: "p", Name: "pl", DirName: "pl", SnapshotId: "new"}},
+		base: []models.PlaylistSnapshot{
+			{Id: "p", Name: "pl", DirName: "pl", SnapshotId: "new", TrackIds: []string{"b"}},
+			{Id: "other", DirName: "other"},
+		},
+		histories: map[string]models.HistorySnapshot{"h": history},
+	}
+	m := NewService(repository)
+	assert.NoError(t, m.RestoreHistory("h", "", false))
+
+	// 復元した状態が最後にpullした状態になる
+	expected := []models.PlaylistSnapshot{
+		{Id: "p", Name: "pl", DirName: "pl", SnapshotId: "old", TrackIds: []string{"a"}},
+		{Id: "other", DirName: "other"},
+	}
+	assert.Equal(t, expected, repository.base)
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+)
+
+// 候補として表示する曲の数
+const INTERACTIVE_CANDIDATES = 5
+
+// promptを設定すると、検索で見つからなかった曲をユーザーに選んでもらう
+// promptには質問が渡され、ユーザーの入力を返す
+func (m *service) SetPrompt(prompt func(message string) string) {
+	m.prompt = prompt
+}
+
+// 見つからなかった曲をユーザーに選んでもらい、選んだ曲を追加する曲として計画に加える
+// 選んだ曲のidは、リモートに追加した時に曲txtに書き込まれる
+func (m *service) resolveNotFoundTracks(plans []service_compares.PlaylistPlan) ([]service_compares.PlaylistPlan, error) {
+	if m.prompt == nil {
+		return plans, nil
+	}
+	res := []service_compares.PlaylistPlan{}
+	for _, v := range plans {
+		resolved := []models.TrackContent{}
+		for _, t := range v.NotFoundTracks {
+			if t.IsEpisode() {
+				// エピソードは曲として検索できない
+				continue
+			}
+			chosen, err := m.chooseTrack(v.Playlist.V.DirName, t)
+			if err != nil {
+				return nil, err
+			}
+			if chosen == nil {
+				continue
+			}
+			chosen.FileName = t.FileName
+			chosen.Position = t.Position
+			resolved = append(resolved, *chosen)
+		}
+		if len(resolved) > 0 {
+			v = v.WithResolvedTracks(resolved)
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// 候補を表示し、選ばれた曲を返す
+// スキップされた場合はnilを返す
+func (m *service) chooseTrack(dirName string, track models.TrackContent) (*models.TrackContent, error) {
+	query := ""
+	for {
+		candidates, err := m.repository.SearchRemoteTrackCandidates(track, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) > INTERACTIVE_CANDIDATES {
+			candidates = candidates[:INTERACTIVE_CANDIDATES]
+		}
+
+		sb := strings.Builder{}
+		sb.WriteString("? " + filepath.Join(dirName, track.FileName) + "\n")
+		if len(candidates) == 0 {
+			sb.WriteString("  no search result found\n")
+		}
+		for i, c := range candidates {
+			sb.WriteString(fmt.Sprintf("  %d) %s / %s / %s (%s)\n", i+1, c.Name, c.Artist, c.Album, formatDuration(c.Seconds)))
+		}
+		sb.WriteString("Enter a number to choose, empty to skip, or a new search query")
+
+		answer := strings.TrimSpace(m.prompt(sb.String()))
+		if answer == "" {
+			fmt.Fprintln(os.Stderr, track.FileName, "was skipped")
+			return nil, nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil {
+			if n < 1 || n > len(candidates) {
+				fmt.Fprintln(os.Stderr, "choose a number from 1 to", len(candidates))
+				continue
+			}
+			return &candidates[n-1], nil
+		}
+		query = answer
+	}
+}
+
+// リモートの曲の再生時間 (ミリ秒) を m:ss の形式にする
+func formatDuration(milliseconds string) string {
+	ms, err := strconv.Atoi(milliseconds)
+	if err != nil {
+		return "-:--"
+	}
+	seconds := ms / 1000
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
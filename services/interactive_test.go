@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resolveNotFoundTracks(t *testing.T) {
+	x := models.TrackContent{Name: "x", FileName: "x.txt", Position: "1"}
+	y := models.TrackContent{Name: "y", FileName: "y.txt", Position: "3"}
+	a := models.TrackContent{Id: "a", Name: "a", FileName: "a.txt", Position: "2"}
+	plan := service_compares.PlaylistPlan{
+		PlaylistTrackDiff: service_compares.PlaylistTrackDiff{
+			Playlist: service_compares.WithDiffState[models.PlaylistContent]{V: models.PlaylistContent{Id: "p", DirName: "pl"}, DiffState: service_compares.Both},
+			Tracks: []service_compares.WithDiffState[models.TrackContent]{
+				{V: x, DiffState: service_compares.LocalOnly},
+				{V: a, DiffState: service_compares.Both},
+				{V: y, DiffState: service_compares.LocalOnly},
+			},
+			LocalOrder:  []string{"x.txt", "a.txt", "y.txt"},
+			RemoteOrder: []string{"a"},
+		},
+		NotFoundTracks: []models.TrackContent{x, y},
+	}
+	repository := &fakeRepository{candidates: []models.TrackContent{{Id: "c", Name: "c"}}}
+	m := NewService(repository)
+	// xは1番目の候補を選び、yはスキップする
+	answers := []string{"1", ""}
+	m.SetPrompt(func(message string) string {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer
+	})
+
+	actual, err := m.resolveNotFoundTracks([]service_compares.PlaylistPlan{plan})
+	assert.NoError(t, err)
+	assert.Empty(t, answers)
+	assert.Equal(t, []models.TrackContent{{Id: "c", Name: "c", FileName: "x.txt", Position: "1"}}, actual[0].AddedTracks)
+	assert.Equal(t, []models.TrackContent{y}, actual[0].NotFoundTracks)
+	// 追加した曲をローカルの順番に合わせる
+	assert.Equal(t, []service_compares.TrackMove{{Id: "a", RangeStart: 0, InsertBefore: 2}}, actual[0].Moves)
+	// スキップした曲を検索し直さず、曲txtは確認の前に書き込まない
+	assert.Equal(t, []string{"SearchRemoteTrackCandidates x.txt ", "SearchRemoteTrackCandidates y.txt "}, repository.calls)
+}
@@ -4,17 +4,56 @@ import "github.com/kajikentaro/spotify-fbc/models"
 
 type Repository interface {
 	AddRemoteTrack(playlistId string, tracks []models.TrackContent, c chan []models.TrackContent) error
+	ChangeRemotePlaylistDetail(playlist models.PlaylistContent) error
 	CleanUpPlaylistContent() ([]string, error)
+	CreateAlbumContent(album models.AlbumContent) error
+	CreateArtistContent(artist models.ArtistContent) error
+	CreateExportFile(outDir string, fileName string, content string) error
 	CreatePlaylistContent(playlist models.PlaylistContent) error
+	CreatePlaylistCover(dirName string, img []byte) error
 	CreatePlaylistDirectory(playlist models.PlaylistContent) error
-	CreateRemotePlaylist(name string) (models.PlaylistContent, error)
+	CreateRemotePlaylist(playlist models.PlaylistContent) (models.PlaylistContent, error)
 	CreateRootDir() error
 	CreateTrackContent(dirName string, track models.TrackContent) error
+	FetchBaseSnapshot() ([]models.PlaylistSnapshot, error)
+	FetchExcludedPlaylistIds() ([]string, error)
+	FetchHistory(id string) (models.HistorySnapshot, error)
+	FetchHistoryIds() ([]string, error)
+	FetchJournal() ([]models.JournalEntry, error)
+	FetchLibrarySnapshot() (*models.LibrarySnapshot, error)
+	FetchLocalAlbums() ([]models.AlbumContent, error)
+	FetchLocalArtists() ([]models.ArtistContent, error)
 	FetchLocalPlaylistContent() ([]models.PlaylistContent, error)
+	FetchLocalPlaylistCover(dirName string) ([]byte, error)
 	FetchLocalPlaylistTrack(dirName string) ([]models.TrackContent, error)
+	FetchRemoteAlbums() ([]models.AlbumContent, error)
+	FetchRemoteArtists() ([]models.ArtistContent, error)
 	FetchRemotePlaylistContent() ([]models.PlaylistContent, error)
-	FetchRemotePlaylistTrack(id string) ([]models.TrackContent, error)
+	FetchRemotePlaylistCover(playlist models.PlaylistContent) ([]byte, error)
+	FetchRemotePlaylistTrack(playlist models.PlaylistContent) ([]models.TrackContent, error)
+	FetchRemotePlaylistTracks(playlists []models.PlaylistContent) ([][]models.TrackContent, error)
+	FollowRemoteArtists(artists []models.ArtistContent) error
+	FollowRemotePlaylist(playlistId string, public bool) error
+	RemoveAlbumContent(album models.AlbumContent) error
+	RemoveArtistContent(artist models.ArtistContent) error
+	RemovePlaylistDirectory(playlist models.PlaylistContent) error
+	RemoveRemoteAlbums(albums []models.AlbumContent) error
 	RemoveRemotePlaylist(playlist models.PlaylistContent) error
 	RemoveRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) error
 	RemoveTrackContent(dirName string, track models.TrackContent) error
+	RenamePlaylistDirectory(playlist models.PlaylistContent, newDirName string) error
+	RenameRemotePlaylist(playlist models.PlaylistContent, name string) error
+	ReorderRemoteTrack(playlist models.PlaylistContent, rangeStart int, insertBefore int) error
+	ReplaceRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) error
+	SaveBaseSnapshot(snapshots []models.PlaylistSnapshot) error
+	SaveHistory(history models.HistorySnapshot) error
+	SaveLibrarySnapshot(snapshot models.LibrarySnapshot) error
+	SaveRemoteAlbums(albums []models.AlbumContent) error
+	SearchRemoteAlbum(album models.AlbumContent) (*models.AlbumContent, error)
+	SearchRemoteArtist(artist models.ArtistContent) (*models.ArtistContent, error)
+	SearchRemoteTrack(tracks []models.TrackContent) ([]models.TrackContent, []models.TrackContent, error)
+	SearchRemoteTrackCandidates(track models.TrackContent, query string) ([]models.TrackContent, error)
+	SetUndoneRunId(runId string)
+	UnfollowRemoteArtists(artists []models.ArtistContent) error
+	UploadRemotePlaylistCover(playlist models.PlaylistContent, img []byte) error
 }
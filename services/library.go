@@ -0,0 +1,534 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+	"github.com/kajikentaro/spotify-fbc/services/uniques"
+)
+
+// trueの場合はpullで保存したアルバムとフォローしたアーティストもダウンロードする
+func (m *service) SetLibrary(library bool) {
+	m.library = library
+}
+
+// アルバムとアーティストで共通の処理に使う操作
+type libraryKind[T any] struct {
+	dirName       string
+	getId         func(T) string
+	getName       func(T) string
+	getFileName   func(T) string
+	setFileName   func(T, string) T
+	calcDiff      func(local []T, remote []T) []service_compares.WithDiffState[T]
+	fetchLocal    func() ([]T, error)
+	fetchRemote   func() ([]T, error)
+	createContent func(T) error
+	removeContent func(T) error
+	search        func(T) (*T, error)
+	addRemote     func([]T) error
+	removeRemote  func([]T) error
+}
+
+func (m *service) albumKind() libraryKind[models.AlbumContent] {
+	return libraryKind[models.AlbumContent]{
+		dirName:     models.ALBUMS_DIR_NAME,
+		getId:       func(v models.AlbumContent) string { return v.Id },
+		getName:     func(v models.AlbumContent) string { return v.Name },
+		getFileName: func(v models.AlbumContent) string { return v.FileName },
+		setFileName: func(v models.AlbumContent, fileName string) models.AlbumContent {
+			v.FileName = fileName
+			return v
+		},
+		calcDiff:      service_compares.CalcDiffAlbum,
+		fetchLocal:    m.repository.FetchLocalAlbums,
+		fetchRemote:   m.repository.FetchRemoteAlbums,
+		createContent: m.repository.CreateAlbumContent,
+		removeContent: m.repository.RemoveAlbumContent,
+		search:        m.repository.SearchRemoteAlbum,
+		addRemote:     m.repository.SaveRemoteAlbums,
+		removeRemote:  m.repository.RemoveRemoteAlbums,
+	}
+}
+
+func (m *service) artistKind() libraryKind[models.ArtistContent] {
+	return libraryKind[models.ArtistContent]{
+		dirName:     models.ARTISTS_DIR_NAME,
+		getId:       func(v models.ArtistContent) string { return v.Id },
+		getName:     func(v models.ArtistContent) string { return v.Name },
+		getFileName: func(v models.ArtistContent) string { return v.FileName },
+		setFileName: func(v models.ArtistContent, fileName string) models.ArtistContent {
+			v.FileName = fileName
+			return v
+		},
+		calcDiff:      service_compares.CalcDiffArtist,
+		fetchLocal:    m.repository.FetchLocalArtists,
+		fetchRemote:   m.repository.FetchRemoteArtists,
+		createContent: m.repository.CreateArtistContent,
+		removeContent: m.repository.RemoveArtistContent,
+		search:        m.repository.SearchRemoteArtist,
+		addRemote:     m.repository.FollowRemoteArtists,
+		removeRemote:  m.repository.UnfollowRemoteArtists,
+	}
+}
+
+// ローカルのディレクトリを読み込む
+// ディレクトリが無い場合はfalseを返す
+func (k libraryKind[T]) fetchLocalIfExist() ([]T, bool, error) {
+	local, err := k.fetchLocal()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return local, true, nil
+}
+
+func (k libraryKind[T]) ids(values []T) map[string]bool {
+	res := map[string]bool{}
+	for _, v := range values {
+		if id := k.getId(v); id != "" {
+			res[id] = true
+		}
+	}
+	return res
+}
+
+// 最後のpullからのローカルの変更
+type libraryChange[T any] struct {
+	kind   libraryKind[T]
+	local  []T
+	remote []T
+	// baseにもリモートにも無いローカルのtxt
+	added []T
+	// baseとリモートにあるが、ローカルで消されたもの
+	removed []T
+}
+
+// まだbaseが無い場合やローカルにディレクトリが無い場合は、ローカルの変更は無いとみなす
+func loadLibraryChange[T any](k libraryKind[T], base []T, hasBase bool) (libraryChange[T], error) {
+	remote, err := k.fetchRemote()
+	if err != nil {
+		return libraryChange[T]{}, err
+	}
+	local, exists, err := k.fetchLocalIfExist()
+	if err != nil {
+		return libraryChange[T]{}, err
+	}
+	res := libraryChange[T]{kind: k, local: local, remote: remote}
+	if !hasBase || !exists {
+		return res, nil
+	}
+
+	baseIds := k.ids(base)
+	remoteIds := k.ids(remote)
+	localIds := k.ids(local)
+	for _, v := range local {
+		id := k.getId(v)
+		if id == "" || (!baseIds[id] && !remoteIds[id]) {
+			res.added = append(res.added, v)
+		}
+	}
+	for _, v := range remote {
+		id := k.getId(v)
+		if baseIds[id] && !localIds[id] {
+			res.removed = append(res.removed, v)
+		}
+	}
+	return res, nil
+}
+
+func (c libraryChange[T]) descriptions() []string {
+	res := []string{}
+	for _, v := range c.added {
+		res = append(res, "+ "+filepath.Join(c.kind.dirName, c.kind.getFileName(v)))
+	}
+	for _, v := range c.removed {
+		res = append(res, "- "+filepath.Join(c.kind.dirName, c.kind.getName(v)))
+	}
+	return res
+}
+
+// ディレクトリ内のtxtをリモートの状態で作り直す
+// keepLocalがtrueの場合はローカルの変更を残す
+func (c libraryChange[T]) write(keepLocal bool) error {
+	k := c.kind
+	usedFileStem := uniques.NewUnique()
+	kept := map[string]bool{}
+	for _, v := range c.local {
+		if keepLocal && containsLibrary(k, c.added, v) {
+			fileStem, _ := getFileStem(k.getFileName(v))
+			usedFileStem.Add(fileStem)
+			kept[k.getId(v)] = true
+			continue
+		}
+		if err := k.removeContent(v); err != nil {
+			return err
+		}
+	}
+
+	removed := k.ids(c.removed)
+	for _, v := range c.remote {
+		id := k.getId(v)
+		if kept[id] || (keepLocal && removed[id]) {
+			continue
+		}
+		v = k.setFileName(v, usedFileStem.Take(replaceBannedCharacter(k.getName(v)))+".txt")
+		if err := k.createContent(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsLibrary[T any](k libraryKind[T], values []T, target T) bool {
+	for _, v := range values {
+		if k.getFileName(v) == k.getFileName(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullで扱うライブラリの変更
+type libraryChanges struct {
+	albums  libraryChange[models.AlbumContent]
+	artists libraryChange[models.ArtistContent]
+}
+
+// ライブラリを扱わない場合はnilを返す
+func (m *service) loadLibraryChanges() (*libraryChanges, error) {
+	if !m.library {
+		return nil, nil
+	}
+	base, err := m.repository.FetchLibrarySnapshot()
+	if err != nil {
+		return nil, err
+	}
+	// 初めてのpullではローカルの変更を調べない
+	hasBase := base != nil
+	if base == nil {
+		base = &models.LibrarySnapshot{}
+	}
+	albums, err := loadLibraryChange(m.albumKind(), base.Albums, hasBase)
+	if err != nil {
+		return nil, err
+	}
+	artists, err := loadLibraryChange(m.artistKind(), base.Artists, hasBase)
+	if err != nil {
+		return nil, err
+	}
+	return &libraryChanges{albums: albums, artists: artists}, nil
+}
+
+func (c *libraryChanges) descriptions() []string {
+	if c == nil {
+		return nil
+	}
+	return append(c.albums.descriptions(), c.artists.descriptions()...)
+}
+
+// ライブラリのディレクトリを書き換え、次回のpullのためにリモートの状態を保存する
+func (m *service) pullLibrary(c *libraryChanges, keepLocal bool) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.albums.write(keepLocal); err != nil {
+		return err
+	}
+	if err := c.artists.write(keepLocal); err != nil {
+		return err
+	}
+	return m.repository.SaveLibrarySnapshot(models.LibrarySnapshot{Albums: c.albums.remote, Artists: c.artists.remote})
+}
+
+// overwriteでリモートに反映するライブラリの変更
+type libraryPlan[T any] struct {
+	kind libraryKind[T]
+	// 保存/フォローするもの
+	added []T
+	// 削除/フォロー解除するもの
+	removed []T
+	// idが無く、検索で見つかったローカルのtxt (idを書き込む)
+	resolved []T
+	// 検索で見つからなかったローカルのtxt
+	notFound []T
+	// リモートにある数
+	total int
+}
+
+// idの無いtxtを検索してから、ローカルとリモートの差分を計算する
+// リモートにだけあるものは、最後のpullの時にあった(ローカルで削除された)ものだけを削除する
+// 最後のpullから他のアプリで保存したものは削除しない
+// ローカルにディレクトリが無い場合はnilを返す
+func planLibrary[T any](k libraryKind[T], base []T, hasBase bool) (*libraryPlan[T], error) {
+	local, exists, err := k.fetchLocalIfExist()
+	if err != nil || !exists {
+		return nil, err
+	}
+	remote, err := k.fetchRemote()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &libraryPlan[T]{kind: k, total: len(remote)}
+	withId := []T{}
+	for _, v := range local {
+		if k.getId(v) != "" {
+			withId = append(withId, v)
+			continue
+		}
+		found, err := k.search(v)
+		if err != nil {
+			return nil, err
+		}
+		if found == nil {
+			res.notFound = append(res.notFound, v)
+			continue
+		}
+		resolved := k.setFileName(*found, k.getFileName(v))
+		res.resolved = append(res.resolved, resolved)
+		withId = append(withId, resolved)
+	}
+
+	baseIds := k.ids(base)
+	for _, v := range k.calcDiff(withId, remote) {
+		switch v.DiffState {
+		case service_compares.LocalOnly:
+			res.added = append(res.added, v.V)
+		case service_compares.RemoteOnly:
+			if hasBase && baseIds[k.getId(v.V)] {
+				res.removed = append(res.removed, v.V)
+			}
+		}
+	}
+	return res, nil
+}
+
+// 反映した変更をbaseに加える
+func (p *libraryPlan[T]) updateBase(base []T) []T {
+	if p == nil {
+		return base
+	}
+	removed := p.kind.ids(p.removed)
+	res := []T{}
+	for _, v := range base {
+		if !removed[p.kind.getId(v)] {
+			res = append(res, v)
+		}
+	}
+	return append(res, p.added...)
+}
+
+func (p *libraryPlan[T]) writeText(w io.Writer) error {
+	if p == nil || (len(p.added) == 0 && len(p.removed) == 0 && len(p.notFound) == 0) {
+		return nil
+	}
+	lines := []string{p.kind.dirName}
+	for _, v := range p.added {
+		lines = append(lines, "  + "+p.kind.getName(v))
+	}
+	for _, v := range p.removed {
+		lines = append(lines, "  - "+p.kind.getName(v))
+	}
+	for _, v := range p.notFound {
+		lines = append(lines, "  ? "+p.kind.getFileName(v)+" (not found)")
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *libraryPlan[T]) deletion() []trackDeletion {
+	if p == nil || len(p.removed) == 0 {
+		return nil
+	}
+	return []trackDeletion{{playlistName: p.kind.dirName, removed: len(p.removed), total: p.total}}
+}
+
+// 計算した変更をリモートに反映し、検索で見つかったtxtにidを書き込む
+func (p *libraryPlan[T]) apply() (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	k := p.kind
+	for _, v := range p.notFound {
+		fmt.Fprintln(os.Stderr, filepath.Join(k.dirName, k.getFileName(v)), "was not found. write the id to the file")
+	}
+	for _, v := range p.resolved {
+		if err := k.createContent(v); err != nil {
+			return false, err
+		}
+	}
+	if len(p.added) == 0 && len(p.removed) == 0 {
+		return false, nil
+	}
+
+	fmt.Println(" ", k.dirName)
+	if err := k.addRemote(p.added); err != nil {
+		return false, err
+	}
+	for _, v := range p.added {
+		fmt.Println("  +", k.getName(v))
+	}
+	if err := k.removeRemote(p.removed); err != nil {
+		return false, err
+	}
+	for _, v := range p.removed {
+		fmt.Println("  -", k.getName(v))
+	}
+	return true, nil
+}
+
+// planファイルに保存するライブラリの変更
+type savedLibraryPlan[T any] struct {
+	Added    []T `json:"added"`
+	Removed  []T `json:"removed"`
+	Resolved []T `json:"resolved"`
+	NotFound []T `json:"not_found"`
+	Total    int `json:"total"`
+}
+
+func (p *libraryPlan[T]) save() *savedLibraryPlan[T] {
+	if p == nil {
+		return nil
+	}
+	return &savedLibraryPlan[T]{Added: p.added, Removed: p.removed, Resolved: p.resolved, NotFound: p.notFound, Total: p.total}
+}
+
+func loadLibraryPlan[T any](k libraryKind[T], s *savedLibraryPlan[T]) *libraryPlan[T] {
+	if s == nil {
+		return nil
+	}
+	return &libraryPlan[T]{kind: k, added: s.Added, removed: s.Removed, resolved: s.Resolved, notFound: s.NotFound, total: s.Total}
+}
+
+// 追加するものがまだリモートに無く、削除するものがまだリモートにあるか確認する
+func (p *libraryPlan[T]) checkIsUpToDate() error {
+	if p == nil || (len(p.added) == 0 && len(p.removed) == 0) {
+		return nil
+	}
+	remote, err := p.kind.fetchRemote()
+	if err != nil {
+		return err
+	}
+	remoteIds := p.kind.ids(remote)
+	for _, v := range p.added {
+		if remoteIds[p.kind.getId(v)] {
+			return fmt.Errorf("'%s' was added to %s on remote after the plan was made. make the plan again", p.kind.getName(v), p.kind.dirName)
+		}
+	}
+	for _, v := range p.removed {
+		if !remoteIds[p.kind.getId(v)] {
+			return fmt.Errorf("'%s' was removed from %s on remote after the plan was made. make the plan again", p.kind.getName(v), p.kind.dirName)
+		}
+	}
+	return nil
+}
+
+// overwriteで扱うライブラリの変更
+type libraryPlans struct {
+	albums  *libraryPlan[models.AlbumContent]
+	artists *libraryPlan[models.ArtistContent]
+}
+
+// pullでライブラリを扱う設定になっていない場合は何もしない
+func (m *service) planLibraries() (libraryPlans, error) {
+	if !m.library {
+		return libraryPlans{}, nil
+	}
+	base, err := m.repository.FetchLibrarySnapshot()
+	if err != nil {
+		return libraryPlans{}, err
+	}
+	hasBase := base != nil
+	if base == nil {
+		base = &models.LibrarySnapshot{}
+	}
+	albums, err := planLibrary(m.albumKind(), base.Albums, hasBase)
+	if err != nil {
+		return libraryPlans{}, err
+	}
+	artists, err := planLibrary(m.artistKind(), base.Artists, hasBase)
+	if err != nil {
+		return libraryPlans{}, err
+	}
+	return libraryPlans{albums: albums, artists: artists}, nil
+}
+
+func (p libraryPlans) writeText(w io.Writer) error {
+	if err := p.albums.writeText(w); err != nil {
+		return err
+	}
+	return p.artists.writeText(w)
+}
+
+func (p libraryPlans) deletion() []trackDeletion {
+	return append(p.albums.deletion(), p.artists.deletion()...)
+}
+
+func (p libraryPlans) apply() (bool, error) {
+	albumsChanged, err := p.albums.apply()
+	if err != nil {
+		return false, err
+	}
+	artistsChanged, err := p.artists.apply()
+	if err != nil {
+		return false, err
+	}
+	return albumsChanged || artistsChanged, nil
+}
+
+// 変更をリモートに反映し、ローカルで削除されたものを次回も判別できるようにbaseを更新する
+func (m *service) applyLibraries(p libraryPlans) (bool, error) {
+	changed, err := p.apply()
+	if err != nil || !changed {
+		return changed, err
+	}
+	base, err := m.repository.FetchLibrarySnapshot()
+	if err != nil || base == nil {
+		return changed, err
+	}
+	base.Albums = p.albums.updateBase(base.Albums)
+	base.Artists = p.artists.updateBase(base.Artists)
+	return changed, m.repository.SaveLibrarySnapshot(*base)
+}
+
+func (p libraryPlans) checkIsUpToDate() error {
+	if err := p.albums.checkIsUpToDate(); err != nil {
+		return err
+	}
+	return p.artists.checkIsUpToDate()
+}
+
+// プレイリストのディレクトリ名がライブラリやお気に入りの曲のディレクトリ名と重ならないようにする
+func newDirNameUnique() *uniques.Unique {
+	used := uniques.NewUnique()
+	used.Add(models.ALBUMS_DIR_NAME)
+	used.Add(models.ARTISTS_DIR_NAME)
+	used.Add(models.LIKED_SONGS_NAME)
+	return used
+}
+
+// 新しく作るプレイリストのディレクトリ名を決める
+// お気に入りの曲は予約されたディレクトリ名を使う
+func takeDirName(usedDirName *uniques.Unique, playlist models.PlaylistContent) string {
+	if playlist.IsLikedSongs() {
+		return models.LIKED_SONGS_NAME
+	}
+	return usedDirName.Take(replaceBannedCharacter(playlist.Name))
+}
+
+// お気に入りの曲以外のプレイリストが予約されたディレクトリ名を使っているか
+func usesLikedSongsDirName(playlist models.PlaylistContent) bool {
+	return !playlist.IsLikedSongs() && strings.EqualFold(playlist.DirName, models.LIKED_SONGS_NAME)
+}
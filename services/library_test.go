@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+	"github.com/stretchr/testify/assert"
+)
+
+// ローカルのtxtをファイル名をキーにしたmapで扱う
+func newTestArtistKind(local map[string]models.ArtistContent, remote []models.ArtistContent) libraryKind[models.ArtistContent] {
+	return libraryKind[models.ArtistContent]{
+		dirName:     models.ARTISTS_DIR_NAME,
+		getId:       func(v models.ArtistContent) string { return v.Id },
+		getName:     func(v models.ArtistContent) string { return v.Name },
+		getFileName: func(v models.ArtistContent) string { return v.FileName },
+		setFileName: func(v models.ArtistContent, fileName string) models.ArtistContent {
+			v.FileName = fileName
+			return v
+		},
+		calcDiff: service_compares.CalcDiffArtist,
+		fetchLocal: func() ([]models.ArtistContent, error) {
+			res := []models.ArtistContent{}
+			for _, v := range local {
+				res = append(res, v)
+			}
+			sort.Slice(res, func(i, j int) bool { return res[i].FileName < res[j].FileName })
+			return res, nil
+		},
+		fetchRemote: func() ([]models.ArtistContent, error) { return remote, nil },
+		createContent: func(v models.ArtistContent) error {
+			local[v.FileName] = v
+			return nil
+		},
+		removeContent: func(v models.ArtistContent) error {
+			delete(local, v.FileName)
+			return nil
+		},
+		search: func(v models.ArtistContent) (*models.ArtistContent, error) {
+			if v.Name == "unknown" {
+				return nil, nil
+			}
+			return &models.ArtistContent{Id: "id-" + v.Name, Name: v.Name}, nil
+		},
+	}
+}
+
+func Test_libraryChange(t *testing.T) {
+	base := []models.ArtistContent{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}, {Id: "c", Name: "C"}}
+	// リモートではcが削除され、dが追加された
+	remote := []models.ArtistContent{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}, {Id: "d", Name: "D"}}
+	// ローカルではbが削除され、eが追加された
+	local := map[string]models.ArtistContent{
+		"A.txt": {Id: "a", Name: "A", FileName: "A.txt"},
+		"C.txt": {Id: "c", Name: "C", FileName: "C.txt"},
+		"E.txt": {Name: "E", FileName: "E.txt"},
+	}
+
+	change, err := loadLibraryChange(newTestArtistKind(local, remote), base, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"+ _artists/E.txt", "- _artists/B"}, change.descriptions())
+
+	// ローカルの変更を残してリモートの変更を反映する
+	assert.NoError(t, change.write(true))
+	fileNames := []string{}
+	for k := range local {
+		fileNames = append(fileNames, k)
+	}
+	sort.Strings(fileNames)
+	assert.Equal(t, []string{"A.txt", "D.txt", "E.txt"}, fileNames)
+
+	// baseが無い場合はローカルの変更を調べない
+	change, err = loadLibraryChange(newTestArtistKind(local, remote), nil, false)
+	assert.NoError(t, err)
+	assert.Empty(t, change.descriptions())
+	assert.NoError(t, change.write(false))
+	assert.Len(t, local, 3)
+	assert.Equal(t, "b", local["B.txt"].Id)
+}
+
+func Test_planLibrary(t *testing.T) {
+	remote := []models.ArtistContent{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}, {Id: "id-C", Name: "C"}}
+	local := map[string]models.ArtistContent{
+		"A.txt": {Id: "a", Name: "A", FileName: "A.txt"},
+		// 同じアーティストのtxtが2つある
+		"A 2.txt": {Id: "a", Name: "A", FileName: "A 2.txt"},
+		"C.txt":   {Name: "C", FileName: "C.txt"},
+		"D.txt":   {Name: "D", FileName: "D.txt"},
+		"x.txt":   {Name: "unknown", FileName: "x.txt"},
+	}
+
+	// eは最後のpullの後にSpotifyでフォローした
+	remote = append(remote, models.ArtistContent{Id: "e", Name: "E"})
+	base := []models.ArtistContent{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}}
+
+	plan, err := planLibrary(newTestArtistKind(local, remote), base, true)
+	assert.NoError(t, err)
+	// 検索で見つかったものはローカルのファイル名を使う
+	assert.Equal(t, []models.ArtistContent{{Id: "id-D", Name: "D", FileName: "D.txt"}}, plan.added)
+	// ローカルで削除したbだけフォローを解除する
+	assert.Equal(t, []models.ArtistContent{{Id: "b", Name: "B"}}, plan.removed)
+	assert.Equal(t, []models.ArtistContent{{Name: "unknown", FileName: "x.txt"}}, plan.notFound)
+	assert.Equal(t, []trackDeletion{{playlistName: models.ARTISTS_DIR_NAME, removed: 1, total: 4}}, plan.deletion())
+	assert.Equal(t, []models.ArtistContent{{Id: "a", Name: "A"}, {Id: "id-D", Name: "D", FileName: "D.txt"}}, plan.updateBase(base))
+
+	// baseが無い場合は何も削除しない
+	plan, err = planLibrary(newTestArtistKind(local, remote), nil, false)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.removed)
+}
+
+func Test_savedLibraryPlan(t *testing.T) {
+	remote := []models.ArtistContent{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}}
+	local := map[string]models.ArtistContent{
+		"A.txt": {Id: "a", Name: "A", FileName: "A.txt"},
+		"C.txt": {Name: "C", FileName: "C.txt"},
+	}
+	k := newTestArtistKind(local, remote)
+	plan, err := planLibrary(k, remote, true)
+	assert.NoError(t, err)
+
+	// planファイルに保存して読み込んでも同じ変更になる
+	data, err := json.Marshal(plan.save())
+	assert.NoError(t, err)
+	saved := &savedLibraryPlan[models.ArtistContent]{}
+	assert.NoError(t, json.Unmarshal(data, saved))
+	loaded := loadLibraryPlan(k, saved)
+	assert.Equal(t, plan.added, loaded.added)
+	assert.Equal(t, plan.removed, loaded.removed)
+	assert.Equal(t, plan.deletion(), loaded.deletion())
+	assert.NoError(t, loaded.checkIsUpToDate())
+
+	// 計算した後にリモートでbのフォローが解除された
+	loaded.kind = newTestArtistKind(local, []models.ArtistContent{{Id: "a", Name: "A"}})
+	assert.Error(t, loaded.checkIsUpToDate())
+	// 計算した後にリモートでCがフォローされた
+	loaded.kind = newTestArtistKind(local, append(remote, models.ArtistContent{Id: "id-C", Name: "C"}))
+	assert.Error(t, loaded.checkIsUpToDate())
+
+	var empty *libraryPlan[models.ArtistContent]
+	assert.Nil(t, empty.save())
+	assert.Nil(t, loadLibraryPlan(k, nil))
+}
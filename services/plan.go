@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+)
+
+// planファイルの形式を変えた場合は上げる
+// 1: ライブラリの変更とカバー画像を含めるようにした
+const PLAN_FILE_VERSION = 1
+
+// SavePlanで保存するファイルの内容
+type planFile struct {
+	Version   int                                     `json:"version"`
+	Playlists []service_compares.PlaylistPlan         `json:"playlists"`
+	Albums    *savedLibraryPlan[models.AlbumContent]  `json:"albums,omitempty"`
+	Artists   *savedLibraryPlan[models.ArtistContent] `json:"artists,omitempty"`
+}
+
+// overwriteで行われる変更を計算してpathに保存する
+// 保存した変更はApplyPlanで後から実行できる
+func (m *service) SavePlan(path string) error {
+	fmt.Fprintln(os.Stderr, "now loading ...")
+	compare := service_compares.NewCompare(m.repository)
+	plans, err := compare.PlanAllPlaylist()
+	if err != nil {
+		return err
+	}
+	library, err := m.planLibraries()
+	if err != nil {
+		return err
+	}
+
+	file := planFile{Version: PLAN_FILE_VERSION, Playlists: plans, Albums: library.albums.save(), Artists: library.artists.save()}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	// アカウントの情報を含むので本人だけが読めるようにする
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	summary := summarizePlanDeletion(plans)
+	summary.library = library.deletion()
+	m.warnMassDeletion(summary)
+	if err := writePlanText(os.Stdout, plans); err != nil {
+		return err
+	}
+	if err := library.writeText(os.Stdout); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "the plan was saved to", path)
+	return nil
+}
+
+// SavePlanで保存した変更をそのまま実行する
+// リモートに送る内容はすべてplanファイルのものを使い、ローカルのファイルは読み直さない
+// 計算した時からリモートのプレイリストやライブラリが変更されている場合は何も実行しない
+// confirmには削除される内容が渡され、falseを返した場合は実行しない
+func (m *service) ApplyPlan(path string, confirm func(summary string) bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := parsePlanFile(data)
+	if err != nil {
+		return fmt.Errorf("failed to read the plan %s: %w", path, err)
+	}
+	plans := file.Playlists
+	library := libraryPlans{
+		albums:  loadLibraryPlan(m.albumKind(), file.Albums),
+		artists: loadLibraryPlan(m.artistKind(), file.Artists),
+	}
+
+	remotePLs, err := m.checkPlanIsUpToDate(plans)
+	if err != nil {
+		return err
+	}
+	if err := library.checkIsUpToDate(); err != nil {
+		return err
+	}
+	summary := summarizePlanDeletion(plans)
+	summary.library = library.deletion()
+	ok, err := m.confirmDeletion(summary, confirm)
+	if err != nil || !ok {
+		return err
+	}
+
+	// 変更前のリモートの状態を履歴として残す
+	remoteTracks, err := m.repository.FetchRemotePlaylistTracks(remotePLs)
+	if err != nil {
+		return err
+	}
+	if err := m.archiveRemoteState(remotePLs, remoteTracks); err != nil {
+		return err
+	}
+
+	changed := false
+	for _, v := range plans {
+		if !v.HasDifference() {
+			continue
+		}
+		_changed, err := m.syncLocalPlaylistWithRemote(v)
+		if err != nil {
+			return err
+		}
+		changed = changed || _changed
+	}
+	libraryChanged, err := m.applyLibraries(library)
+	if err != nil {
+		return err
+	}
+	changed = changed || libraryChanged
+
+	if err := m.cleanUpPlaylistContent(); err != nil {
+		return err
+	}
+
+	if !changed {
+		fmt.Println("\nthere was no change on remote")
+	}
+	return nil
+}
+
+// 変更対象のリモートのプレイリストのsnapshot_idが、計算した時から変わっていないか確認する
+// 確認に使ったリモートのプレイリストを返す
+func (m *service) checkPlanIsUpToDate(plans []service_compares.PlaylistPlan) ([]models.PlaylistContent, error) {
+	remotePLs, err := m.repository.FetchRemotePlaylistContent()
+	if err != nil {
+		return nil, err
+	}
+	idToSnapshotId := map[string]string{}
+	for _, v := range remotePLs {
+		idToSnapshotId[v.Id] = v.SnapshotId
+	}
+
+	for _, v := range plans {
+		pl := v.Playlist.V
+		if pl.Id == "" || !v.HasDifference() {
+			continue
+		}
+		snapshotId, ok := idToSnapshotId[pl.Id]
+		if !ok {
+			return nil, fmt.Errorf("playlist '%s' was removed on remote after the plan was made. make the plan again", pl.Name)
+		}
+		if snapshotId != pl.SnapshotId {
+			return nil, fmt.Errorf("playlist '%s' was changed on remote after the plan was made. make the plan again", pl.Name)
+		}
+	}
+	return remotePLs, nil
+}
+
+func parsePlanFile(data []byte) (planFile, error) {
+	// 最初の形式はプレイリストの配列だけだった
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return planFile{}, fmt.Errorf("the plan was made by an older version. make the plan again")
+	}
+	file := planFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return planFile{}, err
+	}
+	if file.Version != PLAN_FILE_VERSION {
+		return planFile{}, fmt.Errorf("the plan version %d is not supported. make the plan again", file.Version)
+	}
+	return file, nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+func Test_ApplyPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		plan     string
+		expected []string
+		isErr    bool
+	}{
+		{
+			// 変更の無いplanでも、overwriteと同じく後片付けをする
+			name:     "no change",
+			plan:     `{"version": 1, "playlists": []}`,
+			expected: []string{"SaveHistory", "CleanUpPlaylistContent"},
+		},
+		{
+			// ローカルのcover.jpgではなく、planに保存されたカバー画像をアップロードする
+			name: "cover",
+			plan: `{"version": 1, "playlists": [{
+				"playlist": {"value": {"id": "p", "name": "pl", "dir_name": "pl", "snapshot_id": "s"}, "diff_state": "both"},
+				"cover_changed": true, "cover": "aW1n"
+			}]}`,
+			expected: []string{"SaveHistory", "UploadRemotePlaylistCover p img", "CreatePlaylistContent pl", "CleanUpPlaylistContent"},
+		},
+		{
+			name:  "old format",
+			plan:  `[]`,
+			isErr: true,
+		},
+		{
+			name:  "unknown version",
+			plan:  `{"playlists": []}`,
+			isErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := os.WriteFile(path, []byte(tt.plan), 0600); err != nil {
+				t.Fatal(err)
+			}
+			repository := &fakeRepository{remotePlaylists: []models.PlaylistContent{{Id: "p", Name: "pl", SnapshotId: "s"}}}
+			m := NewService(repository)
+			err := m.ApplyPlan(path, nil)
+			if tt.isErr {
+				if err == nil {
+					t.Error("error must be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(repository.calls, tt.expected) {
+				t.Errorf("actual: %v, expected: %v", repository.calls, tt.expected)
+			}
+		})
+	}
+}
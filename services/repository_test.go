@@ -0,0 +1,202 @@
+package services
+
+import (
+	"github.com/kajikentaro/spotify-fbc/models"
+	"github.com/kajikentaro/spotify-fbc/services/interfaces"
+)
+
+// テストで使うメソッドだけを実装し、呼ばれた操作を記録するリポジトリ
+// 実装していないメソッドを呼ぶとpanicする
+type fakeRepository struct {
+	interfaces.Repository
+	localPlaylists  []models.PlaylistContent
+	remotePlaylists []models.PlaylistContent
+	excludedIds     []string
+	base            []models.PlaylistSnapshot
+	// ディレクトリ名がキー
+	localTracks map[string][]models.TrackContent
+	// プレイリストのidがキー
+	remoteTracks map[string][]models.TrackContent
+	calls        []string
+	// FetchRemotePlaylistContentが呼ばれた回数
+	remoteFetches int
+	// 履歴のidがキー
+	histories map[string]models.HistorySnapshot
+	// SearchRemoteTrackCandidatesが返す候補
+	candidates []models.TrackContent
+	// ディレクトリ名がキー
+	localCovers map[string][]byte
+	// プレイリストのidがキー
+	remoteCovers map[string][]byte
+}
+
+func (r *fakeRepository) CreateRootDir() error {
+	return nil
+}
+
+func (r *fakeRepository) FetchBaseSnapshot() ([]models.PlaylistSnapshot, error) {
+	return r.base, nil
+}
+
+func (r *fakeRepository) SaveBaseSnapshot(snapshots []models.PlaylistSnapshot) error {
+	r.calls = append(r.calls, "SaveBaseSnapshot")
+	r.base = snapshots
+	return nil
+}
+
+func (r *fakeRepository) FetchLocalPlaylistTrack(dirName string) ([]models.TrackContent, error) {
+	return r.localTracks[dirName], nil
+}
+
+func (r *fakeRepository) FetchLocalPlaylistCover(dirName string) ([]byte, error) {
+	return r.localCovers[dirName], nil
+}
+
+func (r *fakeRepository) FetchRemotePlaylistTrack(playlist models.PlaylistContent) ([]models.TrackContent, error) {
+	return r.remoteTracks[playlist.Id], nil
+}
+
+func (r *fakeRepository) FetchExcludedPlaylistIds() ([]string, error) {
+	return r.excludedIds, nil
+}
+
+func (r *fakeRepository) FetchLocalPlaylistContent() ([]models.PlaylistContent, error) {
+	return r.localPlaylists, nil
+}
+
+func (r *fakeRepository) RemovePlaylistDirectory(playlist models.PlaylistContent) error {
+	r.calls = append(r.calls, "RemovePlaylistDirectory "+playlist.DirName)
+	return nil
+}
+
+func (r *fakeRepository) RemoveRemotePlaylist(playlist models.PlaylistContent) error {
+	r.calls = append(r.calls, "RemoveRemotePlaylist "+playlist.Id)
+	return nil
+}
+
+func (r *fakeRepository) FetchRemotePlaylistContent() ([]models.PlaylistContent, error) {
+	r.remoteFetches++
+	return r.remotePlaylists, nil
+}
+
+func (r *fakeRepository) FollowRemotePlaylist(playlistId string, public bool) error {
+	r.calls = append(r.calls, "FollowRemotePlaylist "+playlistId)
+	return nil
+}
+
+func (r *fakeRepository) RenameRemotePlaylist(playlist models.PlaylistContent, name string) error {
+	r.calls = append(r.calls, "RenameRemotePlaylist "+playlist.Id)
+	return nil
+}
+
+func (r *fakeRepository) ChangeRemotePlaylistDetail(playlist models.PlaylistContent) error {
+	r.calls = append(r.calls, "ChangeRemotePlaylistDetail "+playlist.Id+" "+playlist.Name)
+	return nil
+}
+
+func (r *fakeRepository) ReplaceRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	r.calls = append(r.calls, "ReplaceRemoteTrack "+playlist.Id)
+	return nil
+}
+
+func (r *fakeRepository) FetchRemotePlaylistTracks(playlists []models.PlaylistContent) ([][]models.TrackContent, error) {
+	res := [][]models.TrackContent{}
+	for _, v := range playlists {
+		res = append(res, r.remoteTracks[v.Id])
+	}
+	return res, nil
+}
+
+func (r *fakeRepository) SaveHistory(history models.HistorySnapshot) error {
+	r.calls = append(r.calls, "SaveHistory")
+	return nil
+}
+
+func (r *fakeRepository) CleanUpPlaylistContent() ([]string, error) {
+	r.calls = append(r.calls, "CleanUpPlaylistContent")
+	return nil, nil
+}
+
+func (r *fakeRepository) RenamePlaylistDirectory(playlist models.PlaylistContent, newDirName string) error {
+	r.calls = append(r.calls, "RenamePlaylistDirectory "+playlist.DirName+" -> "+newDirName)
+	return nil
+}
+
+func (r *fakeRepository) CreatePlaylistContent(playlist models.PlaylistContent) error {
+	r.calls = append(r.calls, "CreatePlaylistContent "+playlist.DirName)
+	return nil
+}
+
+func (r *fakeRepository) UploadRemotePlaylistCover(playlist models.PlaylistContent, img []byte) error {
+	r.calls = append(r.calls, "UploadRemotePlaylistCover "+playlist.Id+" "+string(img))
+	return nil
+}
+
+func (r *fakeRepository) AddRemoteTrack(playlistId string, tracks []models.TrackContent, c chan []models.TrackContent) error {
+	if len(tracks) == 0 {
+		return nil
+	}
+	r.calls = append(r.calls, "AddRemoteTrack "+playlistId)
+	c <- tracks
+	return nil
+}
+
+func (r *fakeRepository) RemoveRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	if len(tracks) == 0 {
+		return nil
+	}
+	r.calls = append(r.calls, "RemoveRemoteTrack "+playlist.Id)
+	return nil
+}
+
+func (r *fakeRepository) CreatePlaylistDirectory(playlist models.PlaylistContent) error {
+	r.calls = append(r.calls, "CreatePlaylistDirectory "+playlist.DirName)
+	return nil
+}
+
+func (r *fakeRepository) FetchRemotePlaylistCover(playlist models.PlaylistContent) ([]byte, error) {
+	return r.remoteCovers[playlist.Id], nil
+}
+
+func (r *fakeRepository) CreateExportFile(outDir string, fileName string, content string) error {
+	r.calls = append(r.calls, "CreateExportFile "+outDir+"/"+fileName)
+	return nil
+}
+
+// idがある曲だけを見つかったものとして返す
+func (r *fakeRepository) SearchRemoteTrack(tracks []models.TrackContent) ([]models.TrackContent, []models.TrackContent, error) {
+	found := []models.TrackContent{}
+	notFound := []models.TrackContent{}
+	for _, v := range tracks {
+		if v.Id == "" {
+			notFound = append(notFound, v)
+		} else {
+			found = append(found, v)
+		}
+	}
+	return found, notFound, nil
+}
+
+func (r *fakeRepository) CreatePlaylistCover(dirName string, img []byte) error {
+	r.calls = append(r.calls, "CreatePlaylistCover "+dirName+" "+string(img))
+	return nil
+}
+
+func (r *fakeRepository) CreateTrackContent(dirName string, track models.TrackContent) error {
+	r.calls = append(r.calls, "CreateTrackContent "+dirName+"/"+track.FileName)
+	return nil
+}
+
+func (r *fakeRepository) RemoveTrackContent(dirName string, track models.TrackContent) error {
+	r.calls = append(r.calls, "RemoveTrackContent "+dirName+"/"+track.FileName)
+	return nil
+}
+
+func (r *fakeRepository) FetchHistory(id string) (models.HistorySnapshot, error) {
+	return r.histories[id], nil
+}
+
+func (r *fakeRepository) SearchRemoteTrackCandidates(track models.TrackContent, query string) ([]models.TrackContent, error) {
+	r.calls = append(r.calls, "SearchRemoteTrackCandidates "+track.FileName+" "+query)
+	return r.candidates, nil
+}
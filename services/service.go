@@ -6,6 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kajikentaro/spotify-fbc/models"
 	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
@@ -15,11 +18,17 @@ import (
 )
 
 type service struct {
-	repository interfaces.Repository
+	repository  interfaces.Repository
+	deleteLimit DeleteLimit
+	prompt      func(message string) string
+	// trueの場合はpullでライブラリも扱う
+	library bool
+	// trueの場合はpullで再生できない曲を再生できる同じ曲に置き換える
+	relink bool
 }
 
 func NewService(repository interfaces.Repository) service {
-	return service{repository: repository}
+	return service{repository: repository, deleteLimit: DEFAULT_DELETE_LIMIT}
 }
 
 func getFileStem(fileName string) (string, error) {
@@ -59,6 +68,16 @@ func (m *service) recreateTrackTxt(usedFileStem *uniques.Unique, playlist models
 	}
 }
 
+// ローカルの曲を検索し、見つかった曲をリモートのプレイリストに追加する
+func (m *service) searchAndAddRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) ([]models.TrackContent, error) {
+	found, _, err := m.repository.SearchRemoteTrack(tracks)
+	if err != nil {
+		return nil, err
+	}
+	return m.addRemoteTrack(playlist, found)
+}
+
+// 検索済みの曲をリモートのプレイリストに追加する
 func (m *service) addRemoteTrack(playlist models.PlaylistContent, tracks []models.TrackContent) ([]models.TrackContent, error) {
 	// 曲をリモートのプレイリストに追加
 	c := make(chan []models.TrackContent)
@@ -87,13 +106,21 @@ func (m *service) addRemoteTrack(playlist models.PlaylistContent, tracks []model
 	return successfulTracks, nil
 }
 
-func (m *service) syncLocalPlaylistWithRemote(v service_compares.PlaylistTrackDiff) (changed bool, err error) {
+func (m *service) syncLocalPlaylistWithRemote(v service_compares.PlaylistPlan) (changed bool, err error) {
 	pl := v.Playlist
+	if v.Skipped {
+		if pl.V.IsLikedSongs() && pl.DiffState == service_compares.LocalOnly {
+			fmt.Fprintln(os.Stderr, "Warning: local changes are ignored because pull --liked-songs is not enabled:", pl.V.DirName)
+		} else if pl.DiffState != service_compares.RemoteOnly && v.PlaylistTrackDiff.HasDifference() {
+			fmt.Fprintln(os.Stderr, "Warning: local changes are ignored because you don't own the playlist:", pl.V.Name)
+		}
+		return false, nil
+	}
 
 	// プレイリストの作成/削除
 	if pl.DiffState == service_compares.LocalOnly {
 		// プレイリストをリモートに作成
-		resPlaylist, err := m.repository.CreateRemotePlaylist(pl.V.DirName)
+		resPlaylist, err := m.repository.CreateRemotePlaylist(pl.V)
 		if err != nil {
 			return false, err
 		}
@@ -103,6 +130,13 @@ func (m *service) syncLocalPlaylistWithRemote(v service_compares.PlaylistTrackDi
 		m.repository.CreatePlaylistContent(resPlaylist)
 		changed = true
 		fmt.Println("+", pl.V.DirName)
+
+		// カバー画像があればアップロード
+		if v.CoverChanged {
+			if _, err := m.pushPlaylistCover(resPlaylist, v.Cover); err != nil {
+				return false, err
+			}
+		}
 	}
 	if pl.DiffState == service_compares.RemoteOnly {
 		// プレイリストをリモートから削除
@@ -117,22 +151,38 @@ func (m *service) syncLocalPlaylistWithRemote(v service_compares.PlaylistTrackDi
 		return changed, nil
 	}
 	if pl.DiffState == service_compares.Both {
-		fmt.Println(" ", pl.V.Name)
-	}
+		if pl.V.OldDirName != "" {
+			// ディレクトリ名の変更をリモートに反映
+			pl.V, err = m.pushPlaylistName(pl.V)
+			if err != nil {
+				return false, err
+			}
+			changed = true
+		} else {
+			fmt.Println(" ", pl.V.Name)
+		}
 
-	localOnlyTracks := []models.TrackContent{}
-	remoteOnlyTracks := []models.TrackContent{}
-	for _, w := range v.Tracks {
-		if w.DiffState == service_compares.LocalOnly {
-			localOnlyTracks = append(localOnlyTracks, w.V)
+		// プレイリストtxtで編集されたプロパティをリモートに反映
+		detailChanged, err := m.pushPlaylistDetail(pl.V)
+		if err != nil {
+			return false, err
 		}
-		if w.DiffState == service_compares.RemoteOnly {
-			remoteOnlyTracks = append(remoteOnlyTracks, w.V)
+		changed = changed || detailChanged
+
+		// 変更されたカバー画像をアップロード
+		if v.CoverChanged {
+			coverChanged, err := m.pushPlaylistCover(pl.V, v.Cover)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || coverChanged
+		} else if v.RemoteCoverChanged {
+			fmt.Fprintln(os.Stderr, "Warning: the cover was changed on remote. run pull to download it:", pl.V.Name)
 		}
 	}
 
 	// 曲をプレイリストに追加
-	addedTracks, err := m.addRemoteTrack(pl.V, localOnlyTracks)
+	addedTracks, err := m.addRemoteTrack(pl.V, v.AddedTracks)
 	if err != nil {
 		return false, err
 	}
@@ -142,45 +192,227 @@ func (m *service) syncLocalPlaylistWithRemote(v service_compares.PlaylistTrackDi
 	}
 
 	// 曲をリモートのプレイリストから削除
-	err = m.repository.RemoveRemoteTrack(pl.V, remoteOnlyTracks)
+	err = m.repository.RemoveRemoteTrack(pl.V, v.RemovedTracks)
 	if err != nil {
 		return false, err
 	}
-	for _, w := range remoteOnlyTracks {
+	for _, w := range v.RemovedTracks {
 		fmt.Println("  -", w.Name)
 		changed = true
 	}
 
+	// 曲の順番をローカルに合わせる
+	idToFileName := v.IdToFileName()
+	for _, w := range v.Moves {
+		err := m.repository.ReorderRemoteTrack(pl.V, w.RangeStart, w.InsertBefore)
+		if err != nil {
+			return false, err
+		}
+		fmt.Println("  ~", idToFileName[w.Id])
+		changed = true
+	}
+	if len(v.Moves) > 0 {
+		// 次回の比較で並べ替えとして検出されないようにする
+		if err := m.pullTrackPositions(pl.V, v.RemoteOrderAfterPlan()); err != nil {
+			return false, err
+		}
+	}
+
 	return changed, nil
 }
 
-func (m *service) OverwritePlaylists() error {
+// ローカルの楽曲txtのpositionプロパティを、リモートの曲の順番 (Key) に合わせて書き換える
+// 同じ曲が複数ある場合は今のローカルの順番で割り当てる
+func (m *service) pullTrackPositions(playlist models.PlaylistContent, remoteOrder []string) error {
+	keyToPositions := map[string][]string{}
+	for i, key := range remoteOrder {
+		keyToPositions[key] = append(keyToPositions[key], strconv.Itoa(i+1))
+	}
+	tracks, err := m.repository.FetchLocalPlaylistTrack(playlist.DirName)
+	if err != nil {
+		return err
+	}
+	for _, w := range tracks {
+		positions := keyToPositions[w.Key()]
+		if w.Key() == "" || len(positions) == 0 {
+			continue
+		}
+		keyToPositions[w.Key()] = positions[1:]
+		if w.Position == positions[0] {
+			continue
+		}
+		w.Position = positions[0]
+		if err := m.repository.CreateTrackContent(playlist.DirName, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ローカルで変更されたディレクトリ名をリモートのプレイリスト名にする
+func (m *service) pushPlaylistName(playlist models.PlaylistContent) (models.PlaylistContent, error) {
+	if err := m.repository.RenameRemotePlaylist(playlist, playlist.DirName); err != nil {
+		return playlist, err
+	}
+	fmt.Println("~", playlist.OldDirName, "->", playlist.DirName)
+
+	playlist.Name = playlist.DirName
+	playlist.OldDirName = ""
+	playlist.OldName = ""
+	// プレイリストtxtを新しい名前で作り直す
+	if err := m.repository.CreatePlaylistContent(playlist); err != nil {
+		return playlist, err
+	}
+	return playlist, nil
+}
+
+// ローカルとリモートで値が異なるプロパティをリモートに反映する
+func (m *service) pushPlaylistDetail(playlist models.PlaylistContent) (bool, error) {
+	changes := playlist.ChangedDetails()
+	if len(changes) == 0 {
+		return false, nil
+	}
+
+	if err := m.repository.ChangeRemotePlaylistDetail(playlist); err != nil {
+		return false, err
+	}
+	for _, c := range changes {
+		fmt.Println("  ~", c)
+	}
+	return true, nil
+}
+
+// 最後に同期した時から変更されたcover.jpgをアップロードする
+func (m *service) pushLocalPlaylistCover(playlist models.PlaylistContent) (bool, error) {
+	cover, err := m.repository.FetchLocalPlaylistCover(playlist.DirName)
+	if err != nil {
+		return false, err
+	}
+	return m.pushPlaylistCover(playlist, cover)
+}
+
+// coverが最後に同期したものと異なる場合はアップロードする
+func (m *service) pushPlaylistCover(playlist models.PlaylistContent, cover []byte) (bool, error) {
+	if cover == nil || models.CoverHash(cover) == playlist.CoverHash {
+		return false, nil
+	}
+
+	if err := m.repository.UploadRemotePlaylistCover(playlist, cover); err != nil {
+		// 画像の形式が不正な場合なども他の変更は続ける
+		fmt.Fprintln(os.Stderr, filepath.Join(playlist.DirName, models.COVER_FILE_NAME), "failed to upload: ", err.Error())
+		return false, nil
+	}
+	fmt.Println("  ~ cover")
+
+	// アップロードしたカバー画像のハッシュを記録する
+	playlist.CoverHash = models.CoverHash(cover)
+	if err := m.repository.CreatePlaylistContent(playlist); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// リモートのカバー画像をcover.jpgとして保存し、そのハッシュを設定したプレイリストを返す
+// ダウンロードに失敗しても処理は続ける
+func (m *service) pullPlaylistCover(playlist models.PlaylistContent) models.PlaylistContent {
+	cover, err := m.repository.FetchRemotePlaylistCover(playlist)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to download the cover: ", err.Error())
+		return playlist
+	}
+	if cover == nil {
+		return playlist
+	}
+	if err := m.repository.CreatePlaylistCover(playlist.DirName, cover); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to save the cover: ", err.Error())
+		return playlist
+	}
+	playlist.CoverHash = models.CoverHash(cover)
+	return playlist
+}
+
+// リモートで変更されたプレイリスト名をローカルのディレクトリ名にする
+func (m *service) pullPlaylistName(playlist models.PlaylistContent, usedDirName *uniques.Unique) (models.PlaylistContent, error) {
+	newDirName := replaceBannedCharacter(playlist.Name)
+	if strings.EqualFold(newDirName, playlist.DirName) && !usesLikedSongsDirName(playlist) {
+		// 自分のディレクトリ名とだけ重なる場合は連番を付けない
+		usedDirName.Add(newDirName)
+	} else {
+		newDirName = usedDirName.Take(newDirName)
+	}
+	if newDirName != playlist.DirName {
+		if err := m.repository.RenamePlaylistDirectory(playlist, newDirName); err != nil {
+			return playlist, err
+		}
+		fmt.Println("~", playlist.DirName, "->", newDirName)
+	}
+
+	playlist.DirName = newDirName
+	playlist.OldDirName = ""
+	playlist.OldName = ""
+	// プレイリストtxtを新しい名前で作り直す
+	if err := m.repository.CreatePlaylistContent(playlist); err != nil {
+		return playlist, err
+	}
+	return playlist, nil
+}
+
+// dryRunがtrueの場合は変更内容を表示するだけで実行しない
+// confirmには削除される内容が渡され、falseを返した場合は実行しない
+func (m *service) OverwritePlaylists(dryRun bool, confirm func(summary string) bool) error {
 	fmt.Fprintln(os.Stderr, "now loading ...")
 	changed := false
 
-	// プレイリストの差分を検出
+	// プレイリストの差分と変更内容を計算
 	compare := service_compares.NewCompare(m.repository)
-	diff, err := compare.CompareAllPlaylistWithRemote()
+	plans, err := compare.PlanAllPlaylist()
+	if err != nil {
+		return err
+	}
+	plans, err = m.resolveNotFoundTracks(plans)
 	if err != nil {
 		return err
 	}
+	// 保存したアルバムとフォローしたアーティストの差分を計算
+	library, err := m.planLibraries()
+	if err != nil {
+		return err
+	}
+	summary := summarizePlanDeletion(plans)
+	summary.library = library.deletion()
+	if dryRun {
+		m.warnMassDeletion(summary)
+		if err := writePlanText(os.Stdout, plans); err != nil {
+			return err
+		}
+		return library.writeText(os.Stdout)
+	}
+	ok, err := m.confirmDeletion(summary, confirm)
+	if err != nil || !ok {
+		return err
+	}
 
-	for _, v := range diff {
+	// 変更前のリモートの状態を、差分の計算で取得したものから履歴として残す
+	if err := m.archiveRemoteState(compare.FetchedRemotePlaylists()); err != nil {
+		return err
+	}
+
+	for _, v := range plans {
 		_changed, err := m.syncLocalPlaylistWithRemote(v)
 		if err != nil {
 			return err
 		}
 		changed = changed || _changed
 	}
-
-	// 後片付け: 不要なプレイリストテキストを消去
-	deleted, err := m.repository.CleanUpPlaylistContent()
-	for _, d := range deleted {
-		fmt.Fprintln(os.Stderr, d, "was deleted.")
-	}
+	libraryChanged, err := m.applyLibraries(library)
 	if err != nil {
 		return err
 	}
+	changed = changed || libraryChanged
+
+	if err := m.cleanUpPlaylistContent(); err != nil {
+		return err
+	}
 
 	if !changed {
 		fmt.Println("\nthere was no change on remote")
@@ -188,32 +420,108 @@ func (m *service) OverwritePlaylists() error {
 	return nil
 }
 
-func (m *service) CreatePlaylistDirectory(playlist models.PlaylistContent) error {
-	// generate a playlist detail file
-	err := m.repository.CreatePlaylistContent(playlist)
+// 後片付け: 不要なプレイリストテキストを消去
+func (m *service) cleanUpPlaylistContent() error {
+	deleted, err := m.repository.CleanUpPlaylistContent()
+	for _, d := range deleted {
+		fmt.Fprintln(os.Stderr, d, "was deleted.")
+	}
+	return err
+}
+
+func (m *service) CreatePlaylistDirectory(playlist models.PlaylistContent) ([]models.TrackContent, error) {
+	playlistTrack, err := m.repository.FetchRemotePlaylistTrack(playlist)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := m.createPlaylistDirectoryWithTrack(playlist, playlistTrack); err != nil {
+		return nil, err
 	}
+	return playlistTrack, nil
+}
 
+// 取得済みのリモートの曲でプレイリスト用ディレクトリを作成する
+func (m *service) createPlaylistDirectoryWithTrack(playlist models.PlaylistContent, playlistTrack []models.TrackContent) error {
 	// generate a playlist directory
-	err = m.repository.CreatePlaylistDirectory(playlist)
+	err := m.repository.CreatePlaylistDirectory(playlist)
 	if err != nil {
 		return err
 	}
 
-	playlistTrack, err := m.repository.FetchRemotePlaylistTrack(playlist.Id)
+	// download a cover image
+	playlist = m.pullPlaylistCover(playlist)
+
+	// generate a playlist detail file
+	err = m.repository.CreatePlaylistContent(playlist)
+	if err != nil {
+		return err
+	}
+
+	// generate track files in the directory
+	return m.replaceTrackTxt(playlist, playlistTrack)
+}
+
+// プレイリストtxtを作成し、ディレクトリ内の楽曲txtをtracksで置き換える
+func (m *service) writePlaylistDirectory(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	if err := m.repository.CreatePlaylistContent(playlist); err != nil {
+		return err
+	}
+	return m.replaceTrackTxt(playlist, tracks)
+}
+
+// ディレクトリ内の楽曲txtをtracksで置き換える
+func (m *service) replaceTrackTxt(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	// remove old track files to avoid duplicates
+	oldTracks, err := m.repository.FetchLocalPlaylistTrack(playlist.DirName)
 	if err != nil {
 		return err
 	}
+	for _, track := range oldTracks {
+		if err := m.repository.RemoveTrackContent(playlist.DirName, track); err != nil {
+			return err
+		}
+	}
 
 	// generate a track file in the directory
 	usedTrackNames := uniques.NewUnique()
-	for _, track := range playlistTrack {
+	m.createTrackTxt(usedTrackNames, playlist, tracks)
+	return nil
+}
+
+// trueの場合はpullで再生できない曲を再生できる同じ曲に置き換える
+func (m *service) SetRelink(relink bool) {
+	m.relink = relink
+}
+
+// 再生できる同じ曲があるものは、そのidに置き換える
+// baseはリモートのままなので、次のoverwriteやsyncで置き換えがリモートに反映される
+func relinkTracks(tracks []models.TrackContent) []models.TrackContent {
+	res := make([]models.TrackContent, len(tracks))
+	for i, v := range tracks {
+		if v.PlayableId != "" {
+			v.Id = v.PlayableId
+			v.PlayableId = ""
+			v.IsPlayable = ""
+		}
+		res[i] = v
+	}
+	return res
+}
+
+// 楽曲txtを重複しないファイル名で作成する
+func (m *service) createTrackTxt(usedFileStem *uniques.Unique, playlist models.PlaylistContent, tracks []models.TrackContent) []models.TrackContent {
+	created := []models.TrackContent{}
+	for _, track := range tracks {
 		fileStem := replaceBannedCharacter(track.Name)
-		track.FileName = usedTrackNames.Take(fileStem) + ".txt"
-		m.repository.CreateTrackContent(playlist.DirName, track)
+		track.FileName = usedFileStem.Take(fileStem) + ".txt"
+		err := m.repository.CreateTrackContent(playlist.DirName, track)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to create a new track content: ", filepath.Join(playlist.DirName, track.FileName))
+			continue
+		}
+		created = append(created, track)
 	}
-	return nil
+	return created
 }
 
 func replaceBannedCharacter(path string) string {
@@ -221,33 +529,220 @@ func replaceBannedCharacter(path string) string {
 	return reg.ReplaceAllString(path, " ")
 }
 
-func (m *service) PullPlaylists() error {
-	playlists, err := m.repository.FetchRemotePlaylistContent()
+// ローカルに未反映の変更がある場合は中断する
+// mergeがtrueの場合はローカルの変更を残したままリモートの変更を反映し、forceがtrueの場合はローカルの変更を上書きする
+func (m *service) PullPlaylists(force bool, merge bool) error {
+	if err := m.repository.CreateRootDir(); err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+
+	library, err := m.loadLibraryChanges()
 	if err != nil {
 		return err
 	}
-	if err := m.repository.CreateRootDir(); err != nil {
-		if !errors.Is(err, os.ErrExist) {
+
+	// ローカルの変更を調べた時に取得したリモートのプレイリストと曲
+	var remotePLs []models.PlaylistContent
+	var remoteTracks [][]models.TrackContent
+	keepLocalLibrary := false
+	if !force {
+		base, err := m.repository.FetchBaseSnapshot()
+		if err != nil {
 			return err
 		}
+		var merged []service_compares.PlaylistTrackMerge
+		localChanges := []string{}
+		if base == nil {
+			// baseを記録していない古いバージョンからの移行
+			// 今のローカルのプレイリストを最後にpullした状態とみなす
+			localPLs, err := m.repository.FetchLocalPlaylistContent()
+			if err != nil {
+				return err
+			}
+			if len(localPLs) > 0 {
+				fmt.Fprintln(os.Stderr, "the last pull was not recorded, so the local playlists are treated as unchanged and overwritten with the remote ones")
+			}
+		} else {
+			compare := service_compares.NewCompare(m.repository)
+			merged, err = compare.MergeAllPlaylistWithBase(base)
+			if err != nil {
+				return err
+			}
+			localChanges, err = m.findLocalChanges(merged)
+			if err != nil {
+				return err
+			}
+			remotePLs, remoteTracks = compare.FetchedRemotePlaylists()
+		}
+		localChanges = append(localChanges, library.descriptions()...)
+		if len(localChanges) > 0 {
+			if !merge {
+				fmt.Fprintln(os.Stderr, "local changes since the last pull:")
+				for _, c := range localChanges {
+					fmt.Fprintln(os.Stderr, c)
+				}
+				return errors.New("pull was aborted to keep your local changes. run with --merge to keep them, or --force to overwrite them")
+			}
+			if merged != nil {
+				// ローカルの変更を反映する前のリモートの状態を履歴として残す
+				if err := m.archiveRemoteState(remotePLs, remoteTracks); err != nil {
+					return err
+				}
+				if err := m.applyMerge(merged, false); err != nil {
+					return err
+				}
+				return m.pullLibrary(library, true)
+			}
+			// baseが無い場合、ローカルの変更はライブラリにしか無い
+			keepLocalLibrary = true
+		}
 	}
 
-	usedPlaylistName := uniques.NewUnique()
+	// ローカルの変更が無いことを確認した後か、forceの場合だけ削除する
+	if err := m.removeExcludedPlaylists(); err != nil {
+		return err
+	}
+	if remotePLs == nil {
+		remotePLs, err = m.repository.FetchRemotePlaylistContent()
+		if err != nil {
+			return err
+		}
+		// 曲は全てのプレイリストの分を先に同時に取得する
+		remoteTracks, err = m.repository.FetchRemotePlaylistTracks(remotePLs)
+		if err != nil {
+			return err
+		}
+	}
+	if err := m.pullAllPlaylists(remotePLs, remoteTracks); err != nil {
+		return err
+	}
+	return m.pullLibrary(library, keepLocalLibrary)
+}
+
+// 設定で除外された他のユーザーのプレイリストとお気に入りの曲のディレクトリを削除する
+// 除外したプレイリストはリモートに無いものとして比較されるので、
+// ローカルで変更されている場合はpullの前に変更として検出される
+func (m *service) removeExcludedPlaylists() error {
+	excludedIds, err := m.repository.FetchExcludedPlaylistIds()
+	if err != nil || len(excludedIds) == 0 {
+		return err
+	}
+	localPLs, err := m.repository.FetchLocalPlaylistContent()
+	if err != nil {
+		return err
+	}
+	for _, v := range excludedPlaylists(localPLs, excludedIds) {
+		if err := m.repository.RemovePlaylistDirectory(v); err != nil {
+			return err
+		}
+		if v.IsLikedSongs() {
+			fmt.Println("- "+v.DirName, "(excluded because pull --liked-songs is not enabled)")
+		} else {
+			fmt.Println("- "+v.DirName, "(excluded because you don't own the playlist)")
+		}
+	}
+	return nil
+}
+
+// idが除外されたプレイリストのものを返す
+func excludedPlaylists(playlists []models.PlaylistContent, excludedIds []string) []models.PlaylistContent {
+	excluded := map[string]struct{}{}
+	for _, id := range excludedIds {
+		excluded[id] = struct{}{}
+	}
+	res := []models.PlaylistContent{}
 	for _, v := range playlists {
-		// define a unduplicated directory name
-		name := replaceBannedCharacter(v.Name)
-		uniqueName := usedPlaylistName.Take(name)
-		v.DirName = uniqueName
+		if _, ok := excluded[v.Id]; ok && v.Id != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
 
-		err := m.CreatePlaylistDirectory(v)
+// ローカルのプレイリストをすべてリモートの状態で上書きする
+// playlistTracksにはplaylistsと同じ順番でリモートの曲を渡す
+func (m *service) pullAllPlaylists(playlists []models.PlaylistContent, playlistTracks [][]models.TrackContent) error {
+	localPLs, err := m.repository.FetchLocalPlaylistContent()
+	if err != nil {
+		return err
+	}
+	remoteIdToName := map[string]string{}
+	for _, v := range playlists {
+		remoteIdToName[v.Id] = v.Name
+	}
+	// 名前が変わっていないプレイリストはディレクトリ名をそのまま使う
+	isUnchanged := func(local models.PlaylistContent) bool {
+		return remoteIdToName[local.Id] == local.Name && local.OldDirName == "" && !usesLikedSongsDirName(local)
+	}
+	idToLocal := map[string]models.PlaylistContent{}
+	usedPlaylistName := newDirNameUnique()
+	for _, v := range localPLs {
+		if _, ok := remoteIdToName[v.Id]; ok && v.Id != "" {
+			idToLocal[v.Id] = v
+			if !isUnchanged(v) {
+				// 名前が変わったディレクトリは後で名前を変更する
+				continue
+			}
+		}
+		usedPlaylistName.Add(v.DirName)
+	}
+	// お気に入りの曲のディレクトリ名を使っているプレイリストは、お気に入りの曲を作る前に名前を変える
+	for id, local := range idToLocal {
+		if !usesLikedSongsDirName(local) {
+			continue
+		}
+		local.Name = remoteIdToName[id]
+		renamed, err := m.pullPlaylistName(local, usedPlaylistName)
 		if err != nil {
 			return err
 		}
+		idToLocal[id] = renamed
 	}
-	return nil
+
+	base := []models.PlaylistSnapshot{}
+	history := models.HistorySnapshot{Time: time.Now()}
+	for i, v := range playlists {
+		if local, ok := idToLocal[v.Id]; ok {
+			if isUnchanged(local) {
+				v.DirName = local.DirName
+			} else {
+				// リモートの名前に合わせてディレクトリ名を変更する
+				local.Name = v.Name
+				renamed, err := m.pullPlaylistName(local, usedPlaylistName)
+				if err != nil {
+					return err
+				}
+				v.DirName = renamed.DirName
+			}
+		} else {
+			// define a unduplicated directory name
+			v.DirName = takeDirName(usedPlaylistName, v)
+		}
+
+		tracks := playlistTracks[i]
+		written := tracks
+		if m.relink {
+			written = relinkTracks(tracks)
+		}
+		if err := m.createPlaylistDirectoryWithTrack(v, written); err != nil {
+			return err
+		}
+		base = append(base, models.NewPlaylistSnapshot(v, tracks))
+		history.Playlists = append(history.Playlists, models.HistoryPlaylist{Playlist: v, Tracks: tracks})
+	}
+
+	// 次回のsyncで3-way mergeのbaseとして使う
+	if err := m.repository.SaveBaseSnapshot(base); err != nil {
+		return err
+	}
+	return m.saveHistory(history)
 }
 
-func (m *service) PushSpecificPlaylist(playlistName string) error {
+// dryRunがtrueの場合は変更内容を表示するだけで実行しない
+// confirmには削除される内容が渡され、falseを返した場合は実行しない
+func (m *service) PushSpecificPlaylist(playlistName string, dryRun bool, confirm func(summary string) bool) error {
 	fmt.Fprintln(os.Stderr, "now loading ...")
 
 	// 一旦プレイリストだけのの差分を検出
@@ -269,12 +764,24 @@ func (m *service) PushSpecificPlaylist(playlistName string) error {
 		return fmt.Errorf("playlist '%s' not found", playlistName)
 	}
 
-	diff, err := compare.CompareSinglePlaylistWithRemote(*playlist)
+	plan, err := compare.PlanSinglePlaylist(*playlist)
 	if err != nil {
 		return err
 	}
+	plans, err := m.resolveNotFoundTracks([]service_compares.PlaylistPlan{plan})
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		m.warnMassDeletion(summarizePlanDeletion(plans))
+		return writePlanText(os.Stdout, plans)
+	}
+	ok, err := m.confirmDeletion(summarizePlanDeletion(plans), confirm)
+	if err != nil || !ok {
+		return err
+	}
 
-	changed, err := m.syncLocalPlaylistWithRemote(diff)
+	changed, err := m.syncLocalPlaylistWithRemote(plans[0])
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,12 @@
 package services
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+)
 
 func Test_replaceBannedCharacter(t *testing.T) {
 	actual := replaceBannedCharacter("foo\\bar")
@@ -51,3 +57,290 @@ func Test_replaceBannedCharacter(t *testing.T) {
 		t.Errorf("actual: %s, expected: %s", actual, expected)
 	}
 }
+
+func Test_relinkTracks(t *testing.T) {
+	tracks := []models.TrackContent{
+		{Id: "a", PlayableId: "b", Name: "relinked"},
+		{Id: "c", IsPlayable: "false", Name: "unavailable"},
+	}
+	actual := relinkTracks(tracks)
+	expected := []models.TrackContent{
+		{Id: "b", Name: "relinked"},
+		{Id: "c", IsPlayable: "false", Name: "unavailable"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual: %+v, expected: %+v", actual, expected)
+	}
+	// 元のスライスは変更しない
+	if tracks[0].Id != "a" {
+		t.Errorf("original tracks were changed: %+v", tracks)
+	}
+}
+
+func Test_removeExcludedPlaylists(t *testing.T) {
+	// 他のユーザーのプレイリストをpullした後で除外した場合
+	repository := &fakeRepository{
+		localPlaylists: []models.PlaylistContent{
+			{Id: "own", DirName: "mine"},
+			{Id: "followed", DirName: "followed playlist"},
+			{DirName: "new"},
+		},
+		excludedIds: []string{"followed"},
+	}
+	m := NewService(repository)
+	if err := m.removeExcludedPlaylists(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"RemovePlaylistDirectory followed playlist"}
+	if !reflect.DeepEqual(repository.calls, expected) {
+		t.Errorf("actual: %v, expected: %v", repository.calls, expected)
+	}
+
+	// 除外していない場合は何も削除しない
+	repository = &fakeRepository{localPlaylists: repository.localPlaylists}
+	m = NewService(repository)
+	if err := m.removeExcludedPlaylists(); err != nil {
+		t.Fatal(err)
+	}
+	if len(repository.calls) != 0 {
+		t.Errorf("unexpected calls: %v", repository.calls)
+	}
+}
+
+func Test_pullPlaylistName(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist models.PlaylistContent
+		expected []string
+	}{
+		{
+			name:     "renamed on remote",
+			playlist: models.PlaylistContent{Id: "p", Name: "new", DirName: "old"},
+			expected: []string{"RenamePlaylistDirectory old -> new 2", "CreatePlaylistContent new 2"},
+		},
+		{
+			// 自分のディレクトリ名とだけ重なる場合は連番を付けない
+			name:     "same as own directory",
+			playlist: models.PlaylistContent{Id: "p", Name: "old", DirName: "old", OldName: "previous"},
+			expected: []string{"CreatePlaylistContent old"},
+		},
+		{
+			// お気に入りの曲のディレクトリ名は他のプレイリストに使わない
+			name:     "reserved directory",
+			playlist: models.PlaylistContent{Id: "p", Name: "Liked Songs", DirName: "Liked Songs", OldName: "previous"},
+			expected: []string{"RenamePlaylistDirectory Liked Songs -> Liked Songs 2", "CreatePlaylistContent Liked Songs 2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeRepository{}
+			m := NewService(repository)
+			used := newDirNameUnique()
+			used.Add("old")
+			used.Add("new")
+			if _, err := m.pullPlaylistName(tt.playlist, used); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(repository.calls, tt.expected) {
+				t.Errorf("actual: %v, expected: %v", repository.calls, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_pullTrackPositions(t *testing.T) {
+	// cを先頭に並べ替えた後
+	repository := &fakeRepository{
+		localTracks: map[string][]models.TrackContent{"pl": {
+			{Id: "c", FileName: "c.txt", Position: "0"},
+			{Id: "a", FileName: "a.txt", Position: "1"},
+			{Id: "b", FileName: "b.txt", Position: "3"},
+			{Name: "not found", FileName: "new.txt"},
+		}},
+	}
+	m := NewService(repository)
+	if err := m.pullTrackPositions(models.PlaylistContent{Id: "p", DirName: "pl"}, []string{"c", "a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"CreateTrackContent pl/c.txt", "CreateTrackContent pl/a.txt"}
+	if !reflect.DeepEqual(repository.calls, expected) {
+		t.Errorf("actual: %v, expected: %v", repository.calls, expected)
+	}
+}
+
+func Test_pushPlaylistName(t *testing.T) {
+	// ディレクトリ名とプロパティを変更した場合、プロパティは新しい名前で反映する
+	playlist := models.PlaylistContent{
+		Id: "p", Name: "old", DirName: "new", OldDirName: "old", Description: "changed",
+		RemoteDetail: &models.PlaylistDetail{Description: "description"},
+	}
+	repository := &fakeRepository{}
+	m := NewService(repository)
+	renamed, err := m.pushPlaylistName(playlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.pushPlaylistDetail(renamed); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"RenameRemotePlaylist p", "CreatePlaylistContent new", "ChangeRemotePlaylistDetail p new"}
+	if !reflect.DeepEqual(repository.calls, expected) {
+		t.Errorf("actual: %v, expected: %v", repository.calls, expected)
+	}
+}
+
+func Test_PullPlaylists_excluded(t *testing.T) {
+	local := []models.PlaylistContent{{Id: "followed", Name: "followed", DirName: "followed", SnapshotId: "s"}}
+	base := []models.PlaylistSnapshot{{Id: "followed", DirName: "followed", SnapshotId: "s", TrackIds: []string{"a"}}}
+
+	// 除外したプレイリストがローカルで変更されている場合はpullを中断する
+	repository := &fakeRepository{
+		localPlaylists: local,
+		excludedIds:    []string{"followed"},
+		base:           base,
+		localTracks:    map[string][]models.TrackContent{"followed": {{Id: "a"}, {Id: "b", FileName: "b.txt"}}},
+	}
+	m := NewService(repository)
+	if err := m.PullPlaylists(false, false); err == nil {
+		t.Error("pull must be aborted")
+	}
+	if len(repository.calls) != 0 {
+		t.Errorf("unexpected calls: %v", repository.calls)
+	}
+
+	// 変更されていない場合は削除する
+	repository.localTracks = map[string][]models.TrackContent{"followed": {{Id: "a"}}}
+	if err := m.PullPlaylists(false, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"RemovePlaylistDirectory followed", "SaveBaseSnapshot", "SaveHistory"}
+	if !reflect.DeepEqual(repository.calls, expected) {
+		t.Errorf("actual: %v, expected: %v", repository.calls, expected)
+	}
+}
+
+func Test_PullPlaylists_withoutBase(t *testing.T) {
+	// baseを記録していない古いバージョンからの移行では、ローカルの変更として扱わずに上書きする
+	repository := &fakeRepository{
+		localPlaylists:  []models.PlaylistContent{{Id: "p", Name: "pl", DirName: "pl"}},
+		remotePlaylists: []models.PlaylistContent{{Id: "p", Name: "pl", SnapshotId: "s"}},
+		localTracks:     map[string][]models.TrackContent{"pl": {{Id: "a", FileName: "a.txt"}}},
+		remoteTracks:    map[string][]models.TrackContent{"p": {{Id: "b", Name: "b"}}},
+	}
+	m := NewService(repository)
+	if err := m.PullPlaylists(false, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"CreatePlaylistDirectory pl", "CreatePlaylistContent pl", "RemoveTrackContent pl/a.txt", "CreateTrackContent pl/b.txt",
+		"SaveBaseSnapshot", "SaveHistory",
+	}
+	if !reflect.DeepEqual(repository.calls, expected) {
+		t.Errorf("actual: %v, expected: %v", repository.calls, expected)
+	}
+
+	// 2回目からはbaseと比べ、リモートはローカルの変更を調べた時の1回だけ取得する
+	repository.calls = nil
+	repository.remoteFetches = 0
+	repository.localTracks = map[string][]models.TrackContent{"pl": {{Id: "b", FileName: "b.txt"}}}
+	if err := m.PullPlaylists(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if repository.remoteFetches != 1 {
+		t.Errorf("remote playlists were fetched %d times", repository.remoteFetches)
+	}
+}
+
+func Test_PullPlaylists_likedSongs(t *testing.T) {
+	// 以前にpullした"Liked Songs"という名前のプレイリストは、お気に入りの曲を作る前に名前を変える
+	repository := &fakeRepository{
+		localPlaylists: []models.PlaylistContent{{Id: "p", Name: "Liked Songs", DirName: "Liked Songs"}},
+		remotePlaylists: []models.PlaylistContent{
+			models.NewLikedSongsContent("me", "s"),
+			{Id: "p", Name: "Liked Songs", SnapshotId: "s"},
+		},
+	}
+	m := NewService(repository)
+	if err := m.PullPlaylists(false, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"RenamePlaylistDirectory Liked Songs -> Liked Songs 2", "CreatePlaylistContent Liked Songs 2",
+		"CreatePlaylistDirectory Liked Songs", "CreatePlaylistContent Liked Songs",
+		"CreatePlaylistDirectory Liked Songs 2", "CreatePlaylistContent Liked Songs 2",
+		"SaveBaseSnapshot", "SaveHistory",
+	}
+	if !reflect.DeepEqual(repository.calls, expected) {
+		t.Errorf("actual: %v, expected: %v", repository.calls, expected)
+	}
+}
+
+func Test_findLocalChanges(t *testing.T) {
+	base := []models.PlaylistSnapshot{
+		{Id: "kept", DirName: "kept", SnapshotId: "s", TrackIds: []string{"a", "b"}},
+		{Id: "removed", Name: "removed", DirName: "removed", SnapshotId: "s"},
+		{Id: "remote removed", DirName: "remote removed", SnapshotId: "s", TrackIds: []string{"a"}},
+	}
+	tests := []struct {
+		name        string
+		local       []models.PlaylistContent
+		remote      []models.PlaylistContent
+		localTracks map[string][]models.TrackContent
+		expected    []string
+	}{
+		{
+			name:        "no change",
+			local:       []models.PlaylistContent{{Id: "kept", DirName: "kept", SnapshotId: "s"}},
+			remote:      []models.PlaylistContent{{Id: "kept", SnapshotId: "s"}},
+			localTracks: map[string][]models.TrackContent{"kept": {{Id: "a"}, {Id: "b"}}},
+			expected:    []string{},
+		},
+		{
+			name:        "tracks",
+			local:       []models.PlaylistContent{{Id: "kept", DirName: "kept", SnapshotId: "s"}},
+			remote:      []models.PlaylistContent{{Id: "kept", SnapshotId: "s"}},
+			localTracks: map[string][]models.TrackContent{"kept": {{Id: "a"}, {Name: "new", FileName: "new.txt"}}},
+			expected:    []string{"+ kept/new.txt", "- kept/b"},
+		},
+		{
+			name:        "playlists",
+			local:       []models.PlaylistContent{{DirName: "added"}, {Id: "kept", DirName: "renamed", OldDirName: "kept", SnapshotId: "s"}},
+			remote:      []models.PlaylistContent{{Id: "kept", SnapshotId: "s"}, {Id: "removed", Name: "removed", SnapshotId: "s"}},
+			localTracks: map[string][]models.TrackContent{"renamed": {{Id: "a"}, {Id: "b"}}},
+			expected:    []string{"+ added", "- removed", "~ kept -> renamed"},
+		},
+		{
+			name:        "properties",
+			local:       []models.PlaylistContent{{Id: "kept", DirName: "kept", SnapshotId: "s", Description: "changed"}},
+			remote:      []models.PlaylistContent{{Id: "kept", SnapshotId: "s"}},
+			localTracks: map[string][]models.TrackContent{"kept": {{Id: "a"}, {Id: "b"}}},
+			expected:    []string{"~ kept (properties)"},
+		},
+		{
+			// リモートで削除されたプレイリストをローカルで変更した
+			name:        "conflict",
+			local:       []models.PlaylistContent{{Id: "remote removed", DirName: "remote removed", SnapshotId: "s"}},
+			localTracks: map[string][]models.TrackContent{"remote removed": {{Id: "a"}, {Id: "b"}}},
+			expected:    []string{"! remote removed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remoteTracks := map[string][]models.TrackContent{"kept": {{Id: "a", Name: "a"}, {Id: "b", Name: "b"}}}
+			repository := &fakeRepository{localPlaylists: tt.local, remotePlaylists: tt.remote, localTracks: tt.localTracks, remoteTracks: remoteTracks}
+			m := NewService(repository)
+			compare := service_compares.NewCompare(repository)
+			merged, err := compare.MergeAllPlaylistWithBase(base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := m.findLocalChanges(merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("actual: %v, expected: %v", actual, tt.expected)
+			}
+		})
+	}
+}
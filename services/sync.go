@@ -0,0 +1,509 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+	service_compares "github.com/kajikentaro/spotify-fbc/services/compares"
+	"github.com/kajikentaro/spotify-fbc/services/uniques"
+)
+
+// 最後にpullした時点をbaseとして、ローカルとリモートの変更を双方向に反映する
+// dryRunがtrueの場合は上限を超えている削除を警告だけする
+// confirmには削除される内容が渡され、falseを返した場合は実行しない
+func (m *service) SyncPlaylists(dryRun bool, confirm func(summary string) bool) error {
+	fmt.Fprintln(os.Stderr, "now loading ...")
+
+	base, err := m.repository.FetchBaseSnapshot()
+	if err != nil {
+		return err
+	}
+	if len(base) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: base snapshot was not found. Run 'pull' first to detect removals correctly.")
+	}
+
+	compare := service_compares.NewCompare(m.repository)
+	merged, err := compare.MergeAllPlaylistWithBase(base)
+	if err != nil {
+		return err
+	}
+
+	summary := summarizeMergeDeletion(merged)
+	if dryRun {
+		// 読み取り専用のrepositoryで実行し、変更内容を表示する
+		m.warnMassDeletion(summary)
+		return m.applyMerge(merged, true)
+	}
+	ok, err := m.confirmDeletion(summary, confirm)
+	if err != nil || !ok {
+		return err
+	}
+	return m.applyMerge(merged, true)
+}
+
+// 3-way mergeの結果を反映し、baseを更新する
+// pushLocalがfalseの場合はリモートの変更だけをローカルに反映し、ローカルの変更は残す
+func (m *service) applyMerge(merged []service_compares.PlaylistTrackMerge, pushLocal bool) error {
+	// リモートから追加するプレイリストのディレクトリ名が重複しないようにする
+	usedDirName := newDirNameUnique()
+	for _, v := range merged {
+		if v.Playlist.V.DirName != "" {
+			usedDirName.Add(v.Playlist.V.DirName)
+		}
+	}
+
+	changed := false
+	newBase := []models.PlaylistSnapshot{}
+	conflicted := map[string]struct{}{}
+	for _, v := range merged {
+		// 他のユーザーのプレイリストはローカルの変更をリモートに反映しない
+		push := pushLocal && !v.Playlist.V.ReadOnly
+		if pushLocal && !push {
+			localChanges, err := m.findLocalChanges([]service_compares.PlaylistTrackMerge{v})
+			if err != nil {
+				return err
+			}
+			if len(localChanges) > 0 {
+				fmt.Fprintln(os.Stderr, "Warning: local changes are ignored because you don't own the playlist:", v.Playlist.V.Name)
+			}
+		}
+		snapshot, _changed, err := m.syncPlaylistThreeWay(v, usedDirName, push)
+		if err != nil {
+			return err
+		}
+		changed = changed || _changed
+		if snapshot != nil {
+			newBase = append(newBase, *snapshot)
+		}
+		if v.Playlist.MergeState == service_compares.Conflict || len(tracksWithMergeState(v.Tracks, service_compares.Conflict)) > 0 {
+			conflicted[v.Playlist.V.Id] = struct{}{}
+		}
+	}
+
+	// リモートを変更するとsnapshot_idが変わるので取り直す
+	// 競合しているプレイリストは次回も競合として検出されるよう古いbaseのままにする
+	remotePLs, err := m.repository.FetchRemotePlaylistContent()
+	if err != nil {
+		return err
+	}
+	idToSnapshotId := map[string]string{}
+	for _, v := range remotePLs {
+		idToSnapshotId[v.Id] = v.SnapshotId
+	}
+	for i, v := range newBase {
+		if _, ok := conflicted[v.Id]; ok {
+			continue
+		}
+		if snapshotId, ok := idToSnapshotId[v.Id]; ok {
+			newBase[i].SnapshotId = snapshotId
+		}
+	}
+	if err := m.repository.SaveBaseSnapshot(newBase); err != nil {
+		return err
+	}
+	if err := m.cleanUpPlaylistContent(); err != nil {
+		return err
+	}
+
+	if len(conflicted) > 0 {
+		fmt.Fprintln(os.Stderr, "\nsome playlists were changed on both local and remote. resolve them manually and run again")
+	}
+	if !changed {
+		fmt.Println("\nthere was no change")
+	}
+	return nil
+}
+
+// 1つのプレイリストについて3-way mergeの結果を反映し、新しいbaseを返す
+// baseから外す場合はnilを返す
+func (m *service) syncPlaylistThreeWay(v service_compares.PlaylistTrackMerge, usedDirName *uniques.Unique, pushLocal bool) (*models.PlaylistSnapshot, bool, error) {
+	pl := v.Playlist.V
+
+	switch v.Playlist.MergeState {
+	case service_compares.Conflict:
+		fmt.Println("!", pl.Name, pl.DirName)
+		return v.Base, false, nil
+
+	case service_compares.LocalRemoved:
+		if pl.IsLikedSongs() {
+			fmt.Fprintln(os.Stderr, "Warning:", pl.Name, "cannot be removed. run 'pull' to download it again")
+		}
+		if !pushLocal || pl.IsLikedSongs() {
+			// リモートにはまだ存在するのでbaseに残す
+			return v.Base, false, nil
+		}
+		// ローカルで削除されたのでリモートから削除
+		if err := m.repository.RemoveRemotePlaylist(pl); err != nil {
+			return nil, false, err
+		}
+		fmt.Println("- remote:", pl.Name)
+		return nil, true, nil
+
+	case service_compares.RemoteRemoved:
+		// リモートで削除されたのでローカルから削除
+		if err := m.repository.RemovePlaylistDirectory(pl); err != nil {
+			return nil, false, err
+		}
+		fmt.Println("- local:", pl.DirName)
+		return nil, true, nil
+
+	case service_compares.LocalAdded:
+		if pl.IsLikedSongs() {
+			fmt.Fprintln(os.Stderr, "Warning:", pl.Name, "is ignored because pull --liked-songs is not enabled")
+		}
+		if !pushLocal || pl.IsLikedSongs() {
+			return nil, false, nil
+		}
+		// ローカルで作成されたのでリモートに作成
+		resPlaylist, err := m.repository.CreateRemotePlaylist(pl)
+		if err != nil {
+			return nil, false, err
+		}
+		resPlaylist.DirName = pl.DirName
+		if err := m.repository.CreatePlaylistContent(resPlaylist); err != nil {
+			return nil, false, err
+		}
+		fmt.Println("+ remote:", resPlaylist.DirName)
+		if _, err := m.pushLocalPlaylistCover(resPlaylist); err != nil {
+			return nil, false, err
+		}
+
+		addedTracks, err := m.searchAndAddRemoteTrack(resPlaylist, tracksWithMergeState(v.Tracks, service_compares.LocalAdded))
+		if err != nil {
+			return nil, false, err
+		}
+		for _, w := range addedTracks {
+			fmt.Println("  + remote:", w.FileName)
+		}
+		snapshot := models.NewPlaylistSnapshot(resPlaylist, addedTracks)
+		return &snapshot, true, nil
+
+	case service_compares.RemoteAdded:
+		// リモートで作成されたのでローカルに作成
+		pl.DirName = takeDirName(usedDirName, pl)
+		if err := m.repository.CreatePlaylistDirectory(pl); err != nil {
+			return nil, false, err
+		}
+		pl = m.pullPlaylistCover(pl)
+		if err := m.repository.CreatePlaylistContent(pl); err != nil {
+			return nil, false, err
+		}
+		fmt.Println("+ local:", pl.DirName)
+
+		tracks := tracksWithMergeState(v.Tracks, service_compares.RemoteAdded)
+		for _, w := range m.createTrackTxt(uniques.NewUnique(), pl, tracks) {
+			fmt.Println("  + local:", w.FileName)
+		}
+		snapshot := models.NewPlaylistSnapshot(pl, tracks)
+		return &snapshot, true, nil
+	}
+
+	// 両方に存在する場合はプレイリスト名と曲単位で反映する
+	changed := false
+	var err error
+	switch {
+	case pl.OldDirName != "" && pl.OldName != "":
+		fmt.Println("!", pl.Name, pl.DirName)
+		fmt.Fprintln(os.Stderr, "conflict: the playlist was renamed on both local and remote:", pl.DirName)
+	case pl.OldDirName != "":
+		if pushLocal {
+			pl, err = m.pushPlaylistName(pl)
+			changed = true
+		} else {
+			fmt.Println(" ", pl.Name)
+		}
+	case pl.OldName != "":
+		pl, err = m.pullPlaylistName(pl, usedDirName)
+		changed = true
+	default:
+		fmt.Println(" ", pl.Name)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 編集可能なプロパティをプロパティごとに3-way mergeする
+	var baseDetail *models.PlaylistDetail
+	if v.Base != nil {
+		baseDetail = &v.Base.Detail
+	}
+	detail, conflicts := mergePlaylistDetail(baseDetail, pl.Detail(), *pl.RemoteDetail)
+	for _, c := range conflicts {
+		fmt.Fprintln(os.Stderr, "conflict: the property was changed on both local and remote:", pl.DirName, c)
+	}
+	if detail != pl.Detail() {
+		pl.SetDetail(detail)
+		if err := m.repository.CreatePlaylistContent(pl); err != nil {
+			return nil, false, err
+		}
+		fmt.Println("  ~ local: properties")
+		changed = true
+	}
+	baseDetailAfter := pl.Detail()
+	if pushLocal {
+		// 競合したプロパティはリモートの値のままにする
+		pushed := pl
+		pushed.SetDetail(withDetailValues(pl.Detail(), *pl.RemoteDetail, conflicts))
+		detailChanged, err := m.pushPlaylistDetail(pushed)
+		if err != nil {
+			return nil, false, err
+		}
+		changed = changed || detailChanged
+	} else {
+		// ローカルの変更が次回も検出されるよう、baseにはリモートの値を残す
+		baseDetailAfter = *pl.RemoteDetail
+	}
+	if baseDetail != nil {
+		// 競合したプロパティは次回も競合として検出されるよう古いbaseのままにする
+		baseDetailAfter = withDetailValues(baseDetailAfter, *baseDetail, conflicts)
+	}
+
+	pl, coverChanged, err := m.mergePlaylistCover(v.Base, pl, pushLocal)
+	if err != nil {
+		return nil, false, err
+	}
+	changed = changed || coverChanged
+
+	addedTracks := []models.TrackContent{}
+	removedTracks := tracksWithMergeState(v.Tracks, service_compares.LocalRemoved)
+	if pushLocal {
+		addedTracks, err = m.searchAndAddRemoteTrack(pl, tracksWithMergeState(v.Tracks, service_compares.LocalAdded))
+		if err != nil {
+			return nil, false, err
+		}
+		for _, w := range addedTracks {
+			fmt.Println("  + remote:", w.FileName)
+			changed = true
+		}
+
+		if err := m.repository.RemoveRemoteTrack(pl, removedTracks); err != nil {
+			return nil, false, err
+		}
+		for _, w := range removedTracks {
+			fmt.Println("  - remote:", w.Name)
+			changed = true
+		}
+	}
+
+	for _, w := range tracksWithMergeState(v.Tracks, service_compares.RemoteRemoved) {
+		if err := m.repository.RemoveTrackContent(pl.DirName, w); err != nil {
+			return nil, false, err
+		}
+		fmt.Println("  - local:", w.FileName)
+		changed = true
+	}
+
+	usedFileStem := uniques.NewUnique()
+	for _, w := range v.Tracks {
+		if w.MergeState == service_compares.RemoteRemoved || w.V.FileName == "" {
+			continue
+		}
+		if fileStem, err := getFileStem(w.V.FileName); err == nil {
+			usedFileStem.Add(fileStem)
+		}
+	}
+	remoteAddedTracks := tracksWithMergeState(v.Tracks, service_compares.RemoteAdded)
+	for _, w := range m.createTrackTxt(usedFileStem, pl, remoteAddedTracks) {
+		fmt.Println("  + local:", w.FileName)
+		changed = true
+	}
+
+	baseTracks := tracksWithMergeState(v.Tracks, service_compares.Unchanged)
+	baseTracks = append(baseTracks, reportTrackConflicts(pl.DirName, v.Base, v.Tracks)...)
+	baseTracks = append(baseTracks, remoteAddedTracks...)
+	if pushLocal {
+		baseTracks = append(baseTracks, addedTracks...)
+	} else {
+		// ローカルで削除された曲はリモートにまだ存在する
+		baseTracks = append(baseTracks, removedTracks...)
+	}
+	snapshot := models.NewPlaylistSnapshot(pl, baseTracks)
+	snapshot.Detail = baseDetailAfter
+	return &snapshot, changed, nil
+}
+
+// cover.jpgとリモートのカバー画像のうち、最後にpullした時から変更された方を反映する
+// 両方で変更された場合はどちらも変更しない
+// 返したプレイリストのCoverUrlを次回のbaseに記録する
+func (m *service) mergePlaylistCover(base *models.PlaylistSnapshot, pl models.PlaylistContent, pushLocal bool) (models.PlaylistContent, bool, error) {
+	cover, err := m.repository.FetchLocalPlaylistCover(pl.DirName)
+	if err != nil {
+		return pl, false, err
+	}
+	localChanged := cover != nil && models.CoverHash(cover) != pl.CoverHash
+	remoteChanged := base != nil && base.IsCoverUrlChanged(pl.CoverUrl)
+	switch {
+	case localChanged && remoteChanged:
+		fmt.Fprintln(os.Stderr, "conflict: the cover was changed on both local and remote:", pl.DirName)
+		// 次回も競合として検出されるよう古いURLのままにする
+		pl.CoverUrl = base.CoverUrl
+		return pl, false, nil
+	case localChanged:
+		if !pushLocal {
+			return pl, false, nil
+		}
+		changed, err := m.pushPlaylistCover(pl, cover)
+		if changed {
+			// アップロードした画像のURLはまだ分からないので記録しない
+			pl.CoverUrl = ""
+		}
+		return pl, changed, err
+	case remoteChanged:
+		remote, err := m.repository.FetchRemotePlaylistCover(pl)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to download the cover: ", err.Error())
+			// 次回も変更として検出されるよう古いURLのままにする
+			pl.CoverUrl = base.CoverUrl
+			return pl, false, nil
+		}
+		if remote == nil || models.CoverHash(remote) == pl.CoverHash {
+			// URLだけが変わった場合
+			return pl, false, nil
+		}
+		if err := m.repository.CreatePlaylistCover(pl.DirName, remote); err != nil {
+			return pl, false, err
+		}
+		pl.CoverHash = models.CoverHash(remote)
+		if err := m.repository.CreatePlaylistContent(pl); err != nil {
+			return pl, false, err
+		}
+		fmt.Println("  ~ local: cover")
+		return pl, true, nil
+	}
+	return pl, false, nil
+}
+
+// 最後にpullした時から変更されたローカルの内容を表示用の文字列で返す
+func (m *service) findLocalChanges(merged []service_compares.PlaylistTrackMerge) ([]string, error) {
+	res := []string{}
+	for _, v := range merged {
+		pl := v.Playlist.V
+		switch v.Playlist.MergeState {
+		case service_compares.LocalAdded:
+			res = append(res, "+ "+pl.DirName)
+		case service_compares.LocalRemoved:
+			res = append(res, "- "+pl.Name)
+		case service_compares.Conflict:
+			res = append(res, "! "+pl.DirName)
+		case service_compares.Unchanged:
+			if pl.OldDirName != "" {
+				res = append(res, "~ "+pl.OldDirName+" -> "+pl.DirName)
+			}
+			if v.Base != nil && v.Base.Detail != pl.Detail() {
+				res = append(res, "~ "+pl.DirName+" (properties)")
+			}
+			cover, err := m.repository.FetchLocalPlaylistCover(pl.DirName)
+			if err != nil {
+				return nil, err
+			}
+			if cover != nil && models.CoverHash(cover) != pl.CoverHash {
+				res = append(res, "~ "+filepath.Join(pl.DirName, models.COVER_FILE_NAME))
+			}
+			conflicted := map[string]struct{}{}
+			for _, w := range v.Tracks {
+				if w.MergeState == service_compares.LocalAdded {
+					res = append(res, "+ "+filepath.Join(pl.DirName, w.V.FileName))
+				}
+				if w.MergeState == service_compares.LocalRemoved {
+					res = append(res, "- "+filepath.Join(pl.DirName, w.V.Name))
+				}
+				if w.MergeState == service_compares.Conflict {
+					name := w.V.FileName
+					if name == "" {
+						name = w.V.Name
+					}
+					if _, ok := conflicted[w.V.Key()]; !ok {
+						res = append(res, "! "+filepath.Join(pl.DirName, name))
+					}
+					conflicted[w.V.Key()] = struct{}{}
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// baseから変更された方の値を使う
+// 両方で異なる値に変更された場合はローカルの値をそのまま残し、競合したプロパティのtitleを返す
+// 競合したプロパティはリモートに反映しないこと
+// baseが無い場合はローカルの値を使う
+func mergePlaylistDetail(base *models.PlaylistDetail, local models.PlaylistDetail, remote models.PlaylistDetail) (models.PlaylistDetail, []string) {
+	if base == nil {
+		return local, nil
+	}
+	conflicts := []string{}
+	mergeValue := func(title string, b string, l string, r string) string {
+		if l == b {
+			return r
+		}
+		if r != b && r != l {
+			conflicts = append(conflicts, title)
+		}
+		return l
+	}
+	res := models.PlaylistDetail{
+		Description:   mergeValue("description", base.Description, local.Description, remote.Description),
+		Public:        mergeValue("public", base.Public, local.Public, remote.Public),
+		Collaborative: mergeValue("collaborative", base.Collaborative, local.Collaborative, remote.Collaborative),
+	}
+	return res, conflicts
+}
+
+// titlesのプロパティだけfromの値にする
+func withDetailValues(detail models.PlaylistDetail, from models.PlaylistDetail, titles []string) models.PlaylistDetail {
+	for _, t := range titles {
+		switch t {
+		case "description":
+			detail.Description = from.Description
+		case "public":
+			detail.Public = from.Public
+		case "collaborative":
+			detail.Collaborative = from.Collaborative
+		}
+	}
+	return detail
+}
+
+// 競合した曲を表示する
+// 次回も競合として検出されるよう、baseにあった数だけ競合した曲を返す
+func reportTrackConflicts(dirName string, base *models.PlaylistSnapshot, tracks []service_compares.WithMergeState[models.TrackContent]) []models.TrackContent {
+	count := map[string]int{}
+	if base != nil {
+		for _, id := range base.TrackIds {
+			count[id]++
+		}
+	}
+	for _, w := range tracksWithMergeState(tracks, service_compares.Unchanged) {
+		count[w.Key()]--
+	}
+
+	res := []models.TrackContent{}
+	reported := map[string]struct{}{}
+	for _, w := range tracksWithMergeState(tracks, service_compares.Conflict) {
+		if _, ok := reported[w.Key()]; ok {
+			continue
+		}
+		reported[w.Key()] = struct{}{}
+		name := w.FileName
+		if name == "" {
+			name = w.Name
+		}
+		fmt.Fprintln(os.Stderr, "conflict: the song was changed on both local and remote:", dirName, name)
+		for i := 0; i < count[w.Key()]; i++ {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+func tracksWithMergeState(tracks []service_compares.WithMergeState[models.TrackContent], state service_compares.MergeState) []models.TrackContent {
+	res := []models.TrackContent{}
+	for _, w := range tracks {
+		if w.MergeState == state {
+			res = append(res, w.V)
+		}
+	}
+	return res
+}
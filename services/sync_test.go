@@ -0,0 +1,187 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+func Test_mergePlaylistDetail(t *testing.T) {
+	base := models.PlaylistDetail{Description: "base", Public: "false", Collaborative: "false"}
+	local := models.PlaylistDetail{Description: "local", Public: "false", Collaborative: "false"}
+	remote := models.PlaylistDetail{Description: "base", Public: "true", Collaborative: "false"}
+
+	actual, conflicts := mergePlaylistDetail(&base, local, remote)
+	expected := models.PlaylistDetail{Description: "local", Public: "true", Collaborative: "false"}
+	if actual != expected {
+		t.Errorf("actual: %v, expected: %v", actual, expected)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("conflicts must be empty: %v", conflicts)
+	}
+
+	remote.Description = "remote"
+	actual, conflicts = mergePlaylistDetail(&base, local, remote)
+	if actual.Description != "local" {
+		t.Errorf("actual: %s, expected: %s", actual.Description, "local")
+	}
+	if len(conflicts) != 1 || conflicts[0] != "description" {
+		t.Errorf("actual: %v, expected: %v", conflicts, []string{"description"})
+	}
+	// 競合したプロパティはリモートにもbaseにも反映しない
+	pushed := withDetailValues(actual, remote, conflicts)
+	if pushed.Description != "remote" || pushed.Public != "true" {
+		t.Errorf("actual: %v", pushed)
+	}
+	nextBase := withDetailValues(actual, base, conflicts)
+	if nextBase.Description != "base" {
+		t.Errorf("actual: %s, expected: %s", nextBase.Description, "base")
+	}
+
+	actual, _ = mergePlaylistDetail(nil, local, remote)
+	if actual != local {
+		t.Errorf("actual: %v, expected: %v", actual, local)
+	}
+}
+
+func Test_SyncPlaylists_deleteLimit(t *testing.T) {
+	// ローカルで2つのプレイリストを削除した場合
+	newRepository := func() *fakeRepository {
+		return &fakeRepository{
+			remotePlaylists: []models.PlaylistContent{{Id: "a", Name: "a", SnapshotId: "s"}, {Id: "b", Name: "b", SnapshotId: "s"}},
+			base: []models.PlaylistSnapshot{
+				{Id: "a", Name: "a", DirName: "a", SnapshotId: "s"},
+				{Id: "b", Name: "b", DirName: "b", SnapshotId: "s"},
+			},
+		}
+	}
+	limit := DeleteLimit{MaxPlaylists: 1, MaxTrackPercent: 50}
+
+	m := NewService(newRepository())
+	m.SetDeleteLimit(limit)
+	if err := m.SyncPlaylists(false, nil); err == nil {
+		t.Error("sync must fail when the limit is exceeded")
+	}
+
+	// dry runの場合は警告だけして続ける
+	m = NewService(newRepository())
+	m.SetDeleteLimit(limit)
+	if err := m.SyncPlaylists(true, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_mergePlaylistCover(t *testing.T) {
+	pl := models.PlaylistContent{Id: "p", DirName: "pl", CoverHash: models.CoverHash([]byte("base")), CoverUrl: "remote"}
+	base := &models.PlaylistSnapshot{Id: "p", CoverUrl: "base"}
+	tests := []struct {
+		name        string
+		localCover  string
+		remoteCover string
+		base        *models.PlaylistSnapshot
+		pushLocal   bool
+		expected    []string
+		coverUrl    string
+	}{
+		{
+			name:        "changed on remote",
+			localCover:  "base",
+			remoteCover: "remote",
+			base:        base,
+			expected:    []string{"CreatePlaylistCover pl remote", "CreatePlaylistContent pl"},
+			coverUrl:    "remote",
+		},
+		{
+			// URLだけが変わった場合はダウンロードした画像を保存しない
+			name:        "only the url changed on remote",
+			localCover:  "base",
+			remoteCover: "base",
+			base:        base,
+			expected:    []string{},
+			coverUrl:    "remote",
+		},
+		{
+			name:        "changed on local",
+			localCover:  "local",
+			remoteCover: "base",
+			base:        &models.PlaylistSnapshot{Id: "p", CoverUrl: "remote"},
+			pushLocal:   true,
+			expected:    []string{"UploadRemotePlaylistCover p local", "CreatePlaylistContent pl"},
+			coverUrl:    "",
+		},
+		{
+			// 競合した場合はどちらも変更せず、次回も競合として検出する
+			name:        "changed on both",
+			localCover:  "local",
+			remoteCover: "remote",
+			base:        base,
+			pushLocal:   true,
+			expected:    []string{},
+			coverUrl:    "base",
+		},
+		{
+			// baseにURLが無い場合はリモートの変更を検出しない
+			name:        "without base",
+			localCover:  "base",
+			remoteCover: "remote",
+			expected:    []string{},
+			coverUrl:    "remote",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeRepository{
+				localCovers:  map[string][]byte{"pl": []byte(tt.localCover)},
+				remoteCovers: map[string][]byte{"p": []byte(tt.remoteCover)},
+			}
+			m := NewService(repository)
+			actual, _, err := m.mergePlaylistCover(tt.base, pl, tt.pushLocal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := repository.calls
+			if calls == nil {
+				calls = []string{}
+			}
+			if !reflect.DeepEqual(calls, tt.expected) {
+				t.Errorf("actual: %v, expected: %v", calls, tt.expected)
+			}
+			if actual.CoverUrl != tt.coverUrl {
+				t.Errorf("actual: %s, expected: %s", actual.CoverUrl, tt.coverUrl)
+			}
+		})
+	}
+}
+
+func Test_SyncPlaylists_trackConflict(t *testing.T) {
+	// ローカルで削除した曲がリモートで並べ替えられた場合は、リモートから削除しない
+	repository := &fakeRepository{
+		localPlaylists:  []models.PlaylistContent{{Id: "p", Name: "pl", DirName: "pl", SnapshotId: "s"}},
+		remotePlaylists: []models.PlaylistContent{{Id: "p", Name: "pl", SnapshotId: "s2"}},
+		base:            []models.PlaylistSnapshot{{Id: "p", Name: "pl", DirName: "pl", SnapshotId: "s", TrackIds: []string{"a", "b", "c"}}},
+		localTracks:     map[string][]models.TrackContent{"pl": {{Id: "b", FileName: "b.txt"}, {Id: "c", FileName: "c.txt"}}},
+		remoteTracks: map[string][]models.TrackContent{"p": {
+			{Id: "b", Name: "b", Position: "0"}, {Id: "c", Name: "c", Position: "1"}, {Id: "a", Name: "a", Position: "2"},
+		}},
+	}
+	m := NewService(repository)
+	if err := m.SyncPlaylists(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"SaveBaseSnapshot", "CleanUpPlaylistContent"}
+	if !reflect.DeepEqual(repository.calls, expected) {
+		t.Errorf("actual: %v, expected: %v", repository.calls, expected)
+	}
+	// 次回も競合として検出されるようbaseに残す
+	if len(repository.base) != 1 || !isSameIds(repository.base[0].TrackIds, []string{"a", "b", "c"}) {
+		t.Errorf("actual: %v", repository.base)
+	}
+}
+
+func isSameIds(actual []string, expected []string) bool {
+	sorted := append([]string{}, actual...)
+	sort.Strings(sorted)
+	return reflect.DeepEqual(sorted, expected)
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+// journalに記録された実行の一覧を表示する
+func (m *service) ListRuns() error {
+	journal, err := m.repository.FetchJournal()
+	if err != nil {
+		return err
+	}
+	runIds, runs := groupJournalByRun(journal)
+	undone := undoneRuns(runIds, runs)
+	for _, runId := range runIds {
+		entries := runs[runId]
+		note := ""
+		if entries[0].UndoneRunId != "" {
+			note = "  (undo of " + entries[0].UndoneRunId + ")"
+		} else if by, ok := undone[runId]; ok {
+			note = "  (undone by " + by + ")"
+		}
+		fmt.Printf("%s  %s  %d changes%s\n", runId, entries[0].Time.Format("2006-01-02 15:04:05"), len(entries), note)
+	}
+	return nil
+}
+
+// runIdの実行でリモートに行った変更を、逆の操作を新しい順に行うことで元に戻す
+// runIdが空の場合は、まだ元に戻していない最後の実行を元に戻す
+func (m *service) Undo(runId string) error {
+	journal, err := m.repository.FetchJournal()
+	if err != nil {
+		return err
+	}
+	runIds, runs := groupJournalByRun(journal)
+	undone := undoneRuns(runIds, runs)
+	if runId == "" {
+		runId = lastUndoableRun(runIds, runs, undone)
+		if runId == "" {
+			return fmt.Errorf("there is nothing to undo")
+		}
+	}
+	entries, ok := runs[runId]
+	if !ok {
+		return fmt.Errorf("run '%s' not found", runId)
+	}
+	if by, ok := undone[runId]; ok {
+		return fmt.Errorf("run '%s' was already undone by '%s'", runId, by)
+	}
+	m.repository.SetUndoneRunId(runId)
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := m.undoEntry(entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 実行ごとにまとめたjournalと、実行の古い順のidを返す
+func groupJournalByRun(journal []models.JournalEntry) ([]string, map[string][]models.JournalEntry) {
+	runIds := []string{}
+	runs := map[string][]models.JournalEntry{}
+	for _, v := range journal {
+		if _, ok := runs[v.RunId]; !ok {
+			runIds = append(runIds, v.RunId)
+		}
+		runs[v.RunId] = append(runs[v.RunId], v)
+	}
+	return runIds, runs
+}
+
+// 元に戻された実行のidと、元に戻したundoの実行のidを返す
+// undoを元に戻した場合は、そのundoで元に戻された実行は元に戻されていない状態になる
+func undoneRuns(runIds []string, runs map[string][]models.JournalEntry) map[string]string {
+	res := map[string]string{}
+	for _, runId := range runIds {
+		undone := runs[runId][0].UndoneRunId
+		if undone == "" {
+			continue
+		}
+		res[undone] = runId
+		if entries, ok := runs[undone]; ok && entries[0].UndoneRunId != "" {
+			delete(res, entries[0].UndoneRunId)
+		}
+	}
+	return res
+}
+
+// undoの実行と元に戻された実行を除いた、最後の実行のidを返す
+func lastUndoableRun(runIds []string, runs map[string][]models.JournalEntry, undone map[string]string) string {
+	for i := len(runIds) - 1; i >= 0; i-- {
+		if _, ok := undone[runIds[i]]; ok || runs[runIds[i]][0].UndoneRunId != "" {
+			continue
+		}
+		return runIds[i]
+	}
+	return ""
+}
+
+func (m *service) undoEntry(entry models.JournalEntry) error {
+	playlist := models.PlaylistContent{Id: entry.PlaylistId, Name: entry.PlaylistName}
+	switch entry.Operation {
+	case models.JOURNAL_CREATE_PLAYLIST:
+		if err := m.repository.RemoveRemotePlaylist(playlist); err != nil {
+			return err
+		}
+		fmt.Println("-", entry.PlaylistName)
+	case models.JOURNAL_REMOVE_PLAYLIST:
+		if err := m.repository.FollowRemotePlaylist(entry.PlaylistId, entry.Public); err != nil {
+			return err
+		}
+		fmt.Println("+", entry.PlaylistName)
+	case models.JOURNAL_FOLLOW_PLAYLIST:
+		if err := m.repository.RemoveRemotePlaylist(playlist); err != nil {
+			return err
+		}
+		fmt.Println("-", entry.PlaylistName)
+	case models.JOURNAL_ADD_TRACKS:
+		return m.undoAddTracks(playlist, entry.Tracks)
+	case models.JOURNAL_REMOVE_TRACKS:
+		return m.undoRemoveTracks(playlist, entry.Tracks)
+	case models.JOURNAL_REPLACE_TRACKS:
+		if err := m.repository.ReplaceRemoteTrack(playlist, tracksWithId(entry.PlaylistName, entry.OldTracks)); err != nil {
+			return err
+		}
+		fmt.Println("  ~ tracks of", entry.PlaylistName)
+	case models.JOURNAL_REORDER_TRACK:
+		rangeStart, insertBefore := inverseReorder(entry.RangeStart, entry.InsertBefore)
+		if err := m.repository.ReorderRemoteTrack(playlist, rangeStart, insertBefore); err != nil {
+			return err
+		}
+		fmt.Println("  ~", entry.PlaylistName, rangeStart+1)
+	case models.JOURNAL_RENAME_PLAYLIST:
+		if err := m.repository.RenameRemotePlaylist(playlist, entry.OldName); err != nil {
+			return err
+		}
+		fmt.Println("~", entry.PlaylistName, "->", entry.OldName)
+	case models.JOURNAL_CHANGE_DETAIL:
+		if entry.OldDetail == nil {
+			fmt.Fprintln(os.Stderr, "Warning: the properties before the change were not recorded:", entry.PlaylistName)
+			return nil
+		}
+		playlist.SetDetail(*entry.OldDetail)
+		if err := m.repository.ChangeRemotePlaylistDetail(playlist); err != nil {
+			return err
+		}
+		fmt.Println("  ~ properties of", entry.PlaylistName)
+	case models.JOURNAL_SAVE_ALBUMS:
+		if err := m.repository.RemoveRemoteAlbums(entry.Albums); err != nil {
+			return err
+		}
+		for _, v := range entry.Albums {
+			fmt.Println("-", filepath.Join(models.ALBUMS_DIR_NAME, v.Name))
+		}
+	case models.JOURNAL_REMOVE_ALBUMS:
+		if err := m.repository.SaveRemoteAlbums(entry.Albums); err != nil {
+			return err
+		}
+		for _, v := range entry.Albums {
+			fmt.Println("+", filepath.Join(models.ALBUMS_DIR_NAME, v.Name))
+		}
+	case models.JOURNAL_FOLLOW_ARTISTS:
+		if err := m.repository.UnfollowRemoteArtists(entry.Artists); err != nil {
+			return err
+		}
+		for _, v := range entry.Artists {
+			fmt.Println("-", filepath.Join(models.ARTISTS_DIR_NAME, v.Name))
+		}
+	case models.JOURNAL_UNFOLLOW_ARTISTS:
+		if err := m.repository.FollowRemoteArtists(entry.Artists); err != nil {
+			return err
+		}
+		for _, v := range entry.Artists {
+			fmt.Println("+", filepath.Join(models.ARTISTS_DIR_NAME, v.Name))
+		}
+	case models.JOURNAL_UPLOAD_COVER:
+		fmt.Fprintln(os.Stderr, "Warning: the cover cannot be restored. Change it in the Spotify app:", entry.PlaylistName)
+	default:
+		fmt.Fprintln(os.Stderr, "Warning: unknown operation in the journal:", entry.Operation)
+	}
+	return nil
+}
+
+// 追加した曲をリモートから削除する
+// 同じ曲が複数ある場合は後ろにあるものを削除する
+func (m *service) undoAddTracks(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	current, err := m.repository.FetchRemotePlaylistTrack(playlist)
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, v := range current {
+		ids = append(ids, v.Id)
+	}
+
+	removed := []models.TrackContent{}
+	for _, idx := range lastOccurrences(ids, tracks) {
+		t := current[idx]
+		t.Position = strconv.Itoa(idx + 1)
+		removed = append(removed, t)
+	}
+	if err := m.repository.RemoveRemoteTrack(playlist, removed); err != nil {
+		return err
+	}
+	for _, v := range removed {
+		fmt.Println("  -", v.Name)
+	}
+	return nil
+}
+
+// 削除した曲を元の位置に追加し直す
+// 位置が記録されていない曲は末尾に追加する
+func (m *service) undoRemoveTracks(playlist models.PlaylistContent, tracks []models.TrackContent) error {
+	current, err := m.repository.FetchRemotePlaylistTrack(playlist)
+	if err != nil {
+		return err
+	}
+	length := len(current)
+
+	sorted := make([]models.TrackContent, len(tracks))
+	copy(sorted, tracks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, errA := strconv.Atoi(sorted[i].Position)
+		b, errB := strconv.Atoi(sorted[j].Position)
+		if errA != nil || errB != nil {
+			return errA == nil
+		}
+		return a < b
+	})
+
+	for _, v := range sorted {
+		c := make(chan []models.TrackContent, 1)
+		if err := m.repository.AddRemoteTrack(playlist.Id, []models.TrackContent{v}, c); err != nil {
+			return err
+		}
+		close(c)
+		// 末尾に追加した曲を元の位置に移動する
+		// お気に入りの曲は追加した日時の順に並ぶので移動できない
+		if position, err := strconv.Atoi(v.Position); err == nil && position-1 < length && !playlist.IsLikedSongs() {
+			if err := m.repository.ReorderRemoteTrack(playlist, length, position-1); err != nil {
+				return err
+			}
+		}
+		length++
+		fmt.Println("  +", v.Name)
+	}
+	return nil
+}
+
+// 曲を移動する操作の逆の操作を返す
+func inverseReorder(rangeStart int, insertBefore int) (int, int) {
+	// 移動後の位置
+	moved := insertBefore
+	if insertBefore > rangeStart {
+		moved--
+	}
+	if rangeStart > moved {
+		return moved, rangeStart + 1
+	}
+	return moved, rangeStart
+}
+
+// tracksの各曲について、idsの中で後ろから順に対応する位置を返す
+func lastOccurrences(ids []string, tracks []models.TrackContent) []int {
+	used := map[int]struct{}{}
+	res := []int{}
+	for i := len(tracks) - 1; i >= 0; i-- {
+		for j := len(ids) - 1; j >= 0; j-- {
+			if _, ok := used[j]; ok || ids[j] != tracks[i].Id {
+				continue
+			}
+			used[j] = struct{}{}
+			res = append(res, j)
+			break
+		}
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/kajikentaro/spotify-fbc/models"
+)
+
+func Test_inverseReorder(t *testing.T) {
+	tests := []struct {
+		rangeStart   int
+		insertBefore int
+	}{
+		{0, 3},
+		{3, 0},
+		{1, 2},
+		{2, 1},
+		{0, 4},
+	}
+	for _, tt := range tests {
+		list := []string{"a", "b", "c", "d"}
+		moved := reorder(list, tt.rangeStart, tt.insertBefore)
+		rangeStart, insertBefore := inverseReorder(tt.rangeStart, tt.insertBefore)
+		actual := reorder(moved, rangeStart, insertBefore)
+		for i := range list {
+			if actual[i] != list[i] {
+				t.Errorf("move %v: actual: %v, expected: %v", tt, actual, list)
+				break
+			}
+		}
+	}
+}
+
+// Spotifyのreorder APIと同じ規則で1曲を移動する
+func reorder(list []string, rangeStart int, insertBefore int) []string {
+	res := make([]string, len(list))
+	copy(res, list)
+	v := res[rangeStart]
+	res = append(res[:rangeStart], res[rangeStart+1:]...)
+	if insertBefore > rangeStart {
+		insertBefore--
+	}
+	return append(res[:insertBefore], append([]string{v}, res[insertBefore:]...)...)
+}
+
+func Test_lastOccurrences(t *testing.T) {
+	ids := []string{"a", "b", "a", "c", "a"}
+	tracks := []models.TrackContent{{Id: "a"}, {Id: "c"}, {Id: "a"}}
+	actual := lastOccurrences(ids, tracks)
+	expected := []int{4, 3, 2}
+	if len(actual) != len(expected) {
+		t.Fatalf("actual: %v, expected: %v", actual, expected)
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Errorf("actual: %v, expected: %v", actual, expected)
+		}
+	}
+}
+
+func Test_lastUndoableRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		journal  []models.JournalEntry
+		expected string
+	}{
+		{
+			name:     "empty",
+			journal:  []models.JournalEntry{},
+			expected: "",
+		},
+		{
+			name:     "last run",
+			journal:  []models.JournalEntry{{RunId: "a"}, {RunId: "b"}, {RunId: "b"}},
+			expected: "b",
+		},
+		{
+			// undoを繰り返すと、さらに前の実行を元に戻す
+			name:     "skip undo",
+			journal:  []models.JournalEntry{{RunId: "a"}, {RunId: "b"}, {RunId: "c", UndoneRunId: "b"}},
+			expected: "a",
+		},
+		{
+			name:     "everything undone",
+			journal:  []models.JournalEntry{{RunId: "a"}, {RunId: "b", UndoneRunId: "a"}},
+			expected: "",
+		},
+		{
+			// undoをundoした場合は、元の実行をもう一度元に戻せる
+			name:     "undo of undo",
+			journal:  []models.JournalEntry{{RunId: "a"}, {RunId: "b", UndoneRunId: "a"}, {RunId: "c", UndoneRunId: "b"}},
+			expected: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runIds, runs := groupJournalByRun(tt.journal)
+			actual := lastUndoableRun(runIds, runs, undoneRuns(runIds, runs))
+			if actual != tt.expected {
+				t.Errorf("actual: %v, expected: %v", actual, tt.expected)
+			}
+		})
+	}
+}